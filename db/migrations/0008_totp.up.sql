@@ -0,0 +1,17 @@
+-- Optional TOTP (RFC 6238) second factor.
+-- totp_secret is set during enrollment and only trusted once totp_enabled is true.
+ALTER TABLE users
+  ADD COLUMN totp_secret TEXT NULL,
+  ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;   -- last accepted time step (replay guard)
+
+-- One-time recovery codes; only a SHA-256 of each code is stored.
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  code_hash TEXT NOT NULL,
+  used_at TIMESTAMPTZ NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user ON user_recovery_codes(user_id);
@@ -0,0 +1,16 @@
+-- Personal access tokens for scripts/CI. Only a SHA-256 of the token is stored.
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  token_prefix TEXT NOT NULL,                          -- first chars, to recognise a token in the UI
+  scopes TEXT[] NOT NULL DEFAULT '{read}',             -- read | write
+  workspace_id UUID NULL REFERENCES workspaces(id) ON DELETE CASCADE,  -- NULL → all of the user's workspaces
+  expires_at TIMESTAMPTZ NOT NULL,
+  last_used_at TIMESTAMPTZ NULL,
+  revoked_at TIMESTAMPTZ NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id);
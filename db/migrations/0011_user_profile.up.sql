@@ -0,0 +1,3 @@
+ALTER TABLE users
+  ADD COLUMN avatar_url TEXT NULL,
+  ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
@@ -0,0 +1,25 @@
+-- Checklists live on a task; items are ordered, checkable, optionally assigned and dated.
+CREATE TABLE IF NOT EXISTS checklists (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+  title TEXT NOT NULL,
+  position INT NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS checklist_items (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  checklist_id UUID NOT NULL REFERENCES checklists(id) ON DELETE CASCADE,
+  body TEXT NOT NULL,
+  position INT NOT NULL DEFAULT 0,
+  done BOOLEAN NOT NULL DEFAULT FALSE,
+  done_at TIMESTAMPTZ NULL,
+  assignee_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+  due_date DATE NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_checklists_task_position ON checklists(task_id, position);
+CREATE INDEX IF NOT EXISTS idx_checklist_items_checklist_position ON checklist_items(checklist_id, position);
+CREATE INDEX IF NOT EXISTS idx_checklist_items_assignee ON checklist_items(assignee_id);
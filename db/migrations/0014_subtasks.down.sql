@@ -0,0 +1,5 @@
+ALTER TABLE lists DROP COLUMN IF EXISTS category;
+DROP INDEX IF EXISTS idx_tasks_parent;
+ALTER TABLE tasks
+  DROP CONSTRAINT IF EXISTS tasks_parent_not_self,
+  DROP COLUMN IF EXISTS parent_task_id;
@@ -0,0 +1,14 @@
+-- Parent/child tasks (may span lists and boards of the same workspace).
+ALTER TABLE tasks
+  ADD COLUMN parent_task_id UUID NULL REFERENCES tasks(id) ON DELETE SET NULL,
+  ADD CONSTRAINT tasks_parent_not_self CHECK (parent_task_id <> id);
+
+CREATE INDEX IF NOT EXISTS idx_tasks_parent ON tasks(parent_task_id);
+
+-- Where a list sits in the workflow; tasks in a 'done' list count as finished.
+ALTER TABLE lists
+  ADD COLUMN category TEXT NOT NULL DEFAULT 'active'
+    CHECK (category IN ('backlog', 'active', 'done'));
+
+UPDATE lists SET category='done' WHERE lower(name) = 'done';
+UPDATE lists SET category='backlog' WHERE lower(name) IN ('to do', 'todo', 'backlog');
@@ -0,0 +1,2 @@
+ALTER TABLE boards DROP COLUMN IF EXISTS enforce_blockers;
+DROP TABLE IF EXISTS task_links;
@@ -0,0 +1,16 @@
+-- Typed links between tasks. 'blocks' reads "from blocks to"; it must stay acyclic.
+CREATE TABLE IF NOT EXISTS task_links (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  from_task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+  to_task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+  type TEXT NOT NULL CHECK (type IN ('blocks', 'duplicates', 'relates')),
+  created_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CONSTRAINT task_links_not_self CHECK (from_task_id <> to_task_id),
+  CONSTRAINT task_links_unique UNIQUE (from_task_id, to_task_id, type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_links_to ON task_links(to_task_id, type);
+
+-- Opt-in per board: refuse moving a task into a 'done' list while its blockers are open.
+ALTER TABLE boards ADD COLUMN enforce_blockers BOOLEAN NOT NULL DEFAULT FALSE;
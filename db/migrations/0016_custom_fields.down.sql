@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS task_custom_values;
+DROP TABLE IF EXISTS board_custom_fields;
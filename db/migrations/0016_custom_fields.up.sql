@@ -0,0 +1,24 @@
+-- Board-level custom field definitions and their per-task values.
+-- options holds the allowed choices (JSON array of strings) for select/multi_select.
+CREATE TABLE IF NOT EXISTS board_custom_fields (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  board_id UUID NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  type TEXT NOT NULL CHECK (type IN ('text', 'number', 'date', 'select', 'multi_select', 'checkbox', 'user')),
+  options JSONB NOT NULL DEFAULT '[]',
+  position INT NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  CONSTRAINT board_custom_fields_name_unique UNIQUE (board_id, name)
+);
+
+-- value is validated against the field type by the API before it is stored.
+CREATE TABLE IF NOT EXISTS task_custom_values (
+  task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+  field_id UUID NOT NULL REFERENCES board_custom_fields(id) ON DELETE CASCADE,
+  value JSONB NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (task_id, field_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_board_custom_fields_board_position ON board_custom_fields(board_id, position);
+CREATE INDEX IF NOT EXISTS idx_task_custom_values_field ON task_custom_values(field_id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_tasks_list_due;
+ALTER TABLE boards DROP COLUMN IF EXISTS estimate_unit;
+ALTER TABLE tasks
+  DROP COLUMN IF EXISTS estimate,
+  DROP COLUMN IF EXISTS priority;
@@ -0,0 +1,12 @@
+-- First-class priority and effort on tasks.
+ALTER TABLE tasks
+  ADD COLUMN priority TEXT NOT NULL DEFAULT 'none'
+    CHECK (priority IN ('none', 'low', 'medium', 'high', 'urgent')),
+  ADD COLUMN estimate NUMERIC(8,2) NULL CHECK (estimate >= 0);
+
+-- Whether estimates on a board are story points or hours.
+ALTER TABLE boards
+  ADD COLUMN estimate_unit TEXT NOT NULL DEFAULT 'points'
+    CHECK (estimate_unit IN ('points', 'hours'));
+
+CREATE INDEX IF NOT EXISTS idx_tasks_list_due ON tasks(list_id, due_date);
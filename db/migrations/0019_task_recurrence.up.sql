@@ -0,0 +1,15 @@
+-- A recurring series is attached to its latest instance; each time a new
+-- instance is cloned the row moves over to it (task_id is updated).
+CREATE TABLE IF NOT EXISTS task_recurrences (
+  task_id UUID PRIMARY KEY REFERENCES tasks(id) ON DELETE CASCADE,
+  rrule TEXT NOT NULL,                 -- normalised RRULE subset, e.g. FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH
+  starts_on DATE NOT NULL,             -- anchor for intervals, weeks and day-of-month
+  next_due DATE NOT NULL,              -- date of the next instance to create
+  occurrences INT NOT NULL DEFAULT 1,  -- instances created so far, the first one included
+  list_id UUID NULL REFERENCES lists(id) ON DELETE SET NULL, -- where new instances go
+  created_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_recurrences_next_due ON task_recurrences(next_due);
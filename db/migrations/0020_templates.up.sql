@@ -0,0 +1,14 @@
+-- Saved board/task templates. Built-in templates live in the API code, not here.
+-- body is the JSON snapshot (see boardTemplate / taskTemplate in the API).
+CREATE TABLE IF NOT EXISTS templates (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+  kind TEXT NOT NULL CHECK (kind IN ('board', 'task')),
+  name TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  body JSONB NOT NULL,
+  created_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_templates_workspace_kind ON templates(workspace_id, kind);
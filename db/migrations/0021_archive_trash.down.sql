@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_tasks_archived;
+DROP INDEX IF EXISTS idx_tasks_deleted;
+DROP INDEX IF EXISTS idx_lists_deleted;
+DROP INDEX IF EXISTS idx_boards_deleted;
+ALTER TABLE tasks DROP COLUMN IF EXISTS deleted_by, DROP COLUMN IF EXISTS deleted_at, DROP COLUMN IF EXISTS archived_at;
+ALTER TABLE lists DROP COLUMN IF EXISTS deleted_by, DROP COLUMN IF EXISTS deleted_at, DROP COLUMN IF EXISTS archived_at;
+ALTER TABLE boards DROP COLUMN IF EXISTS deleted_by, DROP COLUMN IF EXISTS deleted_at, DROP COLUMN IF EXISTS archived_at;
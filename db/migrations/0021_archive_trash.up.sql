@@ -0,0 +1,21 @@
+-- Soft archive and trash. Hidden rows keep their data; the API filters them out
+-- of the board payload and a retention job purges trash for good.
+ALTER TABLE boards
+  ADD COLUMN archived_at TIMESTAMPTZ NULL,
+  ADD COLUMN deleted_at TIMESTAMPTZ NULL,
+  ADD COLUMN deleted_by UUID NULL REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE lists
+  ADD COLUMN archived_at TIMESTAMPTZ NULL,
+  ADD COLUMN deleted_at TIMESTAMPTZ NULL,
+  ADD COLUMN deleted_by UUID NULL REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE tasks
+  ADD COLUMN archived_at TIMESTAMPTZ NULL,
+  ADD COLUMN deleted_at TIMESTAMPTZ NULL,
+  ADD COLUMN deleted_by UUID NULL REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_boards_deleted ON boards(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_lists_deleted ON lists(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_tasks_deleted ON tasks(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_tasks_archived ON tasks(list_id) WHERE archived_at IS NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE boards DROP COLUMN IF EXISTS wip_mode;
+ALTER TABLE lists DROP COLUMN IF EXISTS wip_limit;
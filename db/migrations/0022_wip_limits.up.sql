@@ -0,0 +1,8 @@
+-- Optional work-in-progress cap per list, and whether a board blocks or just
+-- flags moves past it.
+ALTER TABLE lists
+  ADD COLUMN wip_limit INT NULL CHECK (wip_limit > 0);
+
+ALTER TABLE boards
+  ADD COLUMN wip_mode TEXT NOT NULL DEFAULT 'flag'
+    CHECK (wip_mode IN ('flag', 'reject'));
@@ -0,0 +1,5 @@
+ALTER TABLE tasks DROP COLUMN IF EXISTS lane_id;
+ALTER TABLE boards
+  DROP COLUMN IF EXISTS lane_field_id,
+  DROP COLUMN IF EXISTS lane_mode;
+DROP TABLE IF EXISTS board_lanes;
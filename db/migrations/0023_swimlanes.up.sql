@@ -0,0 +1,20 @@
+-- Swimlanes split a board horizontally. Lanes are either defined by hand
+-- (board_lanes, with tasks pointing at one) or computed from the first
+-- assignee or a custom field, per boards.lane_mode.
+CREATE TABLE IF NOT EXISTS board_lanes (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  board_id UUID NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  position INT NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_board_lanes_board_position ON board_lanes(board_id, position);
+
+ALTER TABLE boards
+  ADD COLUMN lane_mode TEXT NOT NULL DEFAULT 'none'
+    CHECK (lane_mode IN ('none', 'manual', 'assignee', 'field')),
+  ADD COLUMN lane_field_id UUID NULL REFERENCES board_custom_fields(id) ON DELETE SET NULL;
+
+ALTER TABLE tasks
+  ADD COLUMN lane_id UUID NULL REFERENCES board_lanes(id) ON DELETE SET NULL;
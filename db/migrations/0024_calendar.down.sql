@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS calendar_feeds;
+DROP INDEX IF EXISTS idx_tasks_list_start;
+ALTER TABLE tasks
+  DROP CONSTRAINT IF EXISTS tasks_start_before_due,
+  DROP COLUMN IF EXISTS start_date;
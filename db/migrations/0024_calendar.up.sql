@@ -0,0 +1,16 @@
+-- Start dates for calendar spans, and secret-token iCalendar feeds.
+ALTER TABLE tasks
+  ADD COLUMN start_date DATE NULL,
+  ADD CONSTRAINT tasks_start_before_due CHECK (start_date IS NULL OR due_date IS NULL OR start_date <= due_date);
+
+-- One feed per user; only a SHA-256 of the token in the feed URL is stored.
+-- Rotating replaces the row, so the old URL stops working.
+CREATE TABLE IF NOT EXISTS calendar_feeds (
+  user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+  token_hash TEXT NOT NULL UNIQUE,
+  token_prefix TEXT NOT NULL,
+  last_used_at TIMESTAMPTZ NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_tasks_list_start ON tasks(list_id, start_date);
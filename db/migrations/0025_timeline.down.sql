@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS board_holidays;
+ALTER TABLE boards DROP COLUMN IF EXISTS weekend_days;
@@ -0,0 +1,10 @@
+-- Working-day calendar per board, used when scheduling shifts dependent tasks.
+-- weekend_days are day-of-week numbers, 0 = Sunday (as EXTRACT(DOW)).
+ALTER TABLE boards ADD COLUMN weekend_days SMALLINT[] NOT NULL DEFAULT '{0,6}';
+
+CREATE TABLE IF NOT EXISTS board_holidays (
+  board_id UUID NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+  day DATE NOT NULL,
+  name TEXT NOT NULL DEFAULT '',
+  PRIMARY KEY (board_id, day)
+);
@@ -0,0 +1,22 @@
+-- List-transition history for flow metrics. Categories are copied at move
+-- time so recategorizing a list later doesn't rewrite the past.
+-- A row with no from_list_id is the task arriving (created, copied, spawned).
+CREATE TABLE IF NOT EXISTS task_transitions (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+  board_id UUID NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+  from_list_id UUID NULL REFERENCES lists(id) ON DELETE SET NULL,
+  to_list_id UUID NULL REFERENCES lists(id) ON DELETE SET NULL,
+  from_category TEXT NULL,
+  to_category TEXT NOT NULL,
+  moved_by UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+  moved_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_transitions_board ON task_transitions(board_id, moved_at);
+CREATE INDEX IF NOT EXISTS idx_task_transitions_task ON task_transitions(task_id, moved_at);
+
+-- Existing tasks start their history where they are now.
+INSERT INTO task_transitions (task_id, board_id, to_list_id, to_category, moved_by, moved_at)
+SELECT t.id, l.board_id, l.id, l.category, t.created_by, t.created_at
+FROM tasks t JOIN lists l ON l.id = t.list_id;
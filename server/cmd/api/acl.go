@@ -0,0 +1,85 @@
+// acl.go
+package main
+
+import "database/sql"
+
+// queryer is satisfied by both *sql.DB and *sql.Tx so ACL checks can run inside a transaction.
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// All checks boil down to "the user is a member of the owning workspace".
+// $3 narrows that to a single workspace for workspace-scoped API tokens.
+
+func canAccessWorkspace(q queryer, sess Session, workspaceID string) bool {
+	var ok bool
+	err := q.QueryRow(`
+		SELECT EXISTS(
+		  SELECT 1 FROM workspace_members m
+		  WHERE m.workspace_id = $1 AND m.user_id = $2
+		    AND m.workspace_id = COALESCE($3::uuid, m.workspace_id)
+		)`, workspaceID, sess.UserID, sess.workspaceScope()).Scan(&ok)
+	return err == nil && ok
+}
+
+func canAccessBoard(q queryer, sess Session, boardID string) bool {
+	var ok bool
+	err := q.QueryRow(`
+		SELECT EXISTS(
+		  SELECT 1 FROM boards b
+		  JOIN workspace_members m ON m.workspace_id = b.workspace_id
+		  WHERE b.id = $1 AND m.user_id = $2
+		    AND m.workspace_id = COALESCE($3::uuid, m.workspace_id)
+		)`, boardID, sess.UserID, sess.workspaceScope()).Scan(&ok)
+	return err == nil && ok
+}
+
+func canAccessList(q queryer, sess Session, listID string) bool {
+	var ok bool
+	err := q.QueryRow(`
+		SELECT EXISTS(
+		  SELECT 1 FROM lists l
+		  JOIN boards b ON b.id = l.board_id
+		  JOIN workspace_members m ON m.workspace_id = b.workspace_id
+		  WHERE l.id = $1 AND m.user_id = $2
+		    AND m.workspace_id = COALESCE($3::uuid, m.workspace_id)
+		)`, listID, sess.UserID, sess.workspaceScope()).Scan(&ok)
+	return err == nil && ok
+}
+
+func canAccessTask(q queryer, sess Session, taskID string) bool {
+	var ok bool
+	err := q.QueryRow(`
+		SELECT EXISTS(
+		  SELECT 1 FROM tasks t
+		  JOIN lists l ON l.id = t.list_id
+		  JOIN boards b ON b.id = l.board_id
+		  JOIN workspace_members m ON m.workspace_id = b.workspace_id
+		  WHERE t.id = $1 AND m.user_id = $2
+		    AND m.workspace_id = COALESCE($3::uuid, m.workspace_id)
+		)`, taskID, sess.UserID, sess.workspaceScope()).Scan(&ok)
+	return err == nil && ok
+}
+
+func canAccessChecklist(q queryer, sess Session, checklistID string) bool {
+	var taskID string
+	if err := q.QueryRow(`SELECT task_id FROM checklists WHERE id=$1`, checklistID).Scan(&taskID); err != nil {
+		return false
+	}
+	return canAccessTask(q, sess, taskID)
+}
+
+// isTaskWorkspaceMember reports whether userID could be assigned work on the task,
+// i.e. belongs to the workspace that owns it.
+func isTaskWorkspaceMember(q queryer, taskID, userID string) bool {
+	var ok bool
+	err := q.QueryRow(`
+		SELECT EXISTS(
+		  SELECT 1 FROM tasks t
+		  JOIN lists l ON l.id = t.list_id
+		  JOIN boards b ON b.id = l.board_id
+		  JOIN workspace_members m ON m.workspace_id = b.workspace_id
+		  WHERE t.id = $1 AND m.user_id = $2
+		)`, taskID, userID).Scan(&ok)
+	return err == nil && ok
+}
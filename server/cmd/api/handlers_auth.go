@@ -5,8 +5,12 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -16,7 +20,47 @@ import (
 
 // ---- password hashing ----
 
+// Each Argon2 run holds 64 MiB, so only a few may run at once. Callers queue
+// for a slot for up to argon2MaxWait, then get errHasherBusy (→ 503).
+const argon2MaxWait = 5 * time.Second
+
+var (
+	errHasherBusy = errors.New("password hasher busy")
+	argon2Slots   = make(chan struct{}, argon2Concurrency())
+)
+
+func argon2Concurrency() int {
+	if n, err := strconv.Atoi(os.Getenv("ARGON2_MAX_CONCURRENCY")); err == nil && n > 0 {
+		return n
+	}
+	return max(1, runtime.NumCPU()/2)
+}
+
+func acquireArgon2() error {
+	t := time.NewTimer(argon2MaxWait)
+	defer t.Stop()
+	select {
+	case argon2Slots <- struct{}{}:
+		return nil
+	case <-t.C:
+		return errHasherBusy
+	}
+}
+
+func releaseArgon2() { <-argon2Slots }
+
+// writeHasherBusy answers a request that couldn't get an Argon2 slot.
+func writeHasherBusy(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "server busy, try again", http.StatusServiceUnavailable)
+}
+
 func hashPassword(pw string) (string, error) {
+	if err := acquireArgon2(); err != nil {
+		return "", err
+	}
+	defer releaseArgon2()
+
 	salt := make([]byte, 16)
 	if _, err := rand.Read(salt); err != nil {
 		return "", err
@@ -33,33 +77,86 @@ func hashPassword(pw string) (string, error) {
 		base64.RawStdEncoding.EncodeToString(dk), nil
 }
 
-func verifyPassword(pw, encoded string) bool {
+func verifyPassword(pw, encoded string) (bool, error) {
 	parts := strings.Split(encoded, "$")
 	if len(parts) != 6 || parts[1] != "argon2id" {
-		return false
+		return false, nil
 	}
 	salt, err1 := base64.RawStdEncoding.DecodeString(parts[4])
 	want, err2 := base64.RawStdEncoding.DecodeString(parts[5])
 	if err1 != nil || err2 != nil {
-		return false
+		return false, nil
 	}
+	if err := acquireArgon2(); err != nil {
+		return false, err
+	}
+	defer releaseArgon2()
 	dk := argon2.IDKey([]byte(pw), salt, 3, 64*1024, 1, uint32(len(want)))
 	if len(dk) != len(want) {
-		return false
+		return false, nil
 	}
 	var v byte
 	for i := range dk {
 		v |= dk[i] ^ want[i]
 	}
-	return v == 0
+	return v == 0, nil
 }
 
 // ---- session store (dev-only) ----
 
+// Sessions slide: each request pushes Expires out by sessionIdleTTL, but never
+// past sessionMaxAge after login.
+const (
+	sessionIdleTTL = 24 * time.Hour
+	sessionMaxAge  = 30 * 24 * time.Hour
+)
+
 type Session struct {
+	ID      string // public handle for listing/revoking; never the sid itself
 	UserID  string
 	CSRF    string
 	Expires time.Time
+
+	CreatedAt time.Time
+	LastSeen  time.Time
+	IP        string
+	UserAgent string
+
+	// Set only for requests authenticated with a personal access token
+	TokenID     string
+	Scopes      []string
+	WorkspaceID string // non-empty → token limited to this workspace
+}
+
+func (s Session) nextExpiry(now time.Time) time.Time {
+	exp := now.Add(sessionIdleTTL)
+	if limit := s.CreatedAt.Add(sessionMaxAge); exp.After(limit) {
+		return limit
+	}
+	return exp
+}
+
+// hasScope reports whether the request may perform an action needing scope.
+// Cookie sessions can do everything; "write" tokens imply "read".
+func (s Session) hasScope(scope string) bool {
+	if s.TokenID == "" {
+		return true
+	}
+	for _, sc := range s.Scopes {
+		if sc == scope || (scope == tokenScopeRead && sc == tokenScopeWrite) {
+			return true
+		}
+	}
+	return false
+}
+
+// workspaceScope is the value ACL queries compare workspace ids against
+// (NULL means "any workspace the user belongs to").
+func (s Session) workspaceScope() any {
+	if s.WorkspaceID == "" {
+		return nil
+	}
+	return s.WorkspaceID
 }
 
 var (
@@ -101,7 +198,10 @@ func registerHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 	h, err := hashPassword(req.Password)
-	if err != nil {
+	if err == errHasherBusy {
+		writeHasherBusy(w)
+		return
+	} else if err != nil {
 		http.Error(w, "hashing failed", http.StatusInternalServerError)
 		return
 	}
@@ -153,40 +253,9 @@ func provisionPersonalWorkspace(db *sql.DB, userID, userName string) error {
 		return err
 	}
 
-	// 3) default board
-	var boardID string
-	if err = tx.QueryRow(
-		`INSERT INTO boards (name, owner_id, workspace_id) VALUES ($1,$2,$3) RETURNING id`,
-		"My Board", userID, wsID,
-	).Scan(&boardID); err != nil {
-		return err
-	}
-
-	// 4) three starter lists
-	if _, err = tx.Exec(
-		`INSERT INTO lists (board_id, name, position)
-         VALUES ($1,'To Do',0), ($1,'In Progress',1), ($1,'Done',2)`,
-		boardID,
-	); err != nil {
-		return err
-	}
-
-	// 4.1) three example tasks in "To Do"
-	var todoListID string
-	if err = tx.QueryRow(
-		`SELECT id FROM lists WHERE board_id=$1 AND name='To Do' LIMIT 1`,
-		boardID,
-	).Scan(&todoListID); err != nil {
-		return err
-	}
-	if _, err = tx.Exec(
-		`INSERT INTO tasks (list_id, title, description, position, status, created_by)
-         VALUES
-         ($1, 'Welcome to your board', 'Drag cards between lists as work progresses.', 0, 'todo', $2),
-         ($1, 'Create your first task', 'Click + to add tasks. Assign teammates later.', 1, 'todo', $2),
-         ($1, 'Invite a teammate', 'Collaborate by inviting others to your workspace.', 2, 'todo', $2)`,
-		todoListID, userID,
-	); err != nil {
+	// 3) default board from the built-in Kanban template
+	kanban, _ := findBuiltinTemplate("kanban")
+	if _, err = instantiateBoardTemplate(tx, kanban.Board, wsID, userID, "My Board"); err != nil {
 		return err
 	}
 
@@ -200,7 +269,9 @@ type loginReq struct {
 	Password string `json:"password"`
 }
 type loginResp struct {
-	UserID string `json:"user_id"`
+	UserID      string `json:"user_id,omitempty"`
+	MFARequired bool   `json:"mfa_required,omitempty"`
+	Challenge   string `json:"challenge,omitempty"`
 }
 
 func loginHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
@@ -217,25 +288,81 @@ func loginHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		http.Error(w, "missing fields", http.StatusBadRequest)
 		return
 	}
+
+	// Locked out (per IP or per account) → don't even spend an Argon2 run
+	keys := loginKeys(r, req.Email)
+	if wait := loginLockedFor(keys); wait > 0 {
+		setRetryAfter(w, wait)
+		http.Error(w, "too many failed attempts", http.StatusTooManyRequests)
+		return
+	}
+
 	var userID, pwHash string
-	err := db.QueryRow(`SELECT id, password_hash FROM users WHERE email=$1`, req.Email).Scan(&userID, &pwHash)
+	var totpEnabled bool
+	err := db.QueryRow(`SELECT id, password_hash, totp_enabled FROM users WHERE email=$1`, req.Email).Scan(&userID, &pwHash, &totpEnabled)
 	if err == sql.ErrNoRows {
+		recordLoginFailure(keys)
 		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	} else if err != nil {
 		http.Error(w, "login failed", http.StatusInternalServerError)
 		return
 	}
-	if !verifyPassword(req.Password, pwHash) {
+	valid, err := verifyPassword(req.Password, pwHash)
+	if err == errHasherBusy {
+		writeHasherBusy(w)
+		return
+	} else if err != nil {
+		http.Error(w, "login failed", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		recordLoginFailure(keys)
 		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	}
+	clearLoginFailures(req.Email)
+
+	// 2FA enabled → no session yet; the client must finish via /api/login/mfa
+	if totpEnabled {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(loginResp{MFARequired: true, Challenge: newMFAChallenge(userID)})
+		return
+	}
+
+	startSession(w, r, userID)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(loginResp{UserID: userID})
+}
+
+// startSession creates a new session for userID and sets the sid/csrf cookies.
+func startSession(w http.ResponseWriter, r *http.Request, userID string) {
+	now := time.Now()
 	sid := randToken(24)
-	csrf := randToken(24)
+	s := Session{
+		ID:        randToken(12),
+		UserID:    userID,
+		CSRF:      randToken(24),
+		CreatedAt: now,
+		LastSeen:  now,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+	s.Expires = s.nextExpiry(now)
+
 	sessionsMu.Lock()
-	sessions[sid] = Session{UserID: userID, CSRF: csrf, Expires: time.Now().Add(24 * time.Hour)}
+	for k, old := range sessions { // opportunistic cleanup
+		if now.After(old.Expires) {
+			delete(sessions, k)
+		}
+	}
+	sessions[sid] = s
 	sessionsMu.Unlock()
 
+	setSessionCookies(w, sid, s.CSRF)
+}
+
+func setSessionCookies(w http.ResponseWriter, sid, csrf string) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "sid",
 		Value:    sid,
@@ -250,29 +377,46 @@ func loginHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		HttpOnly: false,
 		SameSite: http.SameSiteLaxMode,
 	})
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(loginResp{UserID: userID})
 }
 
 // ---- /api/me ----
 
 type meResp struct {
-	ID    string `json:"id"`
-	Email string `json:"email"`
-	Name  string `json:"name"`
+	ID        string  `json:"id"`
+	Email     string  `json:"email"`
+	Name      string  `json:"name"`
+	AvatarURL *string `json:"avatar_url"`
 }
 
-func getSessionFromRequest(r *http.Request) (Session, bool) {
+// getSessionFromRequest authenticates a read request, either by the "sid"
+// cookie or by an "Authorization: Bearer" personal access token.
+func getSessionFromRequest(r *http.Request, db *sql.DB) (Session, bool) {
+	if raw, ok := bearerToken(r); ok {
+		s, ok := sessionFromAPIToken(db, raw)
+		if !ok || !s.hasScope(tokenScopeRead) {
+			return Session{}, false
+		}
+		return s, true
+	}
 	c, err := r.Cookie("sid")
 	if err != nil || c.Value == "" {
 		return Session{}, false
 	}
+	now := time.Now()
 	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
 	s, ok := sessions[c.Value]
-	sessionsMu.Unlock()
-	if !ok || time.Now().After(s.Expires) {
+	if !ok {
 		return Session{}, false
 	}
+	if now.After(s.Expires) {
+		delete(sessions, c.Value)
+		return Session{}, false
+	}
+	s.LastSeen = now
+	s.IP = clientIP(r)
+	s.Expires = s.nextExpiry(now)
+	sessions[c.Value] = s
 	return s, true
 }
 
@@ -281,28 +425,47 @@ func meHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	sess, ok := getSessionFromRequest(r)
+	sess, ok := getSessionFromRequest(r, db)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
-	var email, name string
-	if err := db.QueryRow(`SELECT email, name FROM users WHERE id=$1`, sess.UserID).Scan(&email, &name); err != nil {
+	out, err := loadMe(db, sess.UserID)
+	if err != nil {
 		http.Error(w, "user not found", http.StatusUnauthorized)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(meResp{ID: sess.UserID, Email: email, Name: name})
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func loadMe(db *sql.DB, userID string) (meResp, error) {
+	out := meResp{ID: userID}
+	var avatar sql.NullString
+	err := db.QueryRow(`SELECT email, name, avatar_url FROM users WHERE id=$1`, userID).Scan(&out.Email, &out.Name, &avatar)
+	if avatar.Valid {
+		out.AvatarURL = &avatar.String
+	}
+	return out, err
 }
 
 // ---- CSRF helper for POST/PUT/PATCH/DELETE ----
 
-func requireAuthAndCSRF(w http.ResponseWriter, r *http.Request) (Session, bool) {
-	s, ok := getSessionFromRequest(r)
+// Bearer tokens are not sent automatically by browsers, so they skip the CSRF
+// check but need the "write" scope instead.
+func requireAuthAndCSRF(w http.ResponseWriter, r *http.Request, db *sql.DB) (Session, bool) {
+	s, ok := getSessionFromRequest(r, db)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return Session{}, false
 	}
+	if s.TokenID != "" {
+		if !s.hasScope(tokenScopeWrite) {
+			http.Error(w, "token lacks write scope", http.StatusForbidden)
+			return Session{}, false
+		}
+		return s, true
+	}
 	token := r.Header.Get("X-CSRF-Token")
 	if token == "" || token != s.CSRF {
 		http.Error(w, "forbidden", http.StatusForbidden)
@@ -311,6 +474,20 @@ func requireAuthAndCSRF(w http.ResponseWriter, r *http.Request) (Session, bool)
 	return s, true
 }
 
+// requireBrowserSession is requireAuthAndCSRF for account-security endpoints
+// (2FA, tokens): API tokens are refused there so a leaked token can't escalate.
+func requireBrowserSession(w http.ResponseWriter, r *http.Request, db *sql.DB) (Session, bool) {
+	s, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return Session{}, false
+	}
+	if s.TokenID != "" {
+		http.Error(w, "not allowed with an API token", http.StatusForbidden)
+		return Session{}, false
+	}
+	return s, true
+}
+
 func logoutHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -322,7 +499,14 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) {
 		deleteSessionByID(sid)
 	}
 
-	// Expire cookies
+	clearSessionCookies(w)
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"ok":true}`))
+}
+
+// clearSessionCookies expires the sid/csrf cookies.
+func clearSessionCookies(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "sid",
 		Value:    "",
@@ -338,9 +522,6 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) {
 		SameSite: http.SameSiteLaxMode,
 		MaxAge:   -1,
 	})
-
-	w.Header().Set("Content-Type", "application/json")
-	_, _ = w.Write([]byte(`{"ok":true}`))
 }
 
 // readSIDCookie extracts the session id from the "sid" cookie.
@@ -359,3 +540,41 @@ func deleteSessionByID(sid string) {
 	defer sessionsMu.Unlock()
 	delete(sessions, sid)
 }
+
+// rotateSession moves the request's session to a fresh sid and CSRF token,
+// keeping its metadata. Called after privilege/security changes so a sid
+// captured earlier stops working.
+func rotateSession(w http.ResponseWriter, r *http.Request) {
+	old, ok := readSIDCookie(r)
+	if !ok {
+		return
+	}
+	sessionsMu.Lock()
+	s, ok := sessions[old]
+	if !ok {
+		sessionsMu.Unlock()
+		return
+	}
+	sid := randToken(24)
+	s.CSRF = randToken(24)
+	delete(sessions, old)
+	sessions[sid] = s
+	sessionsMu.Unlock()
+
+	setSessionCookies(w, sid, s.CSRF)
+}
+
+// deleteUserSessions removes all of a user's sessions except the one with
+// public id keepID (pass "" to remove all). Returns how many were removed.
+func deleteUserSessions(userID, keepID string) int {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	n := 0
+	for sid, s := range sessions {
+		if s.UserID == userID && s.ID != keepID {
+			delete(sessions, sid)
+			n++
+		}
+	}
+	return n
+}
@@ -4,37 +4,266 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 // ---- DTOs for board payload ----
 
 type BoardDTO struct {
-	ID    string    `json:"id"`
-	Name  string    `json:"name"`
-	Lists []ListDTO `json:"lists"`
+	ID              string           `json:"id"`
+	Name            string           `json:"name"`
+	WorkspaceID     string           `json:"workspace_id"`
+	EnforceBlockers bool             `json:"enforce_blockers"`
+	EstimateUnit    string           `json:"estimate_unit"` // points | hours
+	WIPMode         string           `json:"wip_mode"`      // flag | reject
+	LaneMode        string           `json:"lane_mode"`     // none | manual | assignee | field
+	LaneFieldID     *string          `json:"lane_field_id"` // lane_mode=field
+	CustomFields    []CustomFieldDTO `json:"custom_fields"`
+	Lanes           []BoardLaneDTO   `json:"lanes,omitempty"` // ?group=lanes
+	Lists           []ListDTO        `json:"lists"`
 }
 
 type ListDTO struct {
-	ID       string    `json:"id"`
-	Name     string    `json:"name"`
-	Position int       `json:"position"`
-	Tasks    []TaskDTO `json:"tasks"`
+	ID       string     `json:"id"`
+	Name     string     `json:"name"`
+	Position int        `json:"position"`
+	Category string     `json:"category"` // backlog | active | done
+	WIPLimit *int       `json:"wip_limit"`
+	OverWIP  bool       `json:"over_wip"` // more live tasks than wip_limit
+	Totals   ListTotals `json:"totals"`
+	Tasks    []TaskDTO  `json:"tasks"`
+	// With ?group=lanes, Tasks is empty and the same tasks come one group
+	// per board lane, in BoardDTO.Lanes order.
+	Lanes []LaneGroupDTO `json:"lanes,omitempty"`
+}
+
+// ListTotals covers every task in the list, regardless of board filters.
+type ListTotals struct {
+	Tasks    int     `json:"tasks"`
+	Estimate float64 `json:"estimate"`
 }
 
 type TaskDTO struct {
-	ID           string   `json:"id"`
-	Title        string   `json:"title"`
-	Description  string   `json:"description"`
-	Position     int      `json:"position"`
-	Assignees    []string `json:"assignees"`
-	CommentCount int      `json:"comment_count"`
+	ID                string      `json:"id"`
+	Title             string      `json:"title"`
+	Description       string      `json:"description"`
+	Position          int         `json:"position"`
+	Priority          string      `json:"priority"`
+	Estimate          *float64    `json:"estimate"`
+	DueDate           *string     `json:"due_date"`
+	StartDate         *string     `json:"start_date"`
+	Assignees         []string    `json:"assignees"`
+	CommentCount      int         `json:"comment_count"`
+	ChecklistProgress ProgressDTO `json:"checklist_progress"`
+	ParentID          *string     `json:"parent_id"`
+	SubtaskProgress   ProgressDTO `json:"subtask_progress"`
+	Blocked           bool        `json:"blocked"`
+	TimeSpent         int64       `json:"time_spent_seconds"`
+	Recurrence        *string     `json:"recurrence"` // RRULE, when recurring
+	LaneID            *string     `json:"lane_id"`    // manual swimlane
+	// field id → value, see handlers_customfields.go
+	CustomFields map[string]json.RawMessage `json:"custom_fields"`
+}
+
+// ProgressDTO is a done/total counter (checklist items, subtasks, ...).
+type ProgressDTO struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// taskDTOCols are the tasks columns scanTaskDTO reads, in order, from alias t.
+const taskDTOCols = `t.id, t.title, t.description, t.position, t.parent_task_id, t.priority, t.estimate, t.due_date, t.start_date, t.lane_id`
+
+// scanTaskDTO reads taskDTOCols followed by any extra columns into extra.
+func scanTaskDTO(s rowScanner, extra ...any) (TaskDTO, error) {
+	var t TaskDTO
+	var parentID, laneID sql.NullString
+	var est sql.NullFloat64
+	var due, start sql.NullTime
+	dest := append([]any{&t.ID, &t.Title, &t.Description, &t.Position, &parentID, &t.Priority, &est, &due, &start, &laneID}, extra...)
+	if err := s.Scan(dest...); err != nil {
+		return t, err
+	}
+	if parentID.Valid {
+		t.ParentID = &parentID.String
+	}
+	if est.Valid {
+		t.Estimate = &est.Float64
+	}
+	if due.Valid {
+		d := due.Time.Format(dateLayout)
+		t.DueDate = &d
+	}
+	if start.Valid {
+		d := start.Time.Format(dateLayout)
+		t.StartDate = &d
+	}
+	if laneID.Valid {
+		t.LaneID = &laneID.String
+	}
+	return t, nil
+}
+
+// fillTaskExtras loads the per-task data that lives outside the tasks row,
+// one query per part for the whole page. want picks parts by JSON name; nil
+// loads everything. The rules match the single-task helpers (taskBlocked,
+// subtaskProgress, ...).
+func fillTaskExtras(db *sql.DB, tasks []*TaskDTO, want func(string) bool) error {
+	if want == nil {
+		want = func(string) bool { return true }
+	}
+	byID := make(map[string]*TaskDTO, len(tasks))
+	ids := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		t.Assignees = make([]string, 0)
+		if want("custom_fields") {
+			t.CustomFields = make(map[string]json.RawMessage)
+		}
+		byID[t.ID] = t
+		ids = append(ids, t.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	const page = `ANY(string_to_array($1, ',')::uuid[])`
+	parts := []struct {
+		key   string
+		query string
+		apply func(rowScanner) error
+	}{
+		// assignees, oldest first (the first one picks the assignee lane)
+		{"assignees", `
+			SELECT task_id, user_id FROM task_assignees WHERE task_id = ` + page + ` ORDER BY assigned_at ASC`,
+			func(s rowScanner) error {
+				var id, uid string
+				err := s.Scan(&id, &uid)
+				if err == nil {
+					byID[id].Assignees = append(byID[id].Assignees, uid)
+				}
+				return err
+			}},
+		{"comment_count", `
+			SELECT task_id, COUNT(*) FROM comments WHERE task_id = ` + page + ` GROUP BY task_id`,
+			func(s rowScanner) error {
+				var id string
+				var n int
+				err := s.Scan(&id, &n)
+				if err == nil {
+					byID[id].CommentCount = n
+				}
+				return err
+			}},
+		// checklist items done/total across all checklists
+		{"checklist_progress", `
+			SELECT c.task_id, COUNT(*) FILTER (WHERE i.done), COUNT(*)
+			FROM checklist_items i JOIN checklists c ON c.id = i.checklist_id
+			WHERE c.task_id = ` + page + `
+			GROUP BY c.task_id`,
+			func(s rowScanner) error {
+				var id string
+				var p ProgressDTO
+				err := s.Scan(&id, &p.Done, &p.Total)
+				if err == nil {
+					byID[id].ChecklistProgress = p
+				}
+				return err
+			}},
+		// children done/total; trashed children don't count
+		{"subtask_progress", `
+			SELECT t.parent_task_id, COUNT(*) FILTER (WHERE l.category = 'done'), COUNT(*)
+			FROM tasks t JOIN lists l ON l.id = t.list_id
+			WHERE t.parent_task_id = ` + page + ` AND t.deleted_at IS NULL
+			GROUP BY t.parent_task_id`,
+			func(s rowScanner) error {
+				var id string
+				var p ProgressDTO
+				err := s.Scan(&id, &p.Done, &p.Total)
+				if err == nil {
+					byID[id].SubtaskProgress = p
+				}
+				return err
+			}},
+		// open blockers
+		{"blocked", `
+			SELECT DISTINCT k.to_task_id FROM task_links k
+			JOIN tasks t ON t.id = k.from_task_id
+			JOIN lists l ON l.id = t.list_id
+			WHERE k.to_task_id = ` + page + ` AND k.type = 'blocks' AND l.category <> 'done' AND t.deleted_at IS NULL`,
+			func(s rowScanner) error {
+				var id string
+				err := s.Scan(&id)
+				if err == nil {
+					byID[id].Blocked = true
+				}
+				return err
+			}},
+		{"recurrence", `
+			SELECT task_id, rrule FROM task_recurrences WHERE task_id = ` + page,
+			func(s rowScanner) error {
+				var id, rule string
+				err := s.Scan(&id, &rule)
+				if err == nil {
+					byID[id].Recurrence = &rule
+				}
+				return err
+			}},
+		// logged time, running timers included
+		{"time_spent_seconds", `
+			SELECT task_id, COALESCE(SUM(EXTRACT(EPOCH FROM (COALESCE(ended_at, NOW()) - started_at))), 0)::bigint
+			FROM time_entries WHERE task_id = ` + page + `
+			GROUP BY task_id`,
+			func(s rowScanner) error {
+				var id string
+				var secs int64
+				err := s.Scan(&id, &secs)
+				if err == nil {
+					byID[id].TimeSpent = secs
+				}
+				return err
+			}},
+		{"custom_fields", `
+			SELECT task_id, field_id, value FROM task_custom_values WHERE task_id = ` + page,
+			func(s rowScanner) error {
+				var id, fieldID string
+				var v []byte
+				err := s.Scan(&id, &fieldID, &v)
+				if err == nil {
+					byID[id].CustomFields[fieldID] = json.RawMessage(v)
+				}
+				return err
+			}},
+	}
+
+	idList := strings.Join(ids, ",")
+	for _, part := range parts {
+		if !want(part.key) {
+			continue
+		}
+		rows, err := db.Query(part.query, idList)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			if err := part.apply(rows); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // ---- Handler ----
 
 func boardsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	// 🔐 now requires auth (so we can scope by workspace membership)
-	sess, ok := getSessionFromRequest(r)
+	sess, ok := getSessionFromRequest(r, db)
 	if !ok {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
@@ -42,6 +271,11 @@ func boardsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 
 	qid := r.URL.Query().Get("id")
 	inc := r.URL.Query().Get("include")
+	group := r.URL.Query().Get("group")
+	if group != "" && group != "lanes" {
+		http.Error(w, "group must be lanes", http.StatusBadRequest)
+		return
+	}
 
 	var wantLists, wantTasks bool
 	switch inc {
@@ -54,15 +288,19 @@ func boardsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	}
 
 	// 1) board (scoped to user's workspace membership)
-	var boardID, boardName string
+	var boardID, boardName, workspaceID string
+	var enforceBlockers bool
+	var estimateUnit, wipMode, laneMode string
+	var laneFieldID sql.NullString
 	var err error
 	if qid != "" {
 		err = db.QueryRow(`
-            SELECT b.id, b.name
+            SELECT b.id, b.name, b.workspace_id, b.enforce_blockers, b.estimate_unit, b.wip_mode, b.lane_mode, b.lane_field_id
             FROM boards b
             JOIN workspace_members m ON m.workspace_id = b.workspace_id
-            WHERE m.user_id = $1 AND b.id = $2
-        `, sess.UserID, qid).Scan(&boardID, &boardName)
+            WHERE m.user_id = $1 AND b.id = $2 AND b.deleted_at IS NULL
+              AND m.workspace_id = COALESCE($3::uuid, m.workspace_id)
+        `, sess.UserID, qid, sess.workspaceScope()).Scan(&boardID, &boardName, &workspaceID, &enforceBlockers, &estimateUnit, &wipMode, &laneMode, &laneFieldID)
 		if err == sql.ErrNoRows {
 			http.Error(w, "board not found", http.StatusNotFound)
 			return
@@ -72,13 +310,15 @@ func boardsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		}
 	} else {
 		err = db.QueryRow(`
-            SELECT b.id, b.name
+            SELECT b.id, b.name, b.workspace_id, b.enforce_blockers, b.estimate_unit, b.wip_mode, b.lane_mode, b.lane_field_id
             FROM boards b
             JOIN workspace_members m ON m.workspace_id = b.workspace_id
             WHERE m.user_id = $1
+              AND m.workspace_id = COALESCE($2::uuid, m.workspace_id)
+              AND b.archived_at IS NULL AND b.deleted_at IS NULL
             ORDER BY b.created_at ASC
             LIMIT 1
-        `, sess.UserID).Scan(&boardID, &boardName)
+        `, sess.UserID, sess.workspaceScope()).Scan(&boardID, &boardName, &workspaceID, &enforceBlockers, &estimateUnit, &wipMode, &laneMode, &laneFieldID)
 		if err == sql.ErrNoRows {
 			http.Error(w, "no board found", http.StatusNotFound)
 			return
@@ -88,10 +328,22 @@ func boardsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		}
 	}
 
-	// 2) lists
+	// 1.1) custom field definitions; cf.<id>=... filters and sort=[-]cf.<id> apply to tasks
+	fields, err := loadBoardCustomFields(db, boardID)
+	if err != nil {
+		http.Error(w, "custom fields query failed", http.StatusInternalServerError)
+		return
+	}
+	cfWhere, cfOrder, cfArgs, err := customFieldQuery(fields, r.URL.Query(), 2)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 2) lists; archived and trashed lists and tasks stay out of the payload
 	lists := make([]ListDTO, 0)
 	if wantLists {
-		rows, err := db.Query(`SELECT id, name, position FROM lists WHERE board_id=$1 ORDER BY position ASC`, boardID)
+		rows, err := db.Query(`SELECT id, name, position, category, wip_limit FROM lists WHERE board_id=$1 AND archived_at IS NULL AND deleted_at IS NULL ORDER BY position ASC`, boardID)
 		if err != nil {
 			http.Error(w, "lists query failed", http.StatusInternalServerError)
 			return
@@ -100,50 +352,210 @@ func boardsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 
 		for rows.Next() {
 			var l ListDTO
-			if err := rows.Scan(&l.ID, &l.Name, &l.Position); err == nil {
+			var wip sql.NullInt64
+			if err := rows.Scan(&l.ID, &l.Name, &l.Position, &l.Category, &wip); err == nil {
+				if wip.Valid {
+					n := int(wip.Int64)
+					l.WIPLimit = &n
+				}
 				l.Tasks = make([]TaskDTO, 0) // non-nil slice
 				lists = append(lists, l)
 			}
 		}
+		rows.Close()
+
+		for i := range lists {
+			if err := db.QueryRow(
+				`SELECT COUNT(*), COALESCE(SUM(estimate), 0) FROM tasks WHERE list_id=$1 AND archived_at IS NULL AND deleted_at IS NULL`, lists[i].ID,
+			).Scan(&lists[i].Totals.Tasks, &lists[i].Totals.Estimate); err != nil {
+				http.Error(w, "list totals query failed", http.StatusInternalServerError)
+				return
+			}
+			lists[i].OverWIP = lists[i].WIPLimit != nil && lists[i].Totals.Tasks > *lists[i].WIPLimit
+		}
 	}
 
 	// 3) tasks per list
 	if wantTasks {
 		for i := range lists {
-			trows, err := db.Query(`SELECT id, title, description, position FROM tasks WHERE list_id=$1 ORDER BY position ASC`, lists[i].ID)
+			trows, err := db.Query(`
+				SELECT `+taskDTOCols+`
+				FROM tasks t
+				WHERE t.list_id=$1 AND t.archived_at IS NULL AND t.deleted_at IS NULL`+cfWhere+`
+				ORDER BY `+cfOrder+`t.position ASC
+			`, append([]any{lists[i].ID}, cfArgs...)...)
 			if err != nil {
 				http.Error(w, "tasks query failed", http.StatusInternalServerError)
 				return
 			}
 			tasks := make([]TaskDTO, 0)
 			for trows.Next() {
-				var t TaskDTO
-				if err := trows.Scan(&t.ID, &t.Title, &t.Description, &t.Position); err == nil {
-					// assignees
-					arows, _ := db.Query(`SELECT user_id FROM task_assignees WHERE task_id=$1`, t.ID)
-					aids := make([]string, 0)
-					for arows.Next() {
-						var uid string
-						if err := arows.Scan(&uid); err == nil {
-							aids = append(aids, uid)
-						}
-					}
-					arows.Close()
-					t.Assignees = aids
-
-					// comment count
-					_ = db.QueryRow(`SELECT COUNT(*) FROM comments WHERE task_id=$1`, t.ID).Scan(&t.CommentCount)
-
+				if t, err := scanTaskDTO(trows); err == nil {
 					tasks = append(tasks, t)
 				}
 			}
 			trows.Close()
 			lists[i].Tasks = tasks
 		}
+
+		all := make([]*TaskDTO, 0)
+		for i := range lists {
+			for j := range lists[i].Tasks {
+				all = append(all, &lists[i].Tasks[j])
+			}
+		}
+		if err := fillTaskExtras(db, all, nil); err != nil {
+			http.Error(w, "task details query failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	payload := BoardDTO{ID: boardID, Name: boardName, WorkspaceID: workspaceID, EnforceBlockers: enforceBlockers, EstimateUnit: estimateUnit, WIPMode: wipMode, LaneMode: laneMode, CustomFields: fields, Lists: lists}
+	if laneFieldID.Valid {
+		payload.LaneFieldID = &laneFieldID.String
 	}
 
-	// 4) respond
-	payload := BoardDTO{ID: boardID, Name: boardName, Lists: lists}
+	// 4) swimlanes: regroup each list's tasks
+	if group == "lanes" && wantTasks && laneMode != "none" {
+		lanes, err := boardLanes(db, boardID, workspaceID, laneMode, payload.LaneFieldID, fields)
+		if err != nil {
+			http.Error(w, "lanes query failed", http.StatusInternalServerError)
+			return
+		}
+		if len(lanes) > 0 {
+			payload.Lanes = lanes
+			for i := range lists {
+				lists[i].Lanes = groupByLane(lists[i].Tasks, lanes, laneMode, payload.LaneFieldID)
+				lists[i].Tasks = make([]TaskDTO, 0)
+			}
+		}
+	}
+
+	// 5) respond
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(payload)
 }
+
+// ---- PATCH /api/boards?id=... ----
+// Body: { "name"?: "...", "enforce_blockers"?: bool, "estimate_unit"?: "points"|"hours", "wip_mode"?: "flag"|"reject",
+//         "lane_mode"?: "none"|"manual"|"assignee"|"field", "lane_field_id"?: "..."|null }
+
+type updateBoardReq struct {
+	Name            *string         `json:"name,omitempty"`
+	EnforceBlockers *bool           `json:"enforce_blockers,omitempty"`
+	EstimateUnit    *string         `json:"estimate_unit,omitempty"`
+	WIPMode         *string         `json:"wip_mode,omitempty"`
+	LaneMode        *string         `json:"lane_mode,omitempty"`
+	LaneFieldID     json.RawMessage `json:"lane_field_id,omitempty"`
+}
+
+func updateBoardHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	var req updateBoardReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	sets := []string{}
+	args := []any{}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			http.Error(w, "name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		sets = append(sets, "name=$"+strconv.Itoa(len(args)+1))
+		args = append(args, name)
+	}
+	if req.EnforceBlockers != nil {
+		sets = append(sets, "enforce_blockers=$"+strconv.Itoa(len(args)+1))
+		args = append(args, *req.EnforceBlockers)
+	}
+	if req.EstimateUnit != nil {
+		if *req.EstimateUnit != "points" && *req.EstimateUnit != "hours" {
+			http.Error(w, "estimate_unit must be points or hours", http.StatusBadRequest)
+			return
+		}
+		sets = append(sets, "estimate_unit=$"+strconv.Itoa(len(args)+1))
+		args = append(args, *req.EstimateUnit)
+	}
+	if req.WIPMode != nil {
+		if *req.WIPMode != "flag" && *req.WIPMode != "reject" {
+			http.Error(w, "wip_mode must be flag or reject", http.StatusBadRequest)
+			return
+		}
+		sets = append(sets, "wip_mode=$"+strconv.Itoa(len(args)+1))
+		args = append(args, *req.WIPMode)
+	}
+	if req.LaneMode != nil {
+		if !laneModes[*req.LaneMode] {
+			http.Error(w, "lane_mode must be none, manual, assignee or field", http.StatusBadRequest)
+			return
+		}
+		sets = append(sets, "lane_mode=$"+strconv.Itoa(len(args)+1))
+		args = append(args, *req.LaneMode)
+	}
+	var laneFieldID *string
+	if len(req.LaneFieldID) > 0 {
+		if err := json.Unmarshal(req.LaneFieldID, &laneFieldID); err != nil {
+			http.Error(w, "lane_field_id must be a field id or null", http.StatusBadRequest)
+			return
+		}
+		sets = append(sets, "lane_field_id=$"+strconv.Itoa(len(args)+1))
+		args = append(args, laneFieldID)
+	}
+	if len(sets) == 0 {
+		http.Error(w, "nothing to update", http.StatusBadRequest)
+		return
+	}
+	if !canAccessBoard(db, sess, id) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+	if laneFieldID != nil {
+		var typ string
+		err := db.QueryRow(`SELECT type FROM board_custom_fields WHERE id=$1 AND board_id=$2`, *laneFieldID, id).Scan(&typ)
+		if err != nil {
+			http.Error(w, "lane_field_id is not a field on this board", http.StatusBadRequest)
+			return
+		}
+		if !laneFieldTypes[typ] {
+			http.Error(w, "lanes can group by select, user or checkbox fields", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.LaneMode != nil && *req.LaneMode == "field" {
+		hasField := laneFieldID != nil
+		if len(req.LaneFieldID) == 0 {
+			var current sql.NullString
+			_ = db.QueryRow(`SELECT lane_field_id FROM boards WHERE id=$1`, id).Scan(&current)
+			hasField = current.Valid
+		}
+		if !hasField {
+			http.Error(w, "lane_mode field needs a lane_field_id", http.StatusBadRequest)
+			return
+		}
+	}
+
+	args = append(args, id)
+	out := BoardDTO{CustomFields: make([]CustomFieldDTO, 0), Lists: make([]ListDTO, 0)}
+	if err := db.QueryRow(`
+		UPDATE boards SET `+strings.Join(sets, ", ")+`
+		WHERE id=$`+strconv.Itoa(len(args))+`
+		RETURNING id, name, workspace_id, enforce_blockers, estimate_unit, wip_mode, lane_mode, lane_field_id
+	`, args...).Scan(&out.ID, &out.Name, &out.WorkspaceID, &out.EnforceBlockers, &out.EstimateUnit, &out.WIPMode, &out.LaneMode, &out.LaneFieldID); err != nil {
+		http.Error(w, "update failed", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,302 @@
+// handlers_boardcopy.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ---- POST /api/boards/copy ----
+// { board_id, workspace_id?, name?, include? }
+// Deep-copies the live part of a board (archived and trashed lists and tasks
+// stay behind): settings, custom fields, swimlanes, lists in order, tasks
+// with their positions, checklists, custom values, subtask and task links
+// within the board. include may add "comments" and "assignees".
+// workspace_id defaults to the source board's; people outside the target
+// workspace are left off assignees and "user" custom values. Recurrence
+// rules and time entries are not copied.
+
+var boardCopyParts = map[string]bool{"comments": true, "assignees": true}
+
+type copyBoardReq struct {
+	BoardID     string   `json:"board_id"`
+	WorkspaceID string   `json:"workspace_id"`
+	Name        string   `json:"name"`
+	Include     []string `json:"include"`
+}
+
+type copyBoardResp struct {
+	ID          string `json:"id"`
+	WorkspaceID string `json:"workspace_id"`
+	Name        string `json:"name"`
+	Lists       int    `json:"lists"`
+	Tasks       int    `json:"tasks"`
+}
+
+func copyBoardHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	var req copyBoardReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.BoardID == "" {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	include := make(map[string]bool)
+	for _, p := range req.Include {
+		if !boardCopyParts[p] {
+			http.Error(w, "include may contain comments, assignees", http.StatusBadRequest)
+			return
+		}
+		include[p] = true
+	}
+	if !canAccessBoard(db, sess, req.BoardID) {
+		http.Error(w, "board not found or forbidden", http.StatusNotFound)
+		return
+	}
+	var srcName, srcWS string
+	if err := db.QueryRow(`SELECT name, workspace_id FROM boards WHERE id=$1`, req.BoardID).Scan(&srcName, &srcWS); err != nil {
+		http.Error(w, "lookup failed", http.StatusInternalServerError)
+		return
+	}
+	if req.WorkspaceID == "" {
+		req.WorkspaceID = srcWS
+	}
+	if !canAccessWorkspace(db, sess, req.WorkspaceID) {
+		http.Error(w, "workspace not found or forbidden", http.StatusNotFound)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		req.Name = srcName + " (copy)"
+	}
+
+	// single transaction, as provisionPersonalWorkspace does
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	out := copyBoardResp{WorkspaceID: req.WorkspaceID, Name: req.Name}
+	if err := tx.QueryRow(`
+		INSERT INTO boards (name, owner_id, workspace_id, enforce_blockers, estimate_unit, wip_mode, lane_mode, weekend_days)
+		SELECT $2, $3, $4, enforce_blockers, estimate_unit, wip_mode, lane_mode, weekend_days FROM boards WHERE id=$1
+		RETURNING id
+	`, req.BoardID, req.Name, sess.UserID, req.WorkspaceID).Scan(&out.ID); err != nil {
+		http.Error(w, "board copy failed", http.StatusBadRequest)
+		return
+	}
+
+	// One statement maps every old id to a fresh one in the src CTEs and
+	// inserts from those; foreign keys are checked at the end of the statement.
+	// $1 source board, $2 new board, $3 target workspace, $4 comments, $5 assignees, $6 caller
+	if err := tx.QueryRow(`
+		WITH members AS (
+		  SELECT user_id FROM workspace_members WHERE workspace_id = $3
+		), l_src AS (
+		  SELECT id, name, category, wip_limit, uuid_generate_v4() AS new_id,
+		         ROW_NUMBER() OVER (ORDER BY position ASC, created_at ASC) - 1 AS pos
+		  FROM lists WHERE board_id = $1 AND archived_at IS NULL AND deleted_at IS NULL
+		), t_src AS (
+		  SELECT t.*, l_src.new_id AS new_list_id, uuid_generate_v4() AS new_id,
+		         ROW_NUMBER() OVER (PARTITION BY t.list_id ORDER BY t.position ASC, t.created_at ASC) - 1 AS pos
+		  FROM tasks t JOIN l_src ON l_src.id = t.list_id
+		  WHERE t.archived_at IS NULL AND t.deleted_at IS NULL
+		), f_src AS (
+		  SELECT f.*, uuid_generate_v4() AS new_id FROM board_custom_fields f WHERE f.board_id = $1
+		), lane_src AS (
+		  SELECT id, name, position, uuid_generate_v4() AS new_id FROM board_lanes WHERE board_id = $1
+		), c_src AS (
+		  SELECT c.id, c.title, c.position, t_src.new_id AS new_task_id, uuid_generate_v4() AS new_id
+		  FROM checklists c JOIN t_src ON t_src.id = c.task_id
+		), ins_lists AS (
+		  INSERT INTO lists (id, board_id, name, position, category, wip_limit)
+		  SELECT new_id, $2::uuid, name, pos, category, wip_limit FROM l_src
+		), ins_fields AS (
+		  INSERT INTO board_custom_fields (id, board_id, name, type, options, position)
+		  SELECT new_id, $2::uuid, name, type, options, position FROM f_src
+		), ins_lanes AS (
+		  INSERT INTO board_lanes (id, board_id, name, position)
+		  SELECT new_id, $2::uuid, name, position FROM lane_src
+		), upd_board AS (
+		  UPDATE boards SET lane_field_id = (
+		    SELECT f.new_id FROM f_src f JOIN boards b ON b.lane_field_id = f.id WHERE b.id = $1
+		  )
+		  WHERE id = $2
+		), ins_tasks AS (
+		  INSERT INTO tasks (id, list_id, title, description, position, created_by, priority, estimate, due_date, start_date, parent_task_id, lane_id)
+		  SELECT t.new_id, t.new_list_id, t.title, t.description, t.pos, t.created_by, t.priority, t.estimate, t.due_date, t.start_date, p.new_id, lane.new_id
+		  FROM t_src t
+		  LEFT JOIN t_src p ON p.id = t.parent_task_id
+		  LEFT JOIN lane_src lane ON lane.id = t.lane_id
+		), ins_values AS (
+		  INSERT INTO task_custom_values (task_id, field_id, value)
+		  SELECT t.new_id, f.new_id, v.value
+		  FROM task_custom_values v
+		  JOIN t_src t ON t.id = v.task_id
+		  JOIN f_src f ON f.id = v.field_id
+		  WHERE CASE WHEN f.type = 'user' THEN v.value #>> '{}' IN (SELECT user_id::text FROM members) ELSE TRUE END
+		), ins_checklists AS (
+		  INSERT INTO checklists (id, task_id, title, position)
+		  SELECT new_id, new_task_id, title, position FROM c_src
+		), ins_items AS (
+		  INSERT INTO checklist_items (checklist_id, body, position, done, done_at, due_date, assignee_id)
+		  SELECT c.new_id, i.body, i.position, i.done, i.done_at, i.due_date,
+		         CASE WHEN i.assignee_id IN (SELECT user_id FROM members) THEN i.assignee_id END
+		  FROM checklist_items i JOIN c_src c ON c.id = i.checklist_id
+		), ins_links AS (
+		  INSERT INTO task_links (from_task_id, to_task_id, type, created_by)
+		  SELECT a.new_id, b.new_id, k.type, k.created_by
+		  FROM task_links k
+		  JOIN t_src a ON a.id = k.from_task_id
+		  JOIN t_src b ON b.id = k.to_task_id
+		), ins_assignees AS (
+		  INSERT INTO task_assignees (task_id, user_id)
+		  SELECT t.new_id, a.user_id
+		  FROM task_assignees a JOIN t_src t ON t.id = a.task_id
+		  WHERE $5 AND a.user_id IN (SELECT user_id FROM members)
+		), ins_holidays AS (
+		  INSERT INTO board_holidays (board_id, day, name)
+		  SELECT $2::uuid, day, name FROM board_holidays WHERE board_id = $1
+		), ins_transitions AS (
+		  INSERT INTO task_transitions (task_id, board_id, to_list_id, to_category, moved_by)
+		  SELECT t.new_id, $2::uuid, t.new_list_id, l.category, $6::uuid
+		  FROM t_src t JOIN l_src l ON l.id = t.list_id
+		), ins_comments AS (
+		  INSERT INTO comments (task_id, author_id, body, created_at)
+		  SELECT t.new_id, c.author_id, c.body, c.created_at
+		  FROM comments c JOIN t_src t ON t.id = c.task_id
+		  WHERE $4
+		)
+		SELECT (SELECT COUNT(*) FROM l_src), (SELECT COUNT(*) FROM t_src)
+	`, req.BoardID, out.ID, req.WorkspaceID, include["comments"], include["assignees"], sess.UserID).Scan(&out.Lists, &out.Tasks); err != nil {
+		http.Error(w, "board copy failed", http.StatusBadRequest)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// ---- POST /api/boards/transfer ----
+// { board_id, workspace_id }
+// Moves a board, everything on it included, to another workspace. The caller
+// must be an owner or admin of the current workspace and a member of the
+// target one. Each task is then rehomed like a cross-board move, so people
+// outside the target workspace lose their assignments and links to tasks
+// left behind are cut; the response lists what was dropped.
+
+type transferBoardReq struct {
+	BoardID     string `json:"board_id"`
+	WorkspaceID string `json:"workspace_id"`
+}
+
+type transferBoardResp struct {
+	ID          string      `json:"id"`
+	WorkspaceID string      `json:"workspace_id"`
+	Dropped     *DroppedDTO `json:"dropped,omitempty"`
+}
+
+func transferBoardHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	var req transferBoardReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.BoardID == "" || req.WorkspaceID == "" {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if !canAccessBoard(db, sess, req.BoardID) || !canAccessWorkspace(db, sess, req.WorkspaceID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var srcWS, role string
+	if err := tx.QueryRow(`
+		SELECT b.workspace_id, m.role
+		FROM boards b JOIN workspace_members m ON m.workspace_id = b.workspace_id AND m.user_id = $2
+		WHERE b.id = $1
+		FOR UPDATE OF b
+	`, req.BoardID, sess.UserID).Scan(&srcWS, &role); err != nil {
+		http.Error(w, "lookup failed", http.StatusInternalServerError)
+		return
+	}
+	if role != "owner" && role != "admin" {
+		http.Error(w, "only workspace owners and admins can transfer boards", http.StatusForbidden)
+		return
+	}
+	out := transferBoardResp{ID: req.BoardID, WorkspaceID: req.WorkspaceID}
+	if srcWS == req.WorkspaceID {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	if _, err := tx.Exec(`UPDATE boards SET workspace_id=$2 WHERE id=$1`, req.BoardID, req.WorkspaceID); err != nil {
+		http.Error(w, "transfer failed", http.StatusBadRequest)
+		return
+	}
+
+	// trashed and archived tasks move too, so they are fixed up as well
+	rows, err := tx.Query(`
+		SELECT t.id FROM tasks t JOIN lists l ON l.id = t.list_id WHERE l.board_id = $1
+	`, req.BoardID)
+	if err != nil {
+		http.Error(w, "tasks query failed", http.StatusInternalServerError)
+		return
+	}
+	taskIDs := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			taskIDs = append(taskIDs, id)
+		}
+	}
+	rows.Close()
+
+	dropped := &DroppedDTO{}
+	for _, id := range taskIDs {
+		d, err := rehomeTask(tx, id)
+		if err != nil {
+			http.Error(w, "transfer failed", http.StatusBadRequest)
+			return
+		}
+		dropped.add(d)
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+	if !dropped.empty() {
+		out.Dropped = dropped
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,322 @@
+// handlers_bulk.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// ---- POST /api/tasks/bulk ----
+// { task_ids: [...], op, ...op params }
+//
+//	move          { list_id }                 → appended to the list in task_ids order
+//	assign        { user_id }                 → add an assignee
+//	unassign      { user_id }                 → remove an assignee
+//	label         { field_id, value }         → set a custom field value (null clears)
+//	set_due_date  { due_date }                → YYYY-MM-DD, "" clears
+//	archive                                   → same as POST /api/archive
+//	delete                                    → move to the trash
+//
+// Either every task is updated or none is: each item runs under a savepoint
+// so one failure doesn't hide the others, and if any failed the whole
+// transaction is rolled back and the response (422) says which and why.
+
+const maxBulkTasks = 200
+
+type bulkTaskReq struct {
+	TaskIDs []string        `json:"task_ids"`
+	Op      string          `json:"op"`
+	ListID  string          `json:"list_id"`
+	UserID  string          `json:"user_id"`
+	FieldID string          `json:"field_id"`
+	Value   json.RawMessage `json:"value"`
+	DueDate *string         `json:"due_date"`
+}
+
+type BulkItemResult struct {
+	ID      string      `json:"id"`
+	OK      bool        `json:"ok"`
+	Error   string      `json:"error,omitempty"`
+	Dropped *DroppedDTO `json:"dropped,omitempty"`
+}
+
+type bulkTaskResp struct {
+	Op      string           `json:"op"`
+	Applied bool             `json:"applied"`
+	Results []BulkItemResult `json:"results"`
+}
+
+// bulkTarget is what a move needs to know about the destination list.
+type bulkTarget struct {
+	boardID         string
+	done            bool
+	enforceBlockers bool
+}
+
+func bulkTasksHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	var req bulkTaskReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	ids := make([]string, 0, len(req.TaskIDs))
+	seen := make(map[string]bool)
+	for _, id := range req.TaskIDs {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		http.Error(w, "task_ids is empty", http.StatusBadRequest)
+		return
+	}
+	if len(ids) > maxBulkTasks {
+		http.Error(w, "too many tasks (max 200)", http.StatusBadRequest)
+		return
+	}
+
+	// validate the op's own parameters before touching anything
+	var target bulkTarget
+	var due any
+	switch req.Op {
+	case "move":
+		if req.ListID == "" || !canAccessList(db, sess, req.ListID) {
+			http.Error(w, "list not found or forbidden", http.StatusNotFound)
+			return
+		}
+		if !listIsLive(db, req.ListID) {
+			http.Error(w, "list is archived or in the trash", http.StatusConflict)
+			return
+		}
+		if err := db.QueryRow(`
+			SELECT b.id, l.category = 'done', b.enforce_blockers
+			FROM lists l JOIN boards b ON b.id = l.board_id
+			WHERE l.id = $1
+		`, req.ListID).Scan(&target.boardID, &target.done, &target.enforceBlockers); err != nil {
+			http.Error(w, "lookup failed", http.StatusInternalServerError)
+			return
+		}
+	case "assign", "unassign":
+		if req.UserID == "" {
+			http.Error(w, "missing user_id", http.StatusBadRequest)
+			return
+		}
+	case "label":
+		if req.FieldID == "" {
+			http.Error(w, "missing field_id", http.StatusBadRequest)
+			return
+		}
+	case "set_due_date":
+		if req.DueDate == nil {
+			http.Error(w, "missing due_date", http.StatusBadRequest)
+			return
+		}
+		d, ok := parseDate(*req.DueDate)
+		if !ok {
+			http.Error(w, "due_date must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		due = d
+	case "archive", "delete":
+	default:
+		http.Error(w, "op must be move, assign, unassign, label, set_due_date, archive or delete", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	out := bulkTaskResp{Op: req.Op, Applied: true, Results: make([]BulkItemResult, 0, len(ids))}
+	completed := make([]string, 0)
+	for _, id := range ids {
+		res := BulkItemResult{ID: id}
+		// the savepoint goes first: a malformed id fails the access check's
+		// uuid cast, which would otherwise abort the whole transaction
+		if _, err := tx.Exec(`SAVEPOINT bulk_item`); err != nil {
+			http.Error(w, "savepoint failed", http.StatusInternalServerError)
+			return
+		}
+		if !canAccessTask(tx, sess, id) {
+			if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT bulk_item`); err != nil {
+				http.Error(w, "rollback failed", http.StatusInternalServerError)
+				return
+			}
+			res.Error = "not found or forbidden"
+			out.Results = append(out.Results, res)
+			out.Applied = false
+			continue
+		}
+
+		var problem string
+		switch req.Op {
+		case "move":
+			var completing bool
+			problem, completing, res.Dropped, err = bulkMoveTask(tx, id, req.ListID, sess.UserID, target)
+			if completing {
+				completed = append(completed, id)
+			}
+		case "assign":
+			problem, err = bulkAssign(tx, id, req.UserID)
+		case "unassign":
+			_, err = tx.Exec(`DELETE FROM task_assignees WHERE task_id=$1 AND user_id=$2`, id, req.UserID)
+		case "label":
+			problem, err = bulkLabel(tx, id, req.FieldID, req.Value)
+		case "set_due_date":
+			_, err = tx.Exec(`UPDATE tasks SET due_date=$2, updated_at=NOW() WHERE id=$1`, id, due)
+			if isCheckViolation(err) {
+				problem, err = "start_date is after due_date", nil
+			}
+		case "archive", "delete":
+			err = hideTask(tx, id, req.Op == "delete", sess.UserID)
+		}
+		if err != nil {
+			log.Printf("[bulkTasksHandler] %s %s: %v", req.Op, id, err)
+			problem = "update failed"
+		}
+
+		if problem != "" {
+			if _, err := tx.Exec(`ROLLBACK TO SAVEPOINT bulk_item`); err != nil {
+				http.Error(w, "rollback failed", http.StatusInternalServerError)
+				return
+			}
+			res.Error = problem
+			out.Applied = false
+		} else {
+			res.OK = true
+		}
+		out.Results = append(out.Results, res)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !out.Applied {
+		// nothing is kept; the deferred rollback undoes the items that did work
+		for i := range out.Results {
+			out.Results[i].OK = false
+			out.Results[i].Dropped = nil
+		}
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_ = json.NewEncoder(w).Encode(out)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+
+	for _, id := range completed {
+		if _, err := advanceRecurrence(db, id); err != nil {
+			log.Println("recurrence:", err)
+		}
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// bulkMoveTask appends one task to the target list with the same rules as
+// /api/tasks/reorder: live tasks only, open blockers keep a task out of a
+// done list when the board enforces it, a rejecting WIP limit is respected,
+// and board-scoped data is rehomed.
+func bulkMoveTask(tx *sql.Tx, taskID, toListID, userID string, target bulkTarget) (problem string, completing bool, dropped *DroppedDTO, err error) {
+	var srcListID, srcBoardID string
+	var pos int
+	var live bool
+	if err = tx.QueryRow(`
+		SELECT t.list_id, l.board_id, t.position, t.archived_at IS NULL AND t.deleted_at IS NULL
+		FROM tasks t JOIN lists l ON l.id = t.list_id
+		WHERE t.id = $1
+		FOR UPDATE OF t
+	`, taskID).Scan(&srcListID, &srcBoardID, &pos, &live); err != nil {
+		return
+	}
+	if !live {
+		return "task is archived or in the trash", false, nil, nil
+	}
+	if srcListID == toListID {
+		return "", false, nil, nil
+	}
+	completing = target.done
+	if completing && target.enforceBlockers && taskBlocked(tx, taskID) {
+		return "task has open blockers", false, nil, nil
+	}
+	if over, reject := wipExceeded(tx, toListID); over && reject {
+		return "list is at its WIP limit", false, nil, nil
+	}
+
+	if _, err = tx.Exec(`
+		UPDATE tasks SET position = position - 1
+		WHERE list_id = $1 AND position > $2 AND archived_at IS NULL AND deleted_at IS NULL
+	`, srcListID, pos); err != nil {
+		return
+	}
+	if _, err = tx.Exec(`
+		UPDATE tasks SET list_id=$2, position=$3, updated_at=NOW() WHERE id=$1
+	`, taskID, toListID, nextTaskPosition(tx, toListID)); err != nil {
+		return
+	}
+	if err = recordTransition(tx, taskID, srcListID, toListID, userID); err != nil {
+		return
+	}
+	if srcBoardID != target.boardID {
+		if dropped, err = rehomeTask(tx, taskID); err != nil {
+			return
+		}
+		if dropped.empty() {
+			dropped = nil
+		}
+	}
+	return "", completing, dropped, nil
+}
+
+func bulkAssign(tx *sql.Tx, taskID, userID string) (string, error) {
+	if !isTaskWorkspaceMember(tx, taskID, userID) {
+		return "user is not a member of this task's workspace", nil
+	}
+	_, err := tx.Exec(`
+		INSERT INTO task_assignees (task_id, user_id) VALUES ($1,$2)
+		ON CONFLICT DO NOTHING
+	`, taskID, userID)
+	return "", err
+}
+
+// bulkLabel sets one custom field value; the field must be on the task's board.
+func bulkLabel(tx *sql.Tx, taskID, fieldID string, raw json.RawMessage) (string, error) {
+	f, err := scanCustomField(tx.QueryRow(`
+		SELECT f.id, f.board_id, f.name, f.type, f.options, f.position
+		FROM board_custom_fields f
+		JOIN lists l ON l.board_id = f.board_id
+		JOIN tasks t ON t.list_id = l.id
+		WHERE f.id = $1 AND t.id = $2
+	`, fieldID, taskID))
+	if err == sql.ErrNoRows {
+		return "field is not on this task's board", nil
+	} else if err != nil {
+		return "", err
+	}
+	v, err := validateCustomValue(tx, f, taskID, raw)
+	if err != nil {
+		return err.Error(), nil
+	}
+	if v == nil {
+		_, err = tx.Exec(`DELETE FROM task_custom_values WHERE task_id=$1 AND field_id=$2`, taskID, f.ID)
+		return "", err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO task_custom_values (task_id, field_id, value) VALUES ($1,$2,$3::jsonb)
+		ON CONFLICT (task_id, field_id) DO UPDATE SET value = EXCLUDED.value, updated_at = NOW()
+	`, taskID, f.ID, string(v))
+	return "", err
+}
@@ -0,0 +1,349 @@
+// handlers_calendar.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---- /api/calendar ----
+// GET /api/calendar?from=YYYY-MM-DD&to=YYYY-MM-DD[&board_id=][&mine=1]
+//   → live tasks with a start or due date in [from, to], across the caller's boards
+//
+// ---- /api/calendar/feed ----
+// GET    → { prefix, created_at, last_used_at } or 404 when there's no feed
+// POST   → create or rotate the feed; the URL (with its secret) is returned once
+// DELETE → revoke the feed
+//
+// ---- GET /api/calendar/ics/<token>.ics ----
+// RFC 5545 feed for calendar apps. The token in the path is the only
+// credential, so rotating it is how a leaked URL is shut off.
+
+const (
+	calendarFeedPrefix        = "tmcal_"
+	calendarFeedDisplayPrefix = 12
+	calendarFeedMaxEvents     = 2000
+)
+
+// PUBLIC_URL is the externally reachable origin used in feed URLs; without it
+// the request's own host is used.
+var publicURL = strings.TrimRight(envOr("PUBLIC_URL", ""), "/")
+
+type CalendarTaskDTO struct {
+	ID        string   `json:"id"`
+	Title     string   `json:"title"`
+	BoardID   string   `json:"board_id"`
+	BoardName string   `json:"board_name"`
+	ListID    string   `json:"list_id"`
+	ListName  string   `json:"list_name"`
+	Priority  string   `json:"priority"`
+	StartDate *string  `json:"start_date"`
+	DueDate   *string  `json:"due_date"`
+	Done      bool     `json:"done"`
+	Assignees []string `json:"assignees"`
+}
+
+// calendarTasks returns live tasks on live boards in userID's workspaces
+// whose [start_date, due_date] span touches [from, to]. A task with only one
+// of the two dates is treated as a single day.
+func calendarTasks(q *sql.DB, userID string, scope any, from, to, boardID string, mine bool) ([]CalendarTaskDTO, error) {
+	args := []any{userID, scope, from, to}
+	extra := ""
+	if boardID != "" {
+		args = append(args, boardID)
+		extra += " AND b.id = $" + strconv.Itoa(len(args))
+	}
+	if mine {
+		extra += " AND EXISTS (SELECT 1 FROM task_assignees a WHERE a.task_id = t.id AND a.user_id = $1)"
+	}
+	rows, err := q.Query(`
+		SELECT t.id, t.title, b.id, b.name, l.id, l.name, t.priority, t.start_date, t.due_date, l.category = 'done',
+		       COALESCE((SELECT array_to_string(array_agg(a.user_id::text ORDER BY a.assigned_at), ',')
+		                 FROM task_assignees a WHERE a.task_id = t.id), '')
+		FROM tasks t
+		JOIN lists l ON l.id = t.list_id
+		JOIN boards b ON b.id = l.board_id
+		JOIN workspace_members m ON m.workspace_id = b.workspace_id AND m.user_id = $1
+		WHERE m.workspace_id = COALESCE($2::uuid, m.workspace_id)
+		  AND t.archived_at IS NULL AND t.deleted_at IS NULL
+		  AND l.archived_at IS NULL AND l.deleted_at IS NULL
+		  AND b.archived_at IS NULL AND b.deleted_at IS NULL
+		  AND COALESCE(t.start_date, t.due_date) <= $4::date
+		  AND COALESCE(t.due_date, t.start_date) >= $3::date`+extra+`
+		ORDER BY COALESCE(t.start_date, t.due_date), t.due_date NULLS LAST, b.name, l.position, t.position
+		LIMIT `+strconv.Itoa(calendarFeedMaxEvents), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]CalendarTaskDTO, 0)
+	for rows.Next() {
+		var t CalendarTaskDTO
+		var start, due sql.NullTime
+		var assignees string
+		if err := rows.Scan(&t.ID, &t.Title, &t.BoardID, &t.BoardName, &t.ListID, &t.ListName, &t.Priority, &start, &due, &t.Done, &assignees); err != nil {
+			return nil, err
+		}
+		if start.Valid {
+			d := start.Time.Format(dateLayout)
+			t.StartDate = &d
+		}
+		if due.Valid {
+			d := due.Time.Format(dateLayout)
+			t.DueDate = &d
+		}
+		t.Assignees = make([]string, 0)
+		if assignees != "" {
+			t.Assignees = strings.Split(assignees, ",")
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func calendarHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := getSessionFromRequest(r, db)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	q := r.URL.Query()
+	from, to := q.Get("from"), q.Get("to")
+	fromD, err1 := time.Parse(dateLayout, from)
+	toD, err2 := time.Parse(dateLayout, to)
+	if err1 != nil || err2 != nil || toD.Before(fromD) || toD.Sub(fromD) > 366*24*time.Hour {
+		http.Error(w, "from/to must be YYYY-MM-DD, in order, at most a year apart", http.StatusBadRequest)
+		return
+	}
+	boardID := q.Get("board_id")
+	if boardID != "" && !canAccessBoard(db, sess, boardID) {
+		http.Error(w, "board not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	tasks, err := calendarTasks(db, sess.UserID, sess.workspaceScope(), from, to, boardID, q.Get("mine") == "1")
+	if err != nil {
+		log.Println("calendar:", err)
+		http.Error(w, "calendar query failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"from": from, "to": to, "tasks": tasks})
+}
+
+// ---- feed management ----
+
+type calendarFeedDTO struct {
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	URL        string     `json:"url,omitempty"` // only when just created
+}
+
+// Managing the feed needs a cookie session, like /api/tokens.
+func calendarFeedHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	switch r.Method {
+	case http.MethodGet:
+		sess, ok := getSessionFromRequest(r, db)
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if sess.TokenID != "" {
+			http.Error(w, "not allowed with an API token", http.StatusForbidden)
+			return
+		}
+		var out calendarFeedDTO
+		err := db.QueryRow(`
+			SELECT token_prefix, created_at, last_used_at FROM calendar_feeds WHERE user_id=$1
+		`, sess.UserID).Scan(&out.Prefix, &out.CreatedAt, &out.LastUsedAt)
+		if err == sql.ErrNoRows {
+			http.Error(w, "no calendar feed", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "lookup failed", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+
+	case http.MethodPost:
+		sess, ok := requireBrowserSession(w, r, db)
+		if !ok {
+			return
+		}
+		raw := calendarFeedPrefix + randToken(32)
+		out := calendarFeedDTO{Prefix: raw[:calendarFeedDisplayPrefix]}
+		// upsert: the old token's hash is overwritten, so the old URL dies here
+		if err := db.QueryRow(`
+			INSERT INTO calendar_feeds (user_id, token_hash, token_prefix) VALUES ($1,$2,$3)
+			ON CONFLICT (user_id) DO UPDATE
+			  SET token_hash = EXCLUDED.token_hash, token_prefix = EXCLUDED.token_prefix,
+			      created_at = NOW(), last_used_at = NULL
+			RETURNING created_at
+		`, sess.UserID, hashAPIToken(raw), out.Prefix).Scan(&out.CreatedAt); err != nil {
+			http.Error(w, "feed create failed", http.StatusInternalServerError)
+			return
+		}
+		out.URL = feedBaseURL(r) + "/api/calendar/ics/" + raw + ".ics"
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(out)
+
+	case http.MethodDelete:
+		sess, ok := requireBrowserSession(w, r, db)
+		if !ok {
+			return
+		}
+		if _, err := db.Exec(`DELETE FROM calendar_feeds WHERE user_id=$1`, sess.UserID); err != nil {
+			http.Error(w, "revoke failed", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func feedBaseURL(r *http.Request) string {
+	if publicURL != "" {
+		return publicURL
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// ---- the .ics feed ----
+
+// Feeds cover a window around today rather than all history, which keeps
+// them small enough for clients that poll every few minutes.
+const (
+	calendarFeedPastDays   = 90
+	calendarFeedFutureDays = 366
+)
+
+func calendarICSHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	raw := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/calendar/ics/"), ".ics")
+	if !strings.HasPrefix(raw, calendarFeedPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+	var userID, displayName string
+	if err := db.QueryRow(`
+		SELECT f.user_id, COALESCE(NULLIF(u.name, ''), u.email)
+		FROM calendar_feeds f JOIN users u ON u.id = f.user_id
+		WHERE f.token_hash = $1
+	`, hashAPIToken(raw)).Scan(&userID, &displayName); err != nil {
+		// same answer for unknown and revoked tokens
+		http.NotFound(w, r)
+		return
+	}
+	_, _ = db.Exec(`
+		UPDATE calendar_feeds SET last_used_at=NOW()
+		WHERE user_id=$1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`, userID)
+
+	today := time.Now().UTC()
+	tasks, err := calendarTasks(db, userID, nil,
+		today.AddDate(0, 0, -calendarFeedPastDays).Format(dateLayout),
+		today.AddDate(0, 0, calendarFeedFutureDays).Format(dateLayout), "", false)
+	if err != nil {
+		log.Println("calendar feed:", err)
+		http.Error(w, "feed query failed", http.StatusInternalServerError)
+		return
+	}
+
+	base := feedBaseURL(r)
+	host := r.Host
+	if i := strings.Index(base, "://"); i >= 0 {
+		host = base[i+3:]
+	}
+	stamp := today.Format("20060102T150405Z")
+
+	var b strings.Builder
+	icsLine(&b, "BEGIN:VCALENDAR")
+	icsLine(&b, "VERSION:2.0")
+	icsLine(&b, "PRODID:-//task-manager//calendar feed//EN")
+	icsLine(&b, "CALSCALE:GREGORIAN")
+	icsLine(&b, "METHOD:PUBLISH")
+	icsLine(&b, "X-WR-CALNAME:"+icsEscape("Tasks – "+displayName))
+	icsLine(&b, "REFRESH-INTERVAL;VALUE=DURATION:PT1H")
+	icsLine(&b, "X-PUBLISHED-TTL:PT1H")
+	for _, t := range tasks {
+		// done tasks stay visible, marked, so the past of the window still reads right
+		start, end := t.StartDate, t.DueDate
+		if start == nil {
+			start = end
+		}
+		if end == nil {
+			end = start
+		}
+		s, _ := time.Parse(dateLayout, *start)
+		e, _ := time.Parse(dateLayout, *end)
+		summary := t.Title
+		if t.Done {
+			summary = "✓ " + summary
+		}
+		icsLine(&b, "BEGIN:VEVENT")
+		icsLine(&b, "UID:"+t.ID+"@"+host)
+		icsLine(&b, "DTSTAMP:"+stamp)
+		icsLine(&b, "DTSTART;VALUE=DATE:"+s.Format("20060102"))
+		icsLine(&b, "DTEND;VALUE=DATE:"+e.AddDate(0, 0, 1).Format("20060102")) // exclusive
+		icsLine(&b, "SUMMARY:"+icsEscape(summary))
+		icsLine(&b, "DESCRIPTION:"+icsEscape(t.BoardName+" / "+t.ListName))
+		icsLine(&b, "CATEGORIES:"+icsEscape(t.BoardName))
+		icsLine(&b, "URL:"+base+"/board?id="+t.BoardID)
+		icsLine(&b, "TRANSP:TRANSPARENT")
+		icsLine(&b, "END:VEVENT")
+	}
+	icsLine(&b, "END:VCALENDAR")
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="tasks.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// icsEscape escapes a TEXT value (RFC 5545 §3.3.11).
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// icsLine writes one content line with CRLF, folded so no physical line is
+// longer than 75 octets and no UTF-8 sequence is split (§3.1).
+func icsLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = 74 // the leading space counts
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,536 @@
+// handlers_checklists.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---- DTOs ----
+
+type ChecklistDTO struct {
+	ID       string             `json:"id"`
+	TaskID   string             `json:"task_id"`
+	Title    string             `json:"title"`
+	Position int                `json:"position"`
+	Items    []ChecklistItemDTO `json:"items"`
+}
+
+type ChecklistItemDTO struct {
+	ID          string     `json:"id"`
+	ChecklistID string     `json:"checklist_id"`
+	Body        string     `json:"body"`
+	Position    int        `json:"position"`
+	Done        bool       `json:"done"`
+	DoneAt      *time.Time `json:"done_at"`
+	AssigneeID  *string    `json:"assignee_id"`
+	DueDate     *string    `json:"due_date"` // YYYY-MM-DD
+}
+
+const checklistItemCols = `id, checklist_id, body, position, done, done_at, assignee_id, due_date`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanChecklistItem(s rowScanner) (ChecklistItemDTO, error) {
+	var it ChecklistItemDTO
+	var doneAt, due sql.NullTime
+	var assignee sql.NullString
+	if err := s.Scan(&it.ID, &it.ChecklistID, &it.Body, &it.Position, &it.Done, &doneAt, &assignee, &due); err != nil {
+		return it, err
+	}
+	if doneAt.Valid {
+		it.DoneAt = &doneAt.Time
+	}
+	if assignee.Valid {
+		it.AssigneeID = &assignee.String
+	}
+	if due.Valid {
+		d := due.Time.Format(dateLayout)
+		it.DueDate = &d
+	}
+	return it, nil
+}
+
+const dateLayout = "2006-01-02"
+
+// parseDate turns "YYYY-MM-DD" into a query arg; "" means NULL.
+func parseDate(s string) (any, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, true
+	}
+	if _, err := time.Parse(dateLayout, s); err != nil {
+		return nil, false
+	}
+	return s, true
+}
+
+// ---- /api/checklists ----
+// GET ?task_id=...             → checklists with items
+// POST { task_id, title }      → new checklist at the end
+// PATCH ?id=... { title }      → rename
+// DELETE ?id=...               → remove (items cascade)
+
+func checklistsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	switch r.Method {
+	case http.MethodGet:
+		listChecklistsHandler(w, r, db)
+	case http.MethodPost:
+		createChecklistHandler(w, r, db)
+	case http.MethodPatch:
+		renameChecklistHandler(w, r, db)
+	case http.MethodDelete:
+		deleteChecklistHandler(w, r, db)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listChecklistsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := getSessionFromRequest(r, db)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID := r.URL.Query().Get("task_id")
+	if taskID == "" {
+		http.Error(w, "missing task_id", http.StatusBadRequest)
+		return
+	}
+	if !canAccessTask(db, sess, taskID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	rows, err := db.Query(`SELECT id, task_id, title, position FROM checklists WHERE task_id=$1 ORDER BY position ASC`, taskID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	lists := make([]ChecklistDTO, 0)
+	index := make(map[string]int)
+	for rows.Next() {
+		var c ChecklistDTO
+		if err := rows.Scan(&c.ID, &c.TaskID, &c.Title, &c.Position); err == nil {
+			c.Items = make([]ChecklistItemDTO, 0)
+			index[c.ID] = len(lists)
+			lists = append(lists, c)
+		}
+	}
+	rows.Close()
+
+	irows, err := db.Query(`
+		SELECT `+checklistItemCols+`
+		FROM checklist_items
+		WHERE checklist_id IN (SELECT id FROM checklists WHERE task_id=$1)
+		ORDER BY position ASC
+	`, taskID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	defer irows.Close()
+	for irows.Next() {
+		if it, err := scanChecklistItem(irows); err == nil {
+			if i, ok := index[it.ChecklistID]; ok {
+				lists[i].Items = append(lists[i].Items, it)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(lists)
+}
+
+type createChecklistReq struct {
+	TaskID string `json:"task_id"`
+	Title  string `json:"title"`
+}
+
+func createChecklistHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	var req createChecklistReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	if req.TaskID == "" || req.Title == "" {
+		http.Error(w, "missing fields", http.StatusBadRequest)
+		return
+	}
+	if !canAccessTask(db, sess, req.TaskID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	out := ChecklistDTO{TaskID: req.TaskID, Title: req.Title, Items: make([]ChecklistItemDTO, 0)}
+	if err := db.QueryRow(`
+		INSERT INTO checklists (task_id, title, position)
+		VALUES ($1, $2, (SELECT COALESCE(MAX(position)+1, 0) FROM checklists WHERE task_id=$1))
+		RETURNING id, position
+	`, req.TaskID, req.Title).Scan(&out.ID, &out.Position); err != nil {
+		http.Error(w, "insert failed", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func renameChecklistHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Title string `json:"title"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Title) == "" {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if !canAccessChecklist(db, sess, id) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+	var out ChecklistDTO
+	if err := db.QueryRow(`
+		UPDATE checklists SET title=$1 WHERE id=$2
+		RETURNING id, task_id, title, position
+	`, strings.TrimSpace(req.Title), id).Scan(&out.ID, &out.TaskID, &out.Title, &out.Position); err != nil {
+		http.Error(w, "update failed", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func deleteChecklistHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	if !canAccessChecklist(db, sess, id) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var taskID string
+	var pos int
+	if err := tx.QueryRow(`DELETE FROM checklists WHERE id=$1 RETURNING task_id, position`, id).Scan(&taskID, &pos); err != nil {
+		http.Error(w, "delete failed", http.StatusBadRequest)
+		return
+	}
+	if _, err := tx.Exec(`UPDATE checklists SET position = position - 1 WHERE task_id=$1 AND position > $2`, taskID, pos); err != nil {
+		http.Error(w, "compact failed", http.StatusBadRequest)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ---- /api/checklist-items ----
+// POST { checklist_id, body, assignee_id?, due_date? } → new item at the end
+// PATCH ?id=... { body?, done?, assignee_id?, due_date? } ("" clears assignee/due date)
+// DELETE ?id=...
+
+func checklistItemsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	switch r.Method {
+	case http.MethodPost:
+		createChecklistItemHandler(w, r, db)
+	case http.MethodPatch:
+		updateChecklistItemHandler(w, r, db)
+	case http.MethodDelete:
+		deleteChecklistItemHandler(w, r, db)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+type createChecklistItemReq struct {
+	ChecklistID string `json:"checklist_id"`
+	Body        string `json:"body"`
+	AssigneeID  string `json:"assignee_id,omitempty"`
+	DueDate     string `json:"due_date,omitempty"`
+}
+
+func createChecklistItemHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	var req createChecklistItemReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	req.Body = strings.TrimSpace(req.Body)
+	if req.ChecklistID == "" || req.Body == "" {
+		http.Error(w, "missing fields", http.StatusBadRequest)
+		return
+	}
+	var taskID string
+	if err := db.QueryRow(`SELECT task_id FROM checklists WHERE id=$1`, req.ChecklistID).Scan(&taskID); err != nil ||
+		!canAccessTask(db, sess, taskID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	due, ok := parseDate(req.DueDate)
+	if !ok {
+		http.Error(w, "due_date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	var assignee any
+	if req.AssigneeID != "" {
+		if !isTaskWorkspaceMember(db, taskID, req.AssigneeID) {
+			http.Error(w, "assignee is not a workspace member", http.StatusBadRequest)
+			return
+		}
+		assignee = req.AssigneeID
+	}
+
+	it, err := scanChecklistItem(db.QueryRow(`
+		INSERT INTO checklist_items (checklist_id, body, position, assignee_id, due_date)
+		VALUES ($1, $2, (SELECT COALESCE(MAX(position)+1, 0) FROM checklist_items WHERE checklist_id=$1), $3, $4)
+		RETURNING `+checklistItemCols,
+		req.ChecklistID, req.Body, assignee, due))
+	if err != nil {
+		http.Error(w, "insert failed", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(it)
+}
+
+type updateChecklistItemReq struct {
+	Body       *string `json:"body,omitempty"`
+	Done       *bool   `json:"done,omitempty"`
+	AssigneeID *string `json:"assignee_id,omitempty"`
+	DueDate    *string `json:"due_date,omitempty"`
+}
+
+func updateChecklistItemHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	var req updateChecklistItemReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	var taskID string
+	if err := db.QueryRow(`
+		SELECT c.task_id FROM checklist_items i JOIN checklists c ON c.id = i.checklist_id WHERE i.id=$1
+	`, id).Scan(&taskID); err != nil || !canAccessTask(db, sess, taskID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	sets := []string{}
+	args := []any{}
+	if req.Body != nil {
+		b := strings.TrimSpace(*req.Body)
+		if b == "" {
+			http.Error(w, "body cannot be empty", http.StatusBadRequest)
+			return
+		}
+		sets = append(sets, "body=$"+strconv.Itoa(len(args)+1))
+		args = append(args, b)
+	}
+	if req.Done != nil {
+		sets = append(sets, "done=$"+strconv.Itoa(len(args)+1),
+			"done_at=CASE WHEN $"+strconv.Itoa(len(args)+1)+"::boolean THEN COALESCE(done_at, NOW()) ELSE NULL END")
+		args = append(args, *req.Done)
+	}
+	if req.AssigneeID != nil {
+		var v any
+		if *req.AssigneeID != "" {
+			if !isTaskWorkspaceMember(db, taskID, *req.AssigneeID) {
+				http.Error(w, "assignee is not a workspace member", http.StatusBadRequest)
+				return
+			}
+			v = *req.AssigneeID
+		}
+		sets = append(sets, "assignee_id=$"+strconv.Itoa(len(args)+1))
+		args = append(args, v)
+	}
+	if req.DueDate != nil {
+		due, ok := parseDate(*req.DueDate)
+		if !ok {
+			http.Error(w, "due_date must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		sets = append(sets, "due_date=$"+strconv.Itoa(len(args)+1))
+		args = append(args, due)
+	}
+	if len(sets) == 0 {
+		http.Error(w, "nothing to update", http.StatusBadRequest)
+		return
+	}
+
+	args = append(args, id)
+	it, err := scanChecklistItem(db.QueryRow(`
+		UPDATE checklist_items SET `+strings.Join(sets, ", ")+`, updated_at=NOW()
+		WHERE id=$`+strconv.Itoa(len(args))+`
+		RETURNING `+checklistItemCols, args...))
+	if err != nil {
+		http.Error(w, "update failed", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(it)
+}
+
+func deleteChecklistItemHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var checklistID string
+	var pos int
+	if err := tx.QueryRow(`SELECT checklist_id, position FROM checklist_items WHERE id=$1`, id).Scan(&checklistID, &pos); err != nil ||
+		!canAccessChecklist(tx, sess, checklistID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM checklist_items WHERE id=$1`, id); err != nil {
+		http.Error(w, "delete failed", http.StatusBadRequest)
+		return
+	}
+	if _, err := tx.Exec(`UPDATE checklist_items SET position = position - 1 WHERE checklist_id=$1 AND position > $2`, checklistID, pos); err != nil {
+		http.Error(w, "compact failed", http.StatusBadRequest)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /api/checklist-items/reorder
+// Body: { "checklist_id": "...", "item_ids": ["id1","id2",...] }
+type reorderChecklistItemsReq struct {
+	ChecklistID string   `json:"checklist_id"`
+	ItemIDs     []string `json:"item_ids"`
+}
+
+func reorderChecklistItemsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	var req reorderChecklistItemsReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChecklistID == "" || len(req.ItemIDs) == 0 {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if !canAccessChecklist(db, sess, req.ChecklistID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// item_ids must be a permutation of the checklist's items: a partial or
+	// repeated list would leave duplicate positions behind
+	rows, err := tx.Query(`SELECT id FROM checklist_items WHERE checklist_id=$1 FOR UPDATE`, req.ChecklistID)
+	if err != nil {
+		http.Error(w, "lookup failed", http.StatusInternalServerError)
+		return
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			http.Error(w, "lookup failed", http.StatusInternalServerError)
+			return
+		}
+		existing[id] = true
+	}
+	rows.Close()
+	if len(req.ItemIDs) != len(existing) {
+		http.Error(w, "item_ids must list every item in the checklist exactly once", http.StatusBadRequest)
+		return
+	}
+	for _, id := range req.ItemIDs {
+		if !existing[id] {
+			http.Error(w, "item_ids must list every item in the checklist exactly once", http.StatusBadRequest)
+			return
+		}
+		delete(existing, id)
+	}
+
+	for i, id := range req.ItemIDs {
+		if _, err := tx.Exec(`UPDATE checklist_items SET position=$1 WHERE id=$2`, i, id); err != nil {
+			http.Error(w, "update failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"ok":true}`))
+}
@@ -34,7 +34,7 @@ func createCommentHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	sess, ok := requireAuthAndCSRF(w, r)
+	sess, ok := requireAuthAndCSRF(w, r, db)
 	if !ok {
 		return
 	}
@@ -44,6 +44,10 @@ func createCommentHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		http.Error(w, "bad json", http.StatusBadRequest)
 		return
 	}
+	if !canAccessTask(db, sess, req.TaskID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
 
 	var id string
 	var created time.Time
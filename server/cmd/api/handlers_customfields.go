@@ -0,0 +1,617 @@
+// handlers_customfields.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ---- custom fields ----
+// Fields are defined per board; values are stored per task as JSON and
+// validated here against the field type:
+//   text → string, number → number, date → "YYYY-MM-DD", select → one option,
+//   multi_select → array of options, checkbox → bool, user → workspace member id.
+// Writing null clears a value.
+
+var customFieldTypes = map[string]bool{
+	"text": true, "number": true, "date": true, "select": true,
+	"multi_select": true, "checkbox": true, "user": true,
+}
+
+const (
+	maxCustomFieldsPerBoard = 50
+	maxCustomFieldOptions   = 100
+	maxCustomTextLen        = 2000
+)
+
+type CustomFieldDTO struct {
+	ID       string   `json:"id"`
+	BoardID  string   `json:"board_id"`
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Options  []string `json:"options"`
+	Position int      `json:"position"`
+}
+
+const customFieldCols = `id, board_id, name, type, options, position`
+
+func scanCustomField(s rowScanner) (CustomFieldDTO, error) {
+	var f CustomFieldDTO
+	var opts []byte
+	if err := s.Scan(&f.ID, &f.BoardID, &f.Name, &f.Type, &opts, &f.Position); err != nil {
+		return f, err
+	}
+	f.Options = make([]string, 0)
+	_ = json.Unmarshal(opts, &f.Options)
+	return f, nil
+}
+
+func loadBoardCustomFields(db *sql.DB, boardID string) ([]CustomFieldDTO, error) {
+	rows, err := db.Query(`SELECT `+customFieldCols+` FROM board_custom_fields WHERE board_id=$1 ORDER BY position ASC`, boardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	fields := make([]CustomFieldDTO, 0)
+	for rows.Next() {
+		if f, err := scanCustomField(rows); err == nil {
+			fields = append(fields, f)
+		}
+	}
+	return fields, rows.Err()
+}
+
+// loadTaskCustomValues returns field id → value for one task.
+func loadTaskCustomValues(db *sql.DB, taskID string) map[string]json.RawMessage {
+	out := make(map[string]json.RawMessage)
+	rows, err := db.Query(`SELECT field_id, value FROM task_custom_values WHERE task_id=$1`, taskID)
+	if err != nil {
+		return out
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var v []byte
+		if err := rows.Scan(&id, &v); err == nil {
+			out[id] = json.RawMessage(v)
+		}
+	}
+	return out
+}
+
+// normalizeOptions trims, drops blanks and de-duplicates select options.
+func normalizeOptions(in []string) ([]string, error) {
+	out := make([]string, 0, len(in))
+	seen := make(map[string]bool)
+	for _, o := range in {
+		o = strings.TrimSpace(o)
+		if o == "" || seen[o] {
+			continue
+		}
+		seen[o] = true
+		out = append(out, o)
+	}
+	if len(out) > maxCustomFieldOptions {
+		return nil, errors.New("too many options")
+	}
+	return out, nil
+}
+
+func hasOption(f CustomFieldDTO, v string) bool {
+	for _, o := range f.Options {
+		if o == v {
+			return true
+		}
+	}
+	return false
+}
+
+// validateCustomValue checks raw against the field type and returns the JSON
+// to store, or nil when the value should be cleared.
+func validateCustomValue(q queryer, f CustomFieldDTO, taskID string, raw json.RawMessage) ([]byte, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	switch f.Type {
+	case "text":
+		var s string
+		if json.Unmarshal(raw, &s) != nil {
+			return nil, errors.New(f.Name + ": expected a string")
+		}
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return nil, nil
+		}
+		if len(s) > maxCustomTextLen {
+			return nil, errors.New(f.Name + ": text too long")
+		}
+		return json.Marshal(s)
+	case "number":
+		var n float64
+		if json.Unmarshal(raw, &n) != nil {
+			return nil, errors.New(f.Name + ": expected a number")
+		}
+		return json.Marshal(n)
+	case "date":
+		var s string
+		if json.Unmarshal(raw, &s) != nil {
+			return nil, errors.New(f.Name + ": expected YYYY-MM-DD")
+		}
+		d, ok := parseDate(s)
+		if !ok {
+			return nil, errors.New(f.Name + ": expected YYYY-MM-DD")
+		}
+		if d == nil {
+			return nil, nil
+		}
+		return json.Marshal(d)
+	case "select":
+		var s string
+		if json.Unmarshal(raw, &s) != nil || !hasOption(f, s) {
+			return nil, errors.New(f.Name + ": not one of the field's options")
+		}
+		return json.Marshal(s)
+	case "multi_select":
+		var in []string
+		if json.Unmarshal(raw, &in) != nil {
+			return nil, errors.New(f.Name + ": expected an array of options")
+		}
+		out := make([]string, 0, len(in))
+		seen := make(map[string]bool)
+		for _, s := range in {
+			if !hasOption(f, s) {
+				return nil, errors.New(f.Name + ": " + strconv.Quote(s) + " is not one of the field's options")
+			}
+			if !seen[s] {
+				seen[s] = true
+				out = append(out, s)
+			}
+		}
+		if len(out) == 0 {
+			return nil, nil
+		}
+		return json.Marshal(out)
+	case "checkbox":
+		var b bool
+		if json.Unmarshal(raw, &b) != nil {
+			return nil, errors.New(f.Name + ": expected true or false")
+		}
+		return json.Marshal(b)
+	case "user":
+		var uid string
+		if json.Unmarshal(raw, &uid) != nil || !isTaskWorkspaceMember(q, taskID, uid) {
+			return nil, errors.New(f.Name + ": expected a member of this workspace")
+		}
+		return json.Marshal(uid)
+	}
+	return nil, errors.New(f.Name + ": unknown field type")
+}
+
+// customFieldQuery turns board query params into extra SQL for the per-list task query:
+//
+//	cf.<field_id>=<value>    filter (text: substring, multi_select: contains, others: equals)
+//	sort=[-]cf.<field_id>    sort within each list, nulls last; position breaks ties
+//
+// Placeholders start at $firstArg. The returned order is either empty or ends in ", ".
+func customFieldQuery(fields []CustomFieldDTO, q url.Values, firstArg int) (where, order string, args []any, err error) {
+	byID := make(map[string]CustomFieldDTO, len(fields))
+	for _, f := range fields {
+		byID[f.ID] = f
+	}
+	ph := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(firstArg+len(args)-1)
+	}
+	value := func(f CustomFieldDTO) string {
+		return `(SELECT v.value FROM task_custom_values v WHERE v.task_id = t.id AND v.field_id = ` + ph(f.ID) + `)`
+	}
+
+	conds := []string{}
+	for key, vals := range q {
+		if !strings.HasPrefix(key, "cf.") || len(vals) == 0 {
+			continue
+		}
+		f, ok := byID[strings.TrimPrefix(key, "cf.")]
+		if !ok {
+			return "", "", nil, errors.New("unknown custom field " + strconv.Quote(strings.TrimPrefix(key, "cf.")))
+		}
+		v := vals[0]
+		switch f.Type {
+		case "text":
+			conds = append(conds, value(f)+` #>> '{}' ILIKE '%' || `+ph(likeEscape(v))+` || '%'`)
+		case "number":
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				return "", "", nil, errors.New(f.Name + ": filter expects a number")
+			}
+			conds = append(conds, `(`+value(f)+` #>> '{}')::numeric = `+ph(v)+`::numeric`)
+		case "date":
+			if d, ok := parseDate(v); !ok || d == nil {
+				return "", "", nil, errors.New(f.Name + ": filter expects YYYY-MM-DD")
+			}
+			conds = append(conds, value(f)+` #>> '{}' = `+ph(v))
+		case "multi_select":
+			conds = append(conds, `jsonb_exists(`+value(f)+`, `+ph(v)+`)`)
+		case "checkbox":
+			// unset counts as false
+			conds = append(conds, `COALESCE((`+value(f)+`)::text::boolean, false) = `+ph(v == "true")+`::boolean`)
+		default: // select, user
+			conds = append(conds, value(f)+` #>> '{}' = `+ph(v))
+		}
+	}
+	if len(conds) > 0 {
+		where = " AND " + strings.Join(conds, " AND ")
+	}
+
+	if s := q.Get("sort"); s != "" {
+		dir := "ASC"
+		if strings.HasPrefix(s, "-") {
+			dir, s = "DESC", s[1:]
+		}
+		f, ok := byID[strings.TrimPrefix(s, "cf.")]
+		if !strings.HasPrefix(s, "cf.") || !ok {
+			return "", "", nil, errors.New("unknown sort field")
+		}
+		var expr string
+		switch f.Type {
+		case "number":
+			expr = `(` + value(f) + ` #>> '{}')::numeric`
+		case "checkbox":
+			expr = `(` + value(f) + `)::text::boolean`
+		case "user":
+			expr = `(SELECT u.name FROM users u WHERE u.id = (` + value(f) + ` #>> '{}')::uuid)`
+		default:
+			expr = value(f) + ` #>> '{}'`
+		}
+		order = expr + " " + dir + " NULLS LAST, "
+	}
+	return where, order, args, nil
+}
+
+// ---- /api/custom-fields ----
+// GET ?board_id=...                            → field definitions
+// POST { board_id, name, type, options? }      → new field at the end
+// PATCH ?id=... { name?, options? }            → rename / change choices (type is fixed)
+// DELETE ?id=...                               → remove field and its values
+
+func customFieldsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	switch r.Method {
+	case http.MethodGet:
+		listCustomFieldsHandler(w, r, db)
+	case http.MethodPost:
+		createCustomFieldHandler(w, r, db)
+	case http.MethodPatch:
+		updateCustomFieldHandler(w, r, db)
+	case http.MethodDelete:
+		deleteCustomFieldHandler(w, r, db)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listCustomFieldsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := getSessionFromRequest(r, db)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	boardID := r.URL.Query().Get("board_id")
+	if boardID == "" {
+		http.Error(w, "missing board_id", http.StatusBadRequest)
+		return
+	}
+	if !canAccessBoard(db, sess, boardID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+	fields, err := loadBoardCustomFields(db, boardID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(fields)
+}
+
+type createCustomFieldReq struct {
+	BoardID string   `json:"board_id"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Options []string `json:"options,omitempty"`
+}
+
+func createCustomFieldHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	var req createCustomFieldReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.BoardID == "" || req.Name == "" {
+		http.Error(w, "missing fields", http.StatusBadRequest)
+		return
+	}
+	if !customFieldTypes[req.Type] {
+		http.Error(w, "unknown field type", http.StatusBadRequest)
+		return
+	}
+	opts, err := normalizeOptions(req.Options)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	isSelect := req.Type == "select" || req.Type == "multi_select"
+	if isSelect && len(opts) == 0 {
+		http.Error(w, "select fields need at least one option", http.StatusBadRequest)
+		return
+	}
+	if !isSelect {
+		opts = []string{}
+	}
+	if !canAccessBoard(db, sess, req.BoardID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var count int
+	_ = db.QueryRow(`SELECT COUNT(*) FROM board_custom_fields WHERE board_id=$1`, req.BoardID).Scan(&count)
+	if count >= maxCustomFieldsPerBoard {
+		http.Error(w, "too many custom fields on this board", http.StatusBadRequest)
+		return
+	}
+
+	optsJSON, _ := json.Marshal(opts)
+	f, err := scanCustomField(db.QueryRow(`
+		INSERT INTO board_custom_fields (board_id, name, type, options, position)
+		VALUES ($1, $2, $3, $4::jsonb, (SELECT COALESCE(MAX(position)+1, 0) FROM board_custom_fields WHERE board_id=$1))
+		RETURNING `+customFieldCols,
+		req.BoardID, req.Name, req.Type, string(optsJSON)))
+	if isUniqueViolation(err) {
+		http.Error(w, "a field with that name already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "insert failed", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(f)
+}
+
+type updateCustomFieldReq struct {
+	Name    *string   `json:"name,omitempty"`
+	Options *[]string `json:"options,omitempty"`
+}
+
+func updateCustomFieldHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	var req updateCustomFieldReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	f, err := scanCustomField(db.QueryRow(`SELECT `+customFieldCols+` FROM board_custom_fields WHERE id=$1`, id))
+	if err != nil || !canAccessBoard(db, sess, f.BoardID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	sets := []string{}
+	args := []any{}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			http.Error(w, "name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		sets = append(sets, "name=$"+strconv.Itoa(len(args)+1))
+		args = append(args, name)
+	}
+	var optsJSON string
+	if req.Options != nil {
+		if f.Type != "select" && f.Type != "multi_select" {
+			http.Error(w, "only select fields have options", http.StatusBadRequest)
+			return
+		}
+		opts, err := normalizeOptions(*req.Options)
+		if err != nil || len(opts) == 0 {
+			http.Error(w, "select fields need between 1 and 100 options", http.StatusBadRequest)
+			return
+		}
+		b, _ := json.Marshal(opts)
+		optsJSON = string(b)
+		sets = append(sets, "options=$"+strconv.Itoa(len(args)+1)+"::jsonb")
+		args = append(args, optsJSON)
+	}
+	if len(sets) == 0 {
+		http.Error(w, "nothing to update", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	args = append(args, id)
+	out, err := scanCustomField(tx.QueryRow(`
+		UPDATE board_custom_fields SET `+strings.Join(sets, ", ")+`
+		WHERE id=$`+strconv.Itoa(len(args))+`
+		RETURNING `+customFieldCols, args...))
+	if isUniqueViolation(err) {
+		http.Error(w, "a field with that name already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "update failed", http.StatusBadRequest)
+		return
+	}
+
+	// Drop values that point at options which no longer exist.
+	if optsJSON != "" {
+		if f.Type == "select" {
+			_, err = tx.Exec(`
+				DELETE FROM task_custom_values
+				WHERE field_id=$1 AND NOT jsonb_exists($2::jsonb, value #>> '{}')
+			`, id, optsJSON)
+		} else {
+			_, err = tx.Exec(`
+				UPDATE task_custom_values v SET value = kept.value, updated_at=NOW()
+				FROM (
+				  SELECT task_id, COALESCE(jsonb_agg(e) FILTER (WHERE jsonb_exists($2::jsonb, e #>> '{}')), '[]') AS value
+				  FROM task_custom_values, jsonb_array_elements(value) e
+				  WHERE field_id=$1
+				  GROUP BY task_id
+				) kept
+				WHERE v.field_id=$1 AND v.task_id = kept.task_id AND v.value <> kept.value
+			`, id, optsJSON)
+			if err == nil {
+				_, err = tx.Exec(`DELETE FROM task_custom_values WHERE field_id=$1 AND value = '[]'::jsonb`, id)
+			}
+		}
+		if err != nil {
+			http.Error(w, "update failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func deleteCustomFieldHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	var boardID string
+	if err := db.QueryRow(`SELECT board_id FROM board_custom_fields WHERE id=$1`, id).Scan(&boardID); err != nil || !canAccessBoard(db, sess, boardID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+	if _, err := db.Exec(`DELETE FROM board_custom_fields WHERE id=$1`, id); err != nil {
+		http.Error(w, "delete failed", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ---- /api/tasks/fields ----
+// GET ?task_id=...                               → { field_id: value }
+// PATCH ?task_id=... { field_id: value|null, … } → set/clear, returns all values
+
+func taskFieldsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	switch r.Method {
+	case http.MethodGet:
+		sess, ok := getSessionFromRequest(r, db)
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		taskID := r.URL.Query().Get("task_id")
+		if taskID == "" || !canAccessTask(db, sess, taskID) {
+			http.Error(w, "not found or forbidden", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(loadTaskCustomValues(db, taskID))
+	case http.MethodPatch:
+		setTaskFieldsHandler(w, r, db)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func setTaskFieldsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	taskID := r.URL.Query().Get("task_id")
+	if taskID == "" {
+		http.Error(w, "missing task_id", http.StatusBadRequest)
+		return
+	}
+	var req map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req) == 0 {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if !canAccessTask(db, sess, taskID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for fieldID, raw := range req {
+		// the field has to be defined on the board the task currently sits on
+		f, err := scanCustomField(tx.QueryRow(`
+			SELECT f.id, f.board_id, f.name, f.type, f.options, f.position
+			FROM board_custom_fields f
+			JOIN lists l ON l.board_id = f.board_id
+			JOIN tasks t ON t.list_id = l.id
+			WHERE f.id = $1 AND t.id = $2
+		`, fieldID, taskID))
+		if err != nil {
+			http.Error(w, "unknown field "+strconv.Quote(fieldID), http.StatusBadRequest)
+			return
+		}
+		v, err := validateCustomValue(tx, f, taskID, raw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if v == nil {
+			_, err = tx.Exec(`DELETE FROM task_custom_values WHERE task_id=$1 AND field_id=$2`, taskID, fieldID)
+		} else {
+			_, err = tx.Exec(`
+				INSERT INTO task_custom_values (task_id, field_id, value)
+				VALUES ($1, $2, $3::jsonb)
+				ON CONFLICT (task_id, field_id) DO UPDATE SET value=EXCLUDED.value, updated_at=NOW()
+			`, taskID, fieldID, string(v))
+		}
+		if err != nil {
+			http.Error(w, "update failed", http.StatusBadRequest)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(loadTaskCustomValues(db, taskID))
+}
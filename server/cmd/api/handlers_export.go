@@ -0,0 +1,353 @@
+// handlers_export.go
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ---- personal data export ----
+// POST /api/me/export queues a job; the zip is built in the background and can
+// be downloaded from /api/me/export/download?id=... until it expires.
+
+const exportTTL = 48 * time.Hour
+
+// Not under uploadDir: that one is served publicly.
+var exportDir = envOr("EXPORT_DIR", "/app/server/exports")
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// exportSections maps each file in the zip to the query producing it.
+// Every query takes the user id as $1 and returns a single JSON document.
+var exportSections = []struct {
+	File  string
+	Query string
+}{
+	{"user.json", `
+		SELECT row_to_json(u) FROM (
+		  SELECT id, email, name, avatar_url, totp_enabled, created_at, updated_at
+		  FROM users WHERE id=$1
+		) u`},
+	{"workspaces.json", `
+		SELECT COALESCE(json_agg(x ORDER BY x.name), '[]') FROM (
+		  SELECT w.id, w.name, w.slug, m.role, w.created_at
+		  FROM workspace_members m JOIN workspaces w ON w.id = m.workspace_id
+		  WHERE m.user_id=$1
+		) x`},
+	{"tasks_created.json", `
+		SELECT COALESCE(json_agg(x ORDER BY x.created_at), '[]') FROM (
+		  SELECT t.id, t.title, t.description, t.priority, t.estimate, t.due_date, t.created_at, t.updated_at,
+		         l.name AS list, b.name AS board
+		  FROM tasks t JOIN lists l ON l.id = t.list_id JOIN boards b ON b.id = l.board_id
+		  WHERE t.created_by=$1
+		) x`},
+	{"assignments.json", `
+		SELECT COALESCE(json_agg(x ORDER BY x.assigned_at), '[]') FROM (
+		  SELECT a.task_id, t.title, a.assigned_at
+		  FROM task_assignees a JOIN tasks t ON t.id = a.task_id
+		  WHERE a.user_id=$1
+		) x`},
+	{"comments.json", `
+		SELECT COALESCE(json_agg(x ORDER BY x.created_at), '[]') FROM (
+		  SELECT c.id, c.task_id, c.body, c.created_at
+		  FROM comments c WHERE c.author_id=$1
+		) x`},
+	{"time_entries.json", `
+		SELECT COALESCE(json_agg(x ORDER BY x.started_at), '[]') FROM (
+		  SELECT e.id, e.task_id, t.title AS task, e.started_at, e.ended_at, e.note, e.source
+		  FROM time_entries e JOIN tasks t ON t.id = e.task_id
+		  WHERE e.user_id=$1
+		) x`},
+	{"identities.json", `
+		SELECT COALESCE(json_agg(x), '[]') FROM (
+		  SELECT issuer, subject, email, created_at, last_login_at
+		  FROM user_identities WHERE user_id=$1
+		) x`},
+	{"api_tokens.json", `
+		SELECT COALESCE(json_agg(x), '[]') FROM (
+		  SELECT id, name, token_prefix, scopes, workspace_id, expires_at, last_used_at, revoked_at, created_at
+		  FROM api_tokens WHERE user_id=$1
+		) x`},
+}
+
+// uploadRefs finds /uploads/... files referenced by the user's profile,
+// task descriptions and comments, so the files themselves go into the zip.
+const exportUploadRefsQuery = `
+	SELECT DISTINCT m[1] FROM (
+	  SELECT avatar_url AS txt FROM users WHERE id=$1 AND avatar_url IS NOT NULL
+	  UNION ALL SELECT description FROM tasks WHERE created_by=$1
+	  UNION ALL SELECT body FROM comments WHERE author_id=$1
+	) s, LATERAL regexp_matches(s.txt, '/uploads/([A-Za-z0-9._-]+)', 'g') AS m`
+
+func runDataExport(db *sql.DB, exportID, userID string) {
+	path, err := buildExportZip(db, exportID, userID)
+	if err != nil {
+		log.Println("data export failed:", err)
+		_, _ = db.Exec(`UPDATE data_exports SET status='failed', error=$2, completed_at=NOW() WHERE id=$1`, exportID, err.Error())
+		return
+	}
+	if _, err := db.Exec(`
+		UPDATE data_exports SET status='ready', file_path=$2, completed_at=NOW(), expires_at=NOW() + $3::int * INTERVAL '1 second'
+		WHERE id=$1
+	`, exportID, path, int(exportTTL.Seconds())); err != nil {
+		log.Println("data export bookkeeping failed:", err)
+		_ = os.Remove(path)
+	}
+}
+
+func buildExportZip(db *sql.DB, exportID, userID string) (path string, err error) {
+	if err := os.MkdirAll(exportDir, 0o700); err != nil {
+		return "", err
+	}
+	path = filepath.Join(exportDir, exportID+".zip")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(path)
+		}
+	}()
+
+	zw := zip.NewWriter(f)
+	for _, s := range exportSections {
+		var doc []byte
+		if err := db.QueryRow(s.Query, userID).Scan(&doc); err != nil {
+			return "", fmt.Errorf("%s: %w", s.File, err)
+		}
+		out, err := zw.Create(s.File)
+		if err != nil {
+			return "", err
+		}
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, doc, "", "  ") == nil {
+			doc = pretty.Bytes()
+		}
+		if _, err := out.Write(doc); err != nil {
+			return "", err
+		}
+	}
+
+	rows, err := db.Query(exportUploadRefsQuery, userID)
+	if err != nil {
+		return "", fmt.Errorf("uploads: %w", err)
+	}
+	names := make([]string, 0)
+	for rows.Next() {
+		var n string
+		if err := rows.Scan(&n); err == nil {
+			names = append(names, n)
+		}
+	}
+	rows.Close()
+	for _, n := range names {
+		src, err := os.Open(filepath.Join(uploadDir, filepath.Base(n)))
+		if err != nil {
+			continue // referenced file no longer on disk
+		}
+		out, err := zw.Create("uploads/" + filepath.Base(n))
+		if err == nil {
+			_, err = io.Copy(out, src)
+		}
+		src.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// startExportJanitor marks exports interrupted by a restart as failed and
+// periodically deletes expired zips.
+func startExportJanitor(db *sql.DB) {
+	if _, err := db.Exec(
+		`UPDATE data_exports SET status='failed', error='interrupted by restart' WHERE status='pending'`,
+	); err != nil {
+		log.Println("export janitor:", err)
+	}
+	go func() {
+		for {
+			purgeExpiredExports(db)
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+func purgeExpiredExports(db *sql.DB) {
+	rows, err := db.Query(`
+		UPDATE data_exports SET status='expired'
+		WHERE status='ready' AND expires_at < NOW()
+		RETURNING file_path
+	`)
+	if err != nil {
+		log.Println("export janitor:", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p sql.NullString
+		if err := rows.Scan(&p); err == nil && p.Valid {
+			_ = os.Remove(p.String)
+		}
+	}
+}
+
+// ---- /api/me/export (POST start, GET list) ----
+
+type dataExportItem struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	Error       *string    `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+func dataExportHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	switch r.Method {
+	case http.MethodGet:
+		listDataExportsHandler(w, r, db)
+	case http.MethodPost:
+		startDataExportHandler(w, r, db)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func startDataExportHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireBrowserSession(w, r, db)
+	if !ok {
+		return
+	}
+	var out dataExportItem
+	err := db.QueryRow(`
+		INSERT INTO data_exports (user_id)
+		SELECT $1::uuid
+		WHERE NOT EXISTS (SELECT 1 FROM data_exports WHERE user_id=$1::uuid AND status='pending')
+		RETURNING id, status, created_at
+	`, sess.UserID).Scan(&out.ID, &out.Status, &out.CreatedAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "an export is already in progress", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "insert failed", http.StatusInternalServerError)
+		return
+	}
+
+	go runDataExport(db, out.ID, sess.UserID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func listDataExportsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := getSessionFromRequest(r, db)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if sess.TokenID != "" {
+		http.Error(w, "not allowed with an API token", http.StatusForbidden)
+		return
+	}
+	rows, err := db.Query(`
+		SELECT id, status, error, created_at, completed_at, expires_at
+		FROM data_exports
+		WHERE user_id=$1
+		ORDER BY created_at DESC
+		LIMIT 20
+	`, sess.UserID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	items := make([]dataExportItem, 0)
+	for rows.Next() {
+		var e dataExportItem
+		var errMsg sql.NullString
+		var completed, expires sql.NullTime
+		if err := rows.Scan(&e.ID, &e.Status, &errMsg, &e.CreatedAt, &completed, &expires); err != nil {
+			continue
+		}
+		if errMsg.Valid {
+			e.Error = &errMsg.String
+		}
+		if completed.Valid {
+			e.CompletedAt = &completed.Time
+		}
+		if expires.Valid {
+			e.ExpiresAt = &expires.Time
+		}
+		if e.Status == "ready" {
+			e.DownloadURL = "/api/me/export/download?id=" + e.ID
+		}
+		items = append(items, e)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+// ---- GET /api/me/export/download?id=... ----
+
+func downloadDataExportHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := getSessionFromRequest(r, db)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if sess.TokenID != "" {
+		http.Error(w, "not allowed with an API token", http.StatusForbidden)
+		return
+	}
+	var path string
+	var created time.Time
+	err := db.QueryRow(`
+		SELECT file_path, created_at FROM data_exports
+		WHERE id=$1 AND user_id=$2 AND status='ready' AND expires_at > NOW()
+	`, r.URL.Query().Get("id"), sess.UserID).Scan(&path, &created)
+	if err != nil {
+		http.Error(w, "export not found or expired", http.StatusNotFound)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "export file missing", http.StatusGone)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="task-manager-export-`+created.Format("2006-01-02")+`.zip"`)
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, "", created, f)
+}
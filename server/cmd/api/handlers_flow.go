@@ -0,0 +1,443 @@
+// handlers_flow.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ---- flow history and metrics ----
+// Every time a task lands in a list (created there, moved, copied, spawned)
+// a task_transitions row records from/to list and their categories. Metrics
+// read lists' categories: a task starts (cycle time) when it first enters an
+// active list and finishes when it enters a done list; lead time runs from
+// creation. Trashed tasks are left out; archived ones count until archived.
+//
+// GET /api/flow/history?task_id=...                               → transitions, oldest first
+// GET /api/flow/metrics?board_id=...&from=&to=&tz=                → lead/cycle time, weekly throughput
+// GET /api/flow/cfd?board_id=...&from=&to=&tz=&group=category|list → cumulative flow, one count per day
+
+// execer is satisfied by *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// recordTransition notes that taskID arrived in toListID. fromListID is ""
+// for a task that is new to the board's flow; userID may be "" for moves
+// the system makes.
+func recordTransition(q execer, taskID, fromListID, toListID, userID string) error {
+	var from, by any
+	if fromListID != "" {
+		from = fromListID
+	}
+	if userID != "" {
+		by = userID
+	}
+	_, err := q.Exec(`
+		INSERT INTO task_transitions (task_id, board_id, from_list_id, to_list_id, from_category, to_category, moved_by)
+		SELECT $1::uuid, l.board_id, $2::uuid, l.id, (SELECT category FROM lists WHERE id = $2::uuid), l.category, $4::uuid
+		FROM lists l WHERE l.id = $3
+	`, taskID, from, toListID, by)
+	return err
+}
+
+// ---- history ----
+
+type TransitionDTO struct {
+	ID           string    `json:"id"`
+	BoardID      string    `json:"board_id"`
+	FromListID   *string   `json:"from_list_id"`
+	FromListName *string   `json:"from_list_name"`
+	FromCategory *string   `json:"from_category"`
+	ToListID     *string   `json:"to_list_id"`
+	ToListName   *string   `json:"to_list_name"`
+	ToCategory   string    `json:"to_category"`
+	MovedBy      *string   `json:"moved_by"`
+	MovedAt      time.Time `json:"moved_at"`
+}
+
+func taskHistoryHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := getSessionFromRequest(r, db)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID := r.URL.Query().Get("task_id")
+	if taskID == "" || !canAccessTask(db, sess, taskID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+	rows, err := db.Query(`
+		SELECT tr.id, tr.board_id, tr.from_list_id, fl.name, tr.from_category, tr.to_list_id, tl.name, tr.to_category, tr.moved_by, tr.moved_at
+		FROM task_transitions tr
+		LEFT JOIN lists fl ON fl.id = tr.from_list_id
+		LEFT JOIN lists tl ON tl.id = tr.to_list_id
+		WHERE tr.task_id = $1
+		ORDER BY tr.moved_at ASC
+	`, taskID)
+	if err != nil {
+		http.Error(w, "history query failed", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	out := make([]TransitionDTO, 0)
+	for rows.Next() {
+		var t TransitionDTO
+		var fromID, fromName, fromCat, toID, toName, by sql.NullString
+		if err := rows.Scan(&t.ID, &t.BoardID, &fromID, &fromName, &fromCat, &toID, &toName, &t.ToCategory, &by, &t.MovedAt); err != nil {
+			continue
+		}
+		for _, p := range []struct {
+			src sql.NullString
+			dst **string
+		}{{fromID, &t.FromListID}, {fromName, &t.FromListName}, {fromCat, &t.FromCategory}, {toID, &t.ToListID}, {toName, &t.ToListName}, {by, &t.MovedBy}} {
+			if p.src.Valid {
+				s := p.src.String
+				*p.dst = &s
+			}
+		}
+		out = append(out, t)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// ---- shared report params ----
+
+type flowRange struct {
+	boardID, from, to, tz string
+	loc                   *time.Location
+	fromD, toD            time.Time
+}
+
+// parseFlowRange reads board_id, from, to (default: the last 30 days) and tz
+// like /api/time-report, and checks board access. It writes the error itself.
+func parseFlowRange(w http.ResponseWriter, r *http.Request, db *sql.DB) (flowRange, bool) {
+	var fr flowRange
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return fr, false
+	}
+	sess, ok := getSessionFromRequest(r, db)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return fr, false
+	}
+	q := r.URL.Query()
+	fr.boardID = q.Get("board_id")
+	if fr.boardID == "" || !canAccessBoard(db, sess, fr.boardID) {
+		http.Error(w, "board not found or forbidden", http.StatusNotFound)
+		return fr, false
+	}
+	fr.tz = q.Get("tz")
+	if fr.tz == "" {
+		fr.tz = "UTC"
+	}
+	var err error
+	if fr.loc, err = time.LoadLocation(fr.tz); err != nil {
+		http.Error(w, "unknown tz", http.StatusBadRequest)
+		return fr, false
+	}
+	fr.from, fr.to = q.Get("from"), q.Get("to")
+	if fr.to == "" {
+		fr.to = time.Now().In(fr.loc).Format(dateLayout)
+	}
+	if fr.from == "" {
+		t, _ := time.Parse(dateLayout, fr.to)
+		fr.from = t.AddDate(0, 0, -29).Format(dateLayout)
+	}
+	var err1, err2 error
+	fr.fromD, err1 = time.Parse(dateLayout, fr.from)
+	fr.toD, err2 = time.Parse(dateLayout, fr.to)
+	if err1 != nil || err2 != nil || fr.toD.Before(fr.fromD) || fr.toD.Sub(fr.fromD) > 366*24*time.Hour {
+		http.Error(w, "from/to must be YYYY-MM-DD, in order, at most a year apart", http.StatusBadRequest)
+		return fr, false
+	}
+	return fr, true
+}
+
+// ---- lead time, cycle time, throughput ----
+
+type FlowItemDTO struct {
+	TaskID    string     `json:"task_id"`
+	Title     string     `json:"title"`
+	DoneAt    time.Time  `json:"done_at"`
+	LeadDays  float64    `json:"lead_days"`
+	CycleDays *float64   `json:"cycle_days"` // nil when it never went through an active list
+	StartedAt *time.Time `json:"started_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type DurationStatsDTO struct {
+	Count  int     `json:"count"`
+	Mean   float64 `json:"mean_days"`
+	Median float64 `json:"median_days"`
+	P85    float64 `json:"p85_days"`
+	Max    float64 `json:"max_days"`
+}
+
+type ThroughputWeekDTO struct {
+	WeekStart string `json:"week_start"` // Monday
+	Count     int    `json:"count"`
+}
+
+type flowMetricsResp struct {
+	BoardID    string              `json:"board_id"`
+	From       string              `json:"from"`
+	To         string              `json:"to"`
+	TZ         string              `json:"tz"`
+	LeadTime   DurationStatsDTO    `json:"lead_time"`
+	CycleTime  DurationStatsDTO    `json:"cycle_time"`
+	Throughput []ThroughputWeekDTO `json:"throughput"`
+	Items      []FlowItemDTO       `json:"items"` // completions in the range, oldest first
+}
+
+func flowMetricsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	fr, ok := parseFlowRange(w, r, db)
+	if !ok {
+		return
+	}
+
+	// each task counts once: its last arrival in a done list within the range
+	rows, err := db.Query(`
+		WITH done AS (
+		  SELECT DISTINCT ON (tr.task_id) tr.task_id, tr.moved_at AS done_at
+		  FROM task_transitions tr JOIN tasks t ON t.id = tr.task_id
+		  WHERE tr.board_id = $1 AND tr.to_category = 'done' AND tr.from_category IS DISTINCT FROM 'done'
+		    AND tr.moved_at >= ($2::date)::timestamp AT TIME ZONE $4
+		    AND tr.moved_at < ($3::date + 1)::timestamp AT TIME ZONE $4
+		    AND t.deleted_at IS NULL
+		  ORDER BY tr.task_id, tr.moved_at DESC
+		)
+		SELECT d.task_id, t.title, d.done_at, t.created_at,
+		       (SELECT MIN(a.moved_at) FROM task_transitions a
+		        WHERE a.task_id = d.task_id AND a.to_category = 'active' AND a.moved_at <= d.done_at)
+		FROM done d JOIN tasks t ON t.id = d.task_id
+		ORDER BY d.done_at ASC
+	`, fr.boardID, fr.from, fr.to, fr.tz)
+	if err != nil {
+		log.Println("flow metrics:", err)
+		http.Error(w, "metrics query failed", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	out := flowMetricsResp{BoardID: fr.boardID, From: fr.from, To: fr.to, TZ: fr.tz, Items: make([]FlowItemDTO, 0)}
+	lead := make([]float64, 0)
+	cycle := make([]float64, 0)
+	perWeek := make(map[string]int)
+	for rows.Next() {
+		var it FlowItemDTO
+		var started sql.NullTime
+		if err := rows.Scan(&it.TaskID, &it.Title, &it.DoneAt, &it.CreatedAt, &started); err != nil {
+			continue
+		}
+		it.LeadDays = days(it.DoneAt.Sub(it.CreatedAt))
+		lead = append(lead, it.LeadDays)
+		if started.Valid {
+			c := days(it.DoneAt.Sub(started.Time))
+			it.CycleDays, it.StartedAt = &c, &started.Time
+			cycle = append(cycle, c)
+		}
+		perWeek[weekStart(it.DoneAt.In(fr.loc)).Format(dateLayout)]++
+		out.Items = append(out.Items, it)
+	}
+	out.LeadTime = durationStats(lead)
+	out.CycleTime = durationStats(cycle)
+
+	// every week touching the range, empty ones included
+	out.Throughput = make([]ThroughputWeekDTO, 0)
+	for wk := weekStart(fr.fromD); !wk.After(fr.toD); wk = wk.AddDate(0, 0, 7) {
+		k := wk.Format(dateLayout)
+		out.Throughput = append(out.Throughput, ThroughputWeekDTO{WeekStart: k, Count: perWeek[k]})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// days is d in days, to two decimals.
+func days(d time.Duration) float64 {
+	return math.Round(d.Hours()/24*100) / 100
+}
+
+// weekStart is the Monday of t's week, as a date.
+func weekStart(t time.Time) time.Time {
+	d := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7))
+}
+
+// durationStats uses nearest-rank percentiles.
+func durationStats(v []float64) DurationStatsDTO {
+	s := DurationStatsDTO{Count: len(v)}
+	if len(v) == 0 {
+		return s
+	}
+	sorted := append([]float64(nil), v...)
+	sort.Float64s(sorted)
+	sum := 0.0
+	for _, x := range sorted {
+		sum += x
+	}
+	rank := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		return sorted[min(max(i, 0), len(sorted)-1)]
+	}
+	s.Mean = math.Round(sum/float64(len(sorted))*100) / 100
+	s.Median = rank(0.5)
+	s.P85 = rank(0.85)
+	s.Max = sorted[len(sorted)-1]
+	return s
+}
+
+// ---- cumulative flow ----
+
+type CFDSeriesDTO struct {
+	Key      string  `json:"key"` // category, list id, or deleted:<category> for lists since deleted
+	ListID   *string `json:"list_id,omitempty"`
+	Name     string  `json:"name"`
+	Category string  `json:"category"`
+	Counts   []int   `json:"counts"` // one per day
+}
+
+type cfdResp struct {
+	BoardID string         `json:"board_id"`
+	Group   string         `json:"group"`
+	Days    []string       `json:"days"`
+	Series  []CFDSeriesDTO `json:"series"` // done first, then active, then backlog: bottom to top
+}
+
+var categoryStackOrder = map[string]int{"done": 0, "active": 1, "backlog": 2}
+
+func flowCFDHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	fr, ok := parseFlowRange(w, r, db)
+	if !ok {
+		return
+	}
+	group := r.URL.Query().Get("group")
+	if group == "" {
+		group = "category"
+	}
+	if group != "category" && group != "list" {
+		http.Error(w, "group must be category or list", http.StatusBadRequest)
+		return
+	}
+
+	// Each transition holds from its moved_at until the task's next
+	// transition (or its archiving); a day counts where the task was at the
+	// end of it.
+	rows, err := db.Query(`
+		WITH tr AS (
+		  SELECT x.board_id, x.to_list_id, x.to_category, x.moved_at,
+		         LEAST(LEAD(x.moved_at) OVER (PARTITION BY x.task_id ORDER BY x.moved_at, x.id), t.archived_at) AS until
+		  FROM task_transitions x JOIN tasks t ON t.id = x.task_id
+		  WHERE t.deleted_at IS NULL
+		    AND x.task_id IN (SELECT task_id FROM task_transitions WHERE board_id = $1)
+		), days AS (
+		  SELECT d::date AS day, (d::date + 1)::timestamp AT TIME ZONE $4 AS day_end
+		  FROM generate_series($2::date, $3::date, INTERVAL '1 day') d
+		)
+		SELECT days.day, tr.to_list_id, tr.to_category, COUNT(*)
+		FROM days JOIN tr ON tr.board_id = $1 AND tr.moved_at < days.day_end AND (tr.until IS NULL OR tr.until >= days.day_end)
+		GROUP BY 1, 2, 3
+	`, fr.boardID, fr.from, fr.to, fr.tz)
+	if err != nil {
+		log.Println("flow cfd:", err)
+		http.Error(w, "cfd query failed", http.StatusInternalServerError)
+		return
+	}
+
+	out := cfdResp{BoardID: fr.boardID, Group: group, Days: make([]string, 0)}
+	index := make(map[string]int)
+	for d := fr.fromD; !d.After(fr.toD); d = d.AddDate(0, 0, 1) {
+		index[d.Format(dateLayout)] = len(out.Days)
+		out.Days = append(out.Days, d.Format(dateLayout))
+	}
+	series := make(map[string]*CFDSeriesDTO)
+	get := func(key, category string) *CFDSeriesDTO {
+		s, ok := series[key]
+		if !ok {
+			s = &CFDSeriesDTO{Key: key, Name: category, Category: category, Counts: make([]int, len(out.Days))}
+			series[key] = s
+		}
+		return s
+	}
+	for _, c := range []string{"done", "active", "backlog"} {
+		if group == "category" {
+			get(c, c)
+		}
+	}
+	for rows.Next() {
+		var day time.Time
+		var listID sql.NullString
+		var category string
+		var n int
+		if err := rows.Scan(&day, &listID, &category, &n); err != nil {
+			continue
+		}
+		key := category
+		if group == "list" {
+			key = "deleted:" + category
+			if listID.Valid {
+				key = listID.String
+			}
+		}
+		s := get(key, category)
+		if group == "list" && listID.Valid {
+			s.ListID = &listID.String
+		}
+		s.Counts[index[day.Format(dateLayout)]] += n
+	}
+	rows.Close()
+
+	// list series take the list's current name and category; positions order
+	// lists within a category
+	position := make(map[string]int)
+	if group == "list" {
+		lrows, err := db.Query(`SELECT id, name, category, position FROM lists WHERE board_id=$1`, fr.boardID)
+		if err == nil {
+			for lrows.Next() {
+				var id, name, category string
+				var pos int
+				if err := lrows.Scan(&id, &name, &category, &pos); err != nil {
+					continue
+				}
+				position[id] = pos
+				if s, ok := series[id]; ok {
+					s.Name, s.Category = name, category
+				}
+			}
+			lrows.Close()
+		}
+		for _, c := range []string{"done", "active", "backlog"} {
+			if s, ok := series["deleted:"+c]; ok {
+				s.Name = "(deleted " + c + " lists)"
+			}
+		}
+	}
+
+	out.Series = make([]CFDSeriesDTO, 0, len(series))
+	for _, s := range series {
+		out.Series = append(out.Series, *s)
+	}
+	sort.Slice(out.Series, func(i, j int) bool {
+		a, b := out.Series[i], out.Series[j]
+		if categoryStackOrder[a.Category] != categoryStackOrder[b.Category] {
+			return categoryStackOrder[a.Category] < categoryStackOrder[b.Category]
+		}
+		// later lists sit lower in the stack, nearer to done
+		return position[a.Key] > position[b.Key]
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,470 @@
+// handlers_lanes.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ---- swimlanes ----
+// boards.lane_mode picks how a board is split horizontally:
+//
+//	none      no lanes
+//	manual    board_lanes, tasks.lane_id picks one (NULL = no lane)
+//	assignee  one lane per workspace member, by a task's first assignee
+//	field     one lane per value of boards.lane_field_id (select, user or checkbox)
+//
+// Every mode ends with a "" lane for tasks that fit nowhere else.
+
+var laneModes = map[string]bool{"none": true, "manual": true, "assignee": true, "field": true}
+
+// laneFieldTypes can group tasks: each task has at most one value.
+var laneFieldTypes = map[string]bool{"select": true, "user": true, "checkbox": true}
+
+const maxLanesPerBoard = 50
+
+type LaneDTO struct {
+	ID       string `json:"id"`
+	BoardID  string `json:"board_id"`
+	Name     string `json:"name"`
+	Position int    `json:"position"`
+}
+
+// BoardLaneDTO is one row of the board grid; Key is a lane id, user id or
+// field value depending on the mode.
+type BoardLaneDTO struct {
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+// LaneGroupDTO holds one list's tasks in one lane.
+type LaneGroupDTO struct {
+	Key   string    `json:"key"`
+	Tasks []TaskDTO `json:"tasks"`
+}
+
+// boardLanes lists the lanes of a board in display order, "" last.
+func boardLanes(db *sql.DB, boardID, workspaceID, mode string, fieldID *string, fields []CustomFieldDTO) ([]BoardLaneDTO, error) {
+	lanes := make([]BoardLaneDTO, 0)
+	members := func() error {
+		rows, err := db.Query(`
+			SELECT u.id, u.name FROM workspace_members m JOIN users u ON u.id = m.user_id
+			WHERE m.workspace_id = $1
+			ORDER BY u.name ASC
+		`, workspaceID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var l BoardLaneDTO
+			if err := rows.Scan(&l.Key, &l.Name); err == nil {
+				lanes = append(lanes, l)
+			}
+		}
+		return rows.Err()
+	}
+
+	switch mode {
+	case "manual":
+		rows, err := db.Query(`SELECT id, name FROM board_lanes WHERE board_id=$1 ORDER BY position ASC`, boardID)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var l BoardLaneDTO
+			if err := rows.Scan(&l.Key, &l.Name); err == nil {
+				lanes = append(lanes, l)
+			}
+		}
+		rows.Close()
+		lanes = append(lanes, BoardLaneDTO{Key: "", Name: "No lane"})
+	case "assignee":
+		if err := members(); err != nil {
+			return nil, err
+		}
+		lanes = append(lanes, BoardLaneDTO{Key: "", Name: "Unassigned"})
+	case "field":
+		var f *CustomFieldDTO
+		for i := range fields {
+			if fieldID != nil && fields[i].ID == *fieldID {
+				f = &fields[i]
+			}
+		}
+		if f == nil {
+			return lanes, nil // field was deleted; the board shows no lanes
+		}
+		switch f.Type {
+		case "select":
+			for _, o := range f.Options {
+				lanes = append(lanes, BoardLaneDTO{Key: o, Name: o})
+			}
+		case "user":
+			if err := members(); err != nil {
+				return nil, err
+			}
+		case "checkbox":
+			lanes = append(lanes, BoardLaneDTO{Key: "true", Name: f.Name})
+		}
+		lanes = append(lanes, BoardLaneDTO{Key: "", Name: "No " + f.Name})
+	}
+	return lanes, nil
+}
+
+// taskLaneKey says which lane a task falls in; keys not among the board's
+// lanes are mapped to "" by the caller.
+func taskLaneKey(t TaskDTO, mode string, fieldID *string) string {
+	switch mode {
+	case "manual":
+		if t.LaneID != nil {
+			return *t.LaneID
+		}
+	case "assignee":
+		if len(t.Assignees) > 0 {
+			return t.Assignees[0]
+		}
+	case "field":
+		if fieldID == nil {
+			return ""
+		}
+		raw, ok := t.CustomFields[*fieldID]
+		if !ok {
+			return ""
+		}
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			return s
+		}
+		var b bool
+		if json.Unmarshal(raw, &b) == nil && b {
+			return "true"
+		}
+	}
+	return ""
+}
+
+// groupByLane splits one list's tasks (already in order) across lanes.
+func groupByLane(tasks []TaskDTO, lanes []BoardLaneDTO, mode string, fieldID *string) []LaneGroupDTO {
+	groups := make([]LaneGroupDTO, len(lanes))
+	index := make(map[string]int, len(lanes))
+	for i, l := range lanes {
+		groups[i] = LaneGroupDTO{Key: l.Key, Tasks: make([]TaskDTO, 0)}
+		index[l.Key] = i
+	}
+	for _, t := range tasks {
+		i, ok := index[taskLaneKey(t, mode, fieldID)]
+		if !ok {
+			i = index[""]
+		}
+		groups[i].Tasks = append(groups[i].Tasks, t)
+	}
+	return groups
+}
+
+// laneOnListBoard reports whether laneID is a manual lane on the board that
+// holds listID.
+func laneOnListBoard(q queryer, laneID, listID string) bool {
+	var ok bool
+	err := q.QueryRow(`
+		SELECT EXISTS(
+		  SELECT 1 FROM board_lanes bl JOIN lists l ON l.board_id = bl.board_id
+		  WHERE bl.id = $1 AND l.id = $2
+		)`, laneID, listID).Scan(&ok)
+	return err == nil && ok
+}
+
+// moveToLane puts a task, already moved to listID, into the lane with key.
+// Manual lanes set tasks.lane_id. Assignee lanes make the member the first
+// assignee in place of whoever's lane the task left; "" unassigns everyone.
+// Field lanes set the lane field's value; "" clears it. A non-empty problem
+// is the caller's 400.
+func moveToLane(tx *sql.Tx, taskID, listID, key string) (problem string, err error) {
+	var mode string
+	var fieldID, fieldType sql.NullString
+	if err := tx.QueryRow(`
+		SELECT b.lane_mode, b.lane_field_id, f.type
+		FROM lists l
+		JOIN boards b ON b.id = l.board_id
+		LEFT JOIN board_custom_fields f ON f.id = b.lane_field_id
+		WHERE l.id = $1
+	`, listID).Scan(&mode, &fieldID, &fieldType); err != nil {
+		return "", err
+	}
+
+	switch mode {
+	case "assignee":
+		if key == "" {
+			_, err = tx.Exec(`DELETE FROM task_assignees WHERE task_id=$1`, taskID)
+			return "", err
+		}
+		if !isTaskWorkspaceMember(tx, taskID, key) {
+			return "lane user is not a member of this board's workspace", nil
+		}
+		if _, err := tx.Exec(`
+			DELETE FROM task_assignees
+			WHERE task_id = $1 AND user_id IN (
+			  $2::uuid,
+			  (SELECT user_id FROM task_assignees WHERE task_id = $1 ORDER BY assigned_at ASC LIMIT 1)
+			)
+		`, taskID, key); err != nil {
+			return "", err
+		}
+		// lanes follow the oldest assignment, so this one goes in first
+		_, err = tx.Exec(`
+			INSERT INTO task_assignees (task_id, user_id, assigned_at)
+			SELECT $1::uuid, $2::uuid, LEAST(NOW(), MIN(assigned_at) - interval '1 millisecond')
+			FROM task_assignees WHERE task_id = $1
+		`, taskID, key)
+		return "", err
+	case "field":
+		if !fieldID.Valid || !fieldType.Valid {
+			return "board lanes have no field", nil
+		}
+		raw := json.RawMessage("null")
+		switch {
+		case key == "":
+		case fieldType.String == "checkbox" && key == "true":
+			raw = json.RawMessage("true")
+		case fieldType.String == "checkbox":
+			return "unknown lane " + strconv.Quote(key), nil
+		default:
+			raw, _ = json.Marshal(key)
+		}
+		return bulkLabel(tx, taskID, fieldID.String, raw)
+	}
+
+	// manual, or none: keep the lane for when the board shows manual lanes
+	var lane any
+	if key != "" {
+		if !laneOnListBoard(tx, key, listID) {
+			return "lane is not on the destination board", nil
+		}
+		lane = key
+	}
+	_, err = tx.Exec(`UPDATE tasks SET lane_id=$1, updated_at=NOW() WHERE id=$2`, lane, taskID)
+	return "", err
+}
+
+// ---- /api/lanes ----
+// GET ?board_id=...                    → manual lane definitions
+// POST { board_id, name }              → new lane at the bottom
+// PATCH ?id=... { name?, position? }   → rename / move (others shift)
+// DELETE ?id=...                       → remove; its tasks drop to "no lane"
+
+func lanesHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	switch r.Method {
+	case http.MethodGet:
+		listLanesHandler(w, r, db)
+	case http.MethodPost:
+		createLaneHandler(w, r, db)
+	case http.MethodPatch:
+		updateLaneHandler(w, r, db)
+	case http.MethodDelete:
+		deleteLaneHandler(w, r, db)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listLanesHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := getSessionFromRequest(r, db)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	boardID := r.URL.Query().Get("board_id")
+	if boardID == "" {
+		http.Error(w, "missing board_id", http.StatusBadRequest)
+		return
+	}
+	if !canAccessBoard(db, sess, boardID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+	rows, err := db.Query(`SELECT id, board_id, name, position FROM board_lanes WHERE board_id=$1 ORDER BY position ASC`, boardID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	lanes := make([]LaneDTO, 0)
+	for rows.Next() {
+		var l LaneDTO
+		if err := rows.Scan(&l.ID, &l.BoardID, &l.Name, &l.Position); err == nil {
+			lanes = append(lanes, l)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(lanes)
+}
+
+type createLaneReq struct {
+	BoardID string `json:"board_id"`
+	Name    string `json:"name"`
+}
+
+func createLaneHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	var req createLaneReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.BoardID == "" || req.Name == "" {
+		http.Error(w, "missing fields", http.StatusBadRequest)
+		return
+	}
+	if !canAccessBoard(db, sess, req.BoardID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	var count int
+	_ = db.QueryRow(`SELECT COUNT(*) FROM board_lanes WHERE board_id=$1`, req.BoardID).Scan(&count)
+	if count >= maxLanesPerBoard {
+		http.Error(w, "too many lanes on this board", http.StatusBadRequest)
+		return
+	}
+
+	out := LaneDTO{BoardID: req.BoardID, Name: req.Name, Position: count}
+	if err := db.QueryRow(`
+		INSERT INTO board_lanes (board_id, name, position) VALUES ($1,$2,$3) RETURNING id
+	`, req.BoardID, req.Name, count).Scan(&out.ID); err != nil {
+		http.Error(w, "insert failed", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+type updateLaneReq struct {
+	Name     *string `json:"name,omitempty"`
+	Position *int    `json:"position,omitempty"`
+}
+
+func updateLaneHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	var req updateLaneReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if req.Name == nil && req.Position == nil {
+		http.Error(w, "nothing to update", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var l LaneDTO
+	if err := tx.QueryRow(`
+		SELECT id, board_id, name, position FROM board_lanes WHERE id=$1 FOR UPDATE
+	`, id).Scan(&l.ID, &l.BoardID, &l.Name, &l.Position); err != nil || !canAccessBoard(tx, sess, l.BoardID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			http.Error(w, "name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		if _, err := tx.Exec(`UPDATE board_lanes SET name=$2 WHERE id=$1`, id, name); err != nil {
+			http.Error(w, "update failed", http.StatusBadRequest)
+			return
+		}
+		l.Name = name
+	}
+
+	if req.Position != nil && *req.Position != l.Position {
+		// re-sequence the board's lanes with this one at the new index
+		rows, err := tx.Query(`SELECT id FROM board_lanes WHERE board_id=$1 AND id<>$2 ORDER BY position ASC`, l.BoardID, id)
+		if err != nil {
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			return
+		}
+		order := make([]string, 0)
+		for rows.Next() {
+			var other string
+			if err := rows.Scan(&other); err == nil {
+				order = append(order, other)
+			}
+		}
+		rows.Close()
+		to := min(max(*req.Position, 0), len(order))
+		order = append(order[:to], append([]string{id}, order[to:]...)...)
+		for i, laneID := range order {
+			if _, err := tx.Exec(`UPDATE board_lanes SET position=$2 WHERE id=$1`, laneID, i); err != nil {
+				http.Error(w, "update failed", http.StatusBadRequest)
+				return
+			}
+		}
+		l.Position = to
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(l)
+}
+
+func deleteLaneHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	var boardID string
+	if err := db.QueryRow(`SELECT board_id FROM board_lanes WHERE id=$1`, id).Scan(&boardID); err != nil || !canAccessBoard(db, sess, boardID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var pos int
+	if err := tx.QueryRow(`DELETE FROM board_lanes WHERE id=$1 RETURNING position`, id).Scan(&pos); err != nil {
+		http.Error(w, "delete failed", http.StatusBadRequest)
+		return
+	}
+	if _, err := tx.Exec(`UPDATE board_lanes SET position = position - 1 WHERE board_id=$1 AND position > $2`, boardID, pos); err != nil {
+		http.Error(w, "delete failed", http.StatusBadRequest)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
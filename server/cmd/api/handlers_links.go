@@ -0,0 +1,233 @@
+// handlers_links.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// ---- task links ----
+// from --blocks--> to means "to can't finish until from is done".
+// duplicates and relates are informational; only blocks is checked for cycles.
+
+var taskLinkTypes = map[string]bool{"blocks": true, "duplicates": true, "relates": true}
+
+type TaskLinkDTO struct {
+	ID         string    `json:"id"`
+	FromTaskID string    `json:"from_task_id"`
+	ToTaskID   string    `json:"to_task_id"`
+	Type       string    `json:"type"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Seen from the requested task: "outgoing" when it is from_task_id.
+	Direction string         `json:"direction,omitempty"`
+	Other     TaskSummaryDTO `json:"other"`
+}
+
+// taskBlocked reports whether any task blocking taskID is not yet done.
+// A trashed blocker no longer blocks.
+func taskBlocked(q queryer, taskID string) bool {
+	var blocked bool
+	_ = q.QueryRow(`
+		SELECT EXISTS(
+		  SELECT 1 FROM task_links k
+		  JOIN tasks t ON t.id = k.from_task_id
+		  JOIN lists l ON l.id = t.list_id
+		  WHERE k.to_task_id = $1 AND k.type = 'blocks' AND l.category <> 'done' AND t.deleted_at IS NULL
+		)`, taskID).Scan(&blocked)
+	return blocked
+}
+
+// ---- /api/task-links ----
+// GET ?task_id=...                       → links in both directions
+// POST { from_task_id, to_task_id, type } → create
+// DELETE ?id=...                         → remove
+
+func taskLinksHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	switch r.Method {
+	case http.MethodGet:
+		listTaskLinksHandler(w, r, db)
+	case http.MethodPost:
+		createTaskLinkHandler(w, r, db)
+	case http.MethodDelete:
+		deleteTaskLinkHandler(w, r, db)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listTaskLinksHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := getSessionFromRequest(r, db)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	taskID := r.URL.Query().Get("task_id")
+	if taskID == "" {
+		http.Error(w, "missing task_id", http.StatusBadRequest)
+		return
+	}
+	if !canAccessTask(db, sess, taskID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT k.id, k.from_task_id, k.to_task_id, k.type, k.created_at,
+		       o.id, o.title, o.list_id, l.board_id, l.category = 'done'
+		FROM task_links k
+		JOIN tasks o ON o.id = CASE WHEN k.from_task_id = $1 THEN k.to_task_id ELSE k.from_task_id END
+		JOIN lists l ON l.id = o.list_id
+		WHERE k.from_task_id = $1 OR k.to_task_id = $1
+		ORDER BY k.type, k.created_at
+	`, taskID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	links := make([]TaskLinkDTO, 0)
+	for rows.Next() {
+		var k TaskLinkDTO
+		if err := rows.Scan(&k.ID, &k.FromTaskID, &k.ToTaskID, &k.Type, &k.CreatedAt,
+			&k.Other.ID, &k.Other.Title, &k.Other.ListID, &k.Other.BoardID, &k.Other.Done); err != nil {
+			continue
+		}
+		k.Direction = "incoming"
+		if k.FromTaskID == taskID {
+			k.Direction = "outgoing"
+		}
+		links = append(links, k)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(links)
+}
+
+type createTaskLinkReq struct {
+	FromTaskID string `json:"from_task_id"`
+	ToTaskID   string `json:"to_task_id"`
+	Type       string `json:"type"`
+}
+
+func createTaskLinkHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	var req createTaskLinkReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.FromTaskID == "" || req.ToTaskID == "" {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if !taskLinkTypes[req.Type] {
+		http.Error(w, "type must be blocks, duplicates or relates", http.StatusBadRequest)
+		return
+	}
+	if req.FromTaskID == req.ToTaskID {
+		http.Error(w, "a task cannot link to itself", http.StatusBadRequest)
+		return
+	}
+	if !canAccessTask(db, sess, req.FromTaskID) || !canAccessTask(db, sess, req.ToTaskID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	fromWS, err1 := taskWorkspaceID(tx, req.FromTaskID)
+	toWS, err2 := taskWorkspaceID(tx, req.ToTaskID)
+	if err1 != nil || err2 != nil {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+	if fromWS != toWS {
+		http.Error(w, "linked tasks must be in the same workspace", http.StatusBadRequest)
+		return
+	}
+
+	if req.Type == "blocks" {
+		// Same reasoning as attachChildHandler: serialise so concurrent inserts
+		// can't close a loop between them.
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('task-links:' || $1))`, fromWS); err != nil {
+			http.Error(w, "lock failed", http.StatusInternalServerError)
+			return
+		}
+		// A cycle exists if "from" is already reachable from "to" via blocks.
+		var cycle bool
+		if err := tx.QueryRow(`
+			WITH RECURSIVE downstream(id) AS (
+			  SELECT $1::uuid
+			  UNION
+			  SELECT k.to_task_id FROM task_links k
+			  JOIN downstream d ON k.from_task_id = d.id
+			  WHERE k.type = 'blocks'
+			)
+			SELECT EXISTS(SELECT 1 FROM downstream WHERE id = $2::uuid)
+		`, req.ToTaskID, req.FromTaskID).Scan(&cycle); err != nil {
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			return
+		}
+		if cycle {
+			http.Error(w, "that would create a dependency cycle", http.StatusConflict)
+			return
+		}
+	}
+
+	var out TaskLinkDTO
+	err = tx.QueryRow(`
+		INSERT INTO task_links (from_task_id, to_task_id, type, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, from_task_id, to_task_id, type, created_at
+	`, req.FromTaskID, req.ToTaskID, req.Type, sess.UserID).Scan(&out.ID, &out.FromTaskID, &out.ToTaskID, &out.Type, &out.CreatedAt)
+	if isUniqueViolation(err) {
+		http.Error(w, "link already exists", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "insert failed", http.StatusBadRequest)
+		return
+	}
+	if err := tx.QueryRow(taskSummarySelect+` WHERE t.id = $1`, req.ToTaskID).
+		Scan(&out.Other.ID, &out.Other.Title, &out.Other.ListID, &out.Other.BoardID, &out.Other.Done); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+	out.Direction = "outgoing"
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func deleteTaskLinkHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	var fromID string
+	if err := db.QueryRow(`SELECT from_task_id FROM task_links WHERE id=$1`, id).Scan(&fromID); err != nil || !canAccessTask(db, sess, fromID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+	if _, err := db.Exec(`DELETE FROM task_links WHERE id=$1`, id); err != nil {
+		http.Error(w, "delete failed", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -5,6 +5,9 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // POST /api/lists/reorder
@@ -19,7 +22,7 @@ func reorderListsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	sess, ok := requireAuthAndCSRF(w, r)
+	sess, ok := requireAuthAndCSRF(w, r, db)
 	if !ok {
 		return
 	}
@@ -31,15 +34,7 @@ func reorderListsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	}
 
 	// ACL: user must be a member of the workspace that owns this board
-	var allowed bool
-	if err := db.QueryRow(`
-		SELECT EXISTS (
-		  SELECT 1
-		  FROM boards b
-		  JOIN workspace_members m ON m.workspace_id = b.workspace_id
-		  WHERE b.id = $1 AND m.user_id = $2
-		)
-	`, req.BoardID, sess.UserID).Scan(&allowed); err != nil || !allowed {
+	if !canAccessBoard(db, sess, req.BoardID) {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
@@ -76,3 +71,195 @@ func reorderListsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	w.Header().Set("Content-Type", "application/json")
 	_, _ = w.Write([]byte(`{"ok":true}`))
 }
+
+// PATCH /api/lists?id=...
+// Body: { "name"?: "...", "category"?: "backlog"|"active"|"done", "wip_limit"?: n|null }
+type updateListReq struct {
+	Name     *string         `json:"name,omitempty"`
+	Category *string         `json:"category,omitempty"`
+	WIPLimit json.RawMessage `json:"wip_limit,omitempty"` // null removes the limit
+}
+
+var listCategories = map[string]bool{"backlog": true, "active": true, "done": true}
+
+// wipExceeded reports whether one more task in listID would take it past its
+// WIP limit, and whether its board rejects such moves instead of flagging them.
+// It locks the list first, so concurrent additions inside their own
+// transactions are counted one after another and can't all squeeze past.
+func wipExceeded(tx *sql.Tx, listID string) (over, reject bool) {
+	var one int
+	if err := tx.QueryRow(`SELECT 1 FROM lists WHERE id=$1 FOR UPDATE`, listID).Scan(&one); err != nil {
+		return false, false
+	}
+	_ = tx.QueryRow(`
+		SELECT l.wip_limit IS NOT NULL AND (
+		         SELECT COUNT(*) FROM tasks t
+		         WHERE t.list_id = l.id AND t.archived_at IS NULL AND t.deleted_at IS NULL
+		       ) >= l.wip_limit,
+		       b.wip_mode = 'reject'
+		FROM lists l JOIN boards b ON b.id = l.board_id
+		WHERE l.id = $1
+	`, listID).Scan(&over, &reject)
+	return over, reject
+}
+
+func updateListHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	var req updateListReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	sets := []string{}
+	args := []any{}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			http.Error(w, "name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		sets = append(sets, "name=$"+strconv.Itoa(len(args)+1))
+		args = append(args, name)
+	}
+	if req.Category != nil {
+		if !listCategories[*req.Category] {
+			http.Error(w, "category must be backlog, active or done", http.StatusBadRequest)
+			return
+		}
+		sets = append(sets, "category=$"+strconv.Itoa(len(args)+1))
+		args = append(args, *req.Category)
+	}
+	if len(req.WIPLimit) > 0 {
+		var limit *int
+		if err := json.Unmarshal(req.WIPLimit, &limit); err != nil || (limit != nil && *limit < 1) {
+			http.Error(w, "wip_limit must be a positive integer or null", http.StatusBadRequest)
+			return
+		}
+		sets = append(sets, "wip_limit=$"+strconv.Itoa(len(args)+1))
+		args = append(args, limit)
+	}
+	if len(sets) == 0 {
+		http.Error(w, "nothing to update", http.StatusBadRequest)
+		return
+	}
+
+	if !canAccessList(db, sess, id) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	args = append(args, id)
+	var out ListDTO
+	if err := db.QueryRow(`
+		UPDATE lists SET `+strings.Join(sets, ", ")+`
+		WHERE id=$`+strconv.Itoa(len(args))+`
+		RETURNING id, name, position, category, wip_limit
+	`, args...).Scan(&out.ID, &out.Name, &out.Position, &out.Category, &out.WIPLimit); err != nil {
+		http.Error(w, "update failed", http.StatusBadRequest)
+		return
+	}
+	out.Tasks = make([]TaskDTO, 0)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// POST /api/lists/sort
+// Body: { "list_id": "...", "by": "priority"|"due_date"|"created_at", "desc"?: bool }
+// Re-sequences positions 0..n-1 once; later drags work as usual. Defaults put
+// the most urgent, soonest-due and oldest tasks first; ties keep their current order.
+type sortListReq struct {
+	ListID string `json:"list_id"`
+	By     string `json:"by"`
+	Desc   *bool  `json:"desc,omitempty"`
+}
+
+var listSortKeys = map[string]struct {
+	expr string
+	desc bool // default direction
+}{
+	"priority":   {priorityRankSQL, true},
+	"due_date":   {"t.due_date", false},
+	"created_at": {"t.created_at", false},
+}
+
+func sortListHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+
+	var req sortListReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ListID == "" {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	key, ok := listSortKeys[req.By]
+	if !ok {
+		http.Error(w, "by must be priority, due_date or created_at", http.StatusBadRequest)
+		return
+	}
+	desc := key.desc
+	if req.Desc != nil {
+		desc = *req.Desc
+	}
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+
+	if !canAccessList(db, sess, req.ListID) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	rows, err := db.Query(`
+		UPDATE tasks t SET position = s.rn - 1, updated_at = NOW()
+		FROM (
+		  SELECT t.id, ROW_NUMBER() OVER (ORDER BY `+key.expr+` `+dir+` NULLS LAST, t.position ASC) AS rn
+		  FROM tasks t WHERE t.list_id = $1 AND t.archived_at IS NULL AND t.deleted_at IS NULL
+		) s
+		WHERE t.id = s.id
+		RETURNING t.id, t.position
+	`, req.ListID)
+	if err != nil {
+		http.Error(w, "sort failed", http.StatusBadRequest)
+		return
+	}
+	defer rows.Close()
+
+	type item struct {
+		ID       string `json:"id"`
+		Position int    `json:"position"`
+	}
+	items := make([]item, 0)
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.ID, &it.Position); err == nil {
+			items = append(items, it)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Position < items[j].Position })
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"list_id": req.ListID, "tasks": items})
+}
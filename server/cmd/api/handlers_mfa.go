@@ -0,0 +1,541 @@
+// handlers_mfa.go
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---- TOTP (RFC 6238: HMAC-SHA1, 6 digits, 30s step) ----
+
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	totpSkew   = 1 // accept one step before/after to absorb clock drift
+)
+
+var b32NoPad = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func generateTOTPSecret() (string, error) {
+	b := make([]byte, 20) // 160 bits, as recommended by RFC 4226
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return b32NoPad.EncodeToString(b), nil
+}
+
+// hotp computes the RFC 4226 code for a counter value.
+func hotp(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, bin%1_000_000)
+}
+
+// matchTOTP returns the time step the code matches, if any, within the skew window.
+// Steps at or before lastStep are rejected so a code can't be replayed.
+func matchTOTP(secret, code string, lastStep int64, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	key, err := b32NoPad.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+	cur := now.Unix() / totpPeriod
+	for step := cur - totpSkew; step <= cur+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if hmac.Equal([]byte(hotp(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func otpauthURI(account, secret string) string {
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "Task Manager"
+	}
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + v.Encode()
+}
+
+// ---- recovery codes ----
+
+const recoveryCodeCount = 10
+
+// newRecoveryCodes returns codes like "k7q2m-x9dfa". They carry 50 bits of
+// entropy each, so a plain SHA-256 is enough for storage.
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(b32NoPad.EncodeToString(b))[:10]
+		codes = append(codes, s[:5]+"-"+s[5:])
+	}
+	return codes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	norm := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(norm))
+	return hex.EncodeToString(sum[:])
+}
+
+// replaceRecoveryCodes drops any existing codes for the user and stores a fresh set.
+func replaceRecoveryCodes(tx *sql.Tx, userID string) ([]string, error) {
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id=$1`, userID); err != nil {
+		return nil, err
+	}
+	for _, c := range codes {
+		if _, err := tx.Exec(`INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1,$2)`, userID, hashRecoveryCode(c)); err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// verifySecondFactor checks either a TOTP code or an unused recovery code for
+// a user with 2FA enabled, consuming whichever one matched.
+func verifySecondFactor(db *sql.DB, userID, code, recoveryCode string) (bool, error) {
+	if strings.TrimSpace(recoveryCode) != "" {
+		res, err := db.Exec(`
+			UPDATE user_recovery_codes SET used_at=NOW()
+			WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL
+		`, userID, hashRecoveryCode(recoveryCode))
+		if err != nil {
+			return false, err
+		}
+		n, _ := res.RowsAffected()
+		return n > 0, nil
+	}
+
+	var secret sql.NullString
+	var enabled bool
+	var lastStep int64
+	if err := db.QueryRow(
+		`SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id=$1`, userID,
+	).Scan(&secret, &enabled, &lastStep); err != nil {
+		return false, err
+	}
+	if !enabled || !secret.Valid {
+		return false, nil
+	}
+	step, ok := matchTOTP(secret.String, code, lastStep, time.Now())
+	if !ok {
+		return false, nil
+	}
+	// Conditional update so two concurrent requests can't both spend the same step
+	res, err := db.Exec(`UPDATE users SET totp_last_step=$1 WHERE id=$2 AND totp_last_step < $1`, step, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ---- MFA login challenges (dev-only, in-memory like sessions) ----
+
+const (
+	mfaChallengeTTL         = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+)
+
+type mfaChallenge struct {
+	UserID   string
+	Expires  time.Time
+	Attempts int
+}
+
+var (
+	mfaChallenges   = make(map[string]mfaChallenge)
+	mfaChallengesMu sync.Mutex
+)
+
+func newMFAChallenge(userID string) string {
+	id := randToken(24)
+	mfaChallengesMu.Lock()
+	defer mfaChallengesMu.Unlock()
+	now := time.Now()
+	for k, c := range mfaChallenges { // opportunistic cleanup
+		if now.After(c.Expires) {
+			delete(mfaChallenges, k)
+		}
+	}
+	mfaChallenges[id] = mfaChallenge{UserID: userID, Expires: now.Add(mfaChallengeTTL)}
+	return id
+}
+
+// takeMFAAttempt counts an attempt against the challenge and returns its user.
+// Expired or exhausted challenges are removed.
+func takeMFAAttempt(id string) (string, bool) {
+	mfaChallengesMu.Lock()
+	defer mfaChallengesMu.Unlock()
+	c, ok := mfaChallenges[id]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(c.Expires) || c.Attempts >= mfaChallengeMaxAttempts {
+		delete(mfaChallenges, id)
+		return "", false
+	}
+	c.Attempts++
+	mfaChallenges[id] = c
+	return c.UserID, true
+}
+
+func dropMFAChallenge(id string) {
+	mfaChallengesMu.Lock()
+	defer mfaChallengesMu.Unlock()
+	delete(mfaChallenges, id)
+}
+
+// ---- POST /api/login/mfa ----
+// Body: { "challenge": "...", "code": "123456" } or { "challenge": "...", "recovery_code": "abcde-fghij" }
+
+type loginMFAReq struct {
+	Challenge    string `json:"challenge"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func loginMFAHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req loginMFAReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Challenge == "" {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		http.Error(w, "missing fields", http.StatusBadRequest)
+		return
+	}
+	userID, ok := takeMFAAttempt(req.Challenge)
+	if !ok {
+		http.Error(w, "challenge expired", http.StatusUnauthorized)
+		return
+	}
+	// Counted per user too, so fresh challenges don't reset the budget for guessing codes
+	keys := []string{keyByIP(r), "mfa:" + userID}
+	if wait := loginLockedFor(keys); wait > 0 {
+		setRetryAfter(w, wait)
+		http.Error(w, "too many failed attempts", http.StatusTooManyRequests)
+		return
+	}
+	valid, err := verifySecondFactor(db, userID, req.Code, req.RecoveryCode)
+	if err != nil {
+		http.Error(w, "login failed", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		recordLoginFailure(keys)
+		http.Error(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+	dropMFAChallenge(req.Challenge)
+
+	startSession(w, r, userID)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(loginResp{UserID: userID})
+}
+
+// ---- GET /api/mfa ----
+
+type mfaStatusResp struct {
+	TOTPEnabled            bool `json:"totp_enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+func mfaStatusHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := getSessionFromRequest(r, db)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var out mfaStatusResp
+	if err := db.QueryRow(`
+		SELECT u.totp_enabled,
+		       (SELECT COUNT(*) FROM user_recovery_codes c WHERE c.user_id = u.id AND c.used_at IS NULL)
+		FROM users u WHERE u.id=$1
+	`, sess.UserID).Scan(&out.TOTPEnabled, &out.RecoveryCodesRemaining); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// ---- POST /api/mfa/totp/setup ----
+// Generates a fresh (not yet active) secret. 2FA is only switched on by /confirm.
+
+type totpSetupResp struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+func totpSetupHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := requireBrowserSession(w, r, db)
+	if !ok {
+		return
+	}
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		http.Error(w, "secret generation failed", http.StatusInternalServerError)
+		return
+	}
+	var email string
+	err = db.QueryRow(`
+		UPDATE users SET totp_secret=$1, totp_last_step=0
+		WHERE id=$2 AND totp_enabled = FALSE
+		RETURNING email
+	`, secret, sess.UserID).Scan(&email)
+	if err == sql.ErrNoRows {
+		http.Error(w, "2fa already enabled", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "setup failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(totpSetupResp{Secret: secret, OtpauthURI: otpauthURI(email, secret)})
+}
+
+// ---- POST /api/mfa/totp/confirm ----
+// Body: { "code": "123456" } → enables 2FA and returns the recovery codes (shown once).
+
+type totpCodeReq struct {
+	Code string `json:"code"`
+}
+
+type recoveryCodesResp struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func totpConfirmHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := requireBrowserSession(w, r, db)
+	if !ok {
+		return
+	}
+	var req totpCodeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var secret sql.NullString
+	var enabled bool
+	if err := tx.QueryRow(
+		`SELECT totp_secret, totp_enabled FROM users WHERE id=$1 FOR UPDATE`, sess.UserID,
+	).Scan(&secret, &enabled); err != nil {
+		http.Error(w, "lookup failed", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		http.Error(w, "2fa already enabled", http.StatusConflict)
+		return
+	}
+	if !secret.Valid {
+		http.Error(w, "run setup first", http.StatusBadRequest)
+		return
+	}
+	step, ok := matchTOTP(secret.String, req.Code, 0, time.Now())
+	if !ok {
+		http.Error(w, "invalid code", http.StatusBadRequest)
+		return
+	}
+	if _, err := tx.Exec(
+		`UPDATE users SET totp_enabled=TRUE, totp_last_step=$1 WHERE id=$2`, step, sess.UserID,
+	); err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		return
+	}
+	codes, err := replaceRecoveryCodes(tx, sess.UserID)
+	if err != nil {
+		http.Error(w, "recovery codes failed", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+	rotateSession(w, r)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(recoveryCodesResp{RecoveryCodes: codes})
+}
+
+// ---- POST /api/mfa/totp/disable ----
+// Body: { "password": "...", "code": "123456" } (or "recovery_code")
+
+type totpDisableReq struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func totpDisableHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := requireBrowserSession(w, r, db)
+	if !ok {
+		return
+	}
+	var req totpDisableReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	var pwHash string
+	if err := db.QueryRow(`SELECT password_hash FROM users WHERE id=$1`, sess.UserID).Scan(&pwHash); err != nil {
+		http.Error(w, "lookup failed", http.StatusInternalServerError)
+		return
+	}
+	pwOK, err := verifyPassword(req.Password, pwHash)
+	if err == errHasherBusy {
+		writeHasherBusy(w)
+		return
+	} else if err != nil {
+		http.Error(w, "verification failed", http.StatusInternalServerError)
+		return
+	}
+	if !pwOK {
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	valid, err := verifySecondFactor(db, sess.UserID, req.Code, req.RecoveryCode)
+	if err != nil {
+		http.Error(w, "verification failed", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.Exec(
+		`UPDATE users SET totp_enabled=FALSE, totp_secret=NULL, totp_last_step=0 WHERE id=$1`, sess.UserID,
+	); err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id=$1`, sess.UserID); err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+	rotateSession(w, r)
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"ok":true}`))
+}
+
+// ---- POST /api/mfa/recovery-codes ----
+// Body: { "code": "123456" } → invalidates old codes and returns a new set.
+
+func regenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := requireBrowserSession(w, r, db)
+	if !ok {
+		return
+	}
+	var req totpCodeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	valid, err := verifySecondFactor(db, sess.UserID, req.Code, "")
+	if err != nil {
+		http.Error(w, "verification failed", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+	codes, err := replaceRecoveryCodes(tx, sess.UserID)
+	if err != nil {
+		http.Error(w, "recovery codes failed", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(recoveryCodesResp{RecoveryCodes: codes})
+}
@@ -0,0 +1,597 @@
+// handlers_oidc.go
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---- provider config ----
+// OIDC_PROVIDERS is a JSON array; every entry becomes /api/oidc/login?provider=<name>.
+
+type oidcProviderConfig struct {
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes,omitempty"`
+}
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcProvider struct {
+	cfg    oidcProviderConfig
+	client *http.Client
+
+	mu          sync.Mutex
+	meta        *oidcMetadata
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+var oidcProviders = make(map[string]*oidcProvider)
+
+func loadOIDCProviders() error {
+	raw := strings.TrimSpace(os.Getenv("OIDC_PROVIDERS"))
+	if raw == "" {
+		return nil
+	}
+	var cfgs []oidcProviderConfig
+	if err := json.Unmarshal([]byte(raw), &cfgs); err != nil {
+		return fmt.Errorf("OIDC_PROVIDERS: %w", err)
+	}
+	for _, c := range cfgs {
+		if c.Name == "" || c.Issuer == "" || c.ClientID == "" || c.RedirectURL == "" {
+			return fmt.Errorf("OIDC_PROVIDERS: provider %q needs name, issuer, client_id and redirect_url", c.Name)
+		}
+		c.Issuer = strings.TrimRight(c.Issuer, "/")
+		if len(c.Scopes) == 0 {
+			c.Scopes = []string{"openid", "email", "profile"}
+		}
+		oidcProviders[c.Name] = &oidcProvider{cfg: c, client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	return nil
+}
+
+func (p *oidcProvider) getJSON(u string, out any) error {
+	resp, err := p.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// metadata fetches and caches the provider's discovery document.
+func (p *oidcProvider) metadata() (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil {
+		return p.meta, nil
+	}
+	var m oidcMetadata
+	if err := p.getJSON(p.cfg.Issuer+"/.well-known/openid-configuration", &m); err != nil {
+		return nil, err
+	}
+	if strings.TrimRight(m.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovery issuer mismatch: %q", m.Issuer)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, errors.New("discovery document incomplete")
+	}
+	p.meta = &m
+	return p.meta, nil
+}
+
+// ---- JWKS / ID token verification ----
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	b64 := base64.RawURLEncoding
+	switch k.Kty {
+	case "RSA":
+		n, err1 := b64.DecodeString(k.N)
+		e, err2 := b64.DecodeString(k.E)
+		if err1 != nil || err2 != nil {
+			return nil, errors.New("bad RSA key")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err1 := b64.DecodeString(k.X)
+		y, err2 := b64.DecodeString(k.Y)
+		if err1 != nil || err2 != nil {
+			return nil, errors.New("bad EC key")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// key returns the signing key for kid, refreshing the JWKS (at most once a
+// minute) when the kid is unknown so provider key rotation just works.
+func (p *oidcProvider) key(kid string) (crypto.PublicKey, error) {
+	meta, err := p.metadata()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	if time.Since(p.keysFetched) < time.Minute && p.keys != nil {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(meta.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	p.keys = make(map[string]crypto.PublicKey)
+	p.keysFetched = time.Now()
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub, err := k.publicKey(); err == nil {
+			p.keys[k.Kid] = pub
+		}
+	}
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// audience accepts both the string and the array form of "aud".
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+type idTokenClaims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	Expiry            int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     any      `json:"email_verified"` // some IdPs send "true" as a string
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+func (c idTokenClaims) emailVerified() bool {
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+const oidcClockSkew = 2 * time.Minute
+
+func (p *oidcProvider) verifyIDToken(raw, nonce string, now time.Time) (*idTokenClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed id_token")
+	}
+	b64 := base64.RawURLEncoding
+	hdrJSON, err1 := b64.DecodeString(parts[0])
+	payload, err2 := b64.DecodeString(parts[1])
+	sig, err3 := b64.DecodeString(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, errors.New("malformed id_token")
+	}
+	var hdr struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(hdrJSON, &hdr); err != nil {
+		return nil, errors.New("malformed id_token header")
+	}
+	pub, err := p.key(hdr.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch hdr.Alg {
+	case "RS256":
+		k, ok := pub.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) != nil {
+			return nil, errors.New("bad id_token signature")
+		}
+	case "ES256":
+		k, ok := pub.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 ||
+			!ecdsa.Verify(k, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+			return nil, errors.New("bad id_token signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported id_token alg %q", hdr.Alg)
+	}
+
+	var c idTokenClaims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, errors.New("malformed id_token claims")
+	}
+	if strings.TrimRight(c.Issuer, "/") != p.cfg.Issuer {
+		return nil, errors.New("id_token issuer mismatch")
+	}
+	audOK := false
+	for _, a := range c.Audience {
+		if a == p.cfg.ClientID {
+			audOK = true
+		}
+	}
+	if !audOK || (len(c.Audience) > 1 && c.AuthorizedParty != p.cfg.ClientID) {
+		return nil, errors.New("id_token audience mismatch")
+	}
+	if now.After(time.Unix(c.Expiry, 0).Add(oidcClockSkew)) {
+		return nil, errors.New("id_token expired")
+	}
+	if c.IssuedAt != 0 && time.Unix(c.IssuedAt, 0).After(now.Add(oidcClockSkew)) {
+		return nil, errors.New("id_token issued in the future")
+	}
+	if c.Nonce != nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+	if c.Subject == "" {
+		return nil, errors.New("id_token has no subject")
+	}
+	return &c, nil
+}
+
+// exchangeCode redeems the authorization code (with the PKCE verifier) for an id_token.
+func (p *oidcProvider) exchangeCode(code, verifier string) (string, error) {
+	meta, err := p.metadata()
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.cfg.ClientID)
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+	resp, err := p.client.PostForm(meta.TokenEndpoint, form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || out.IDToken == "" {
+		return "", fmt.Errorf("token endpoint: %s %s", resp.Status, out.Error)
+	}
+	return out.IDToken, nil
+}
+
+// ---- pending logins (dev-only, in-memory like sessions) ----
+
+const oidcLoginTTL = 10 * time.Minute
+
+type oidcPending struct {
+	Provider string
+	Verifier string
+	Nonce    string
+	Expires  time.Time
+}
+
+var (
+	oidcPendingLogins   = make(map[string]oidcPending)
+	oidcPendingLoginsMu sync.Mutex
+)
+
+func takeOIDCPending(state string) (oidcPending, bool) {
+	oidcPendingLoginsMu.Lock()
+	defer oidcPendingLoginsMu.Unlock()
+	p, ok := oidcPendingLogins[state]
+	delete(oidcPendingLogins, state)
+	if !ok || time.Now().After(p.Expires) {
+		return oidcPending{}, false
+	}
+	return p, true
+}
+
+// ---- GET /api/oidc/providers ----
+
+type oidcProviderItem struct {
+	Name     string `json:"name"`
+	LoginURL string `json:"login_url"`
+}
+
+func oidcProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	items := make([]oidcProviderItem, 0, len(oidcProviders))
+	for name := range oidcProviders {
+		items = append(items, oidcProviderItem{Name: name, LoginURL: "/api/oidc/login?provider=" + url.QueryEscape(name)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+// ---- GET /api/oidc/login?provider=... ----
+
+func oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, ok := oidcProviders[r.URL.Query().Get("provider")]
+	if !ok {
+		http.Error(w, "unknown provider", http.StatusNotFound)
+		return
+	}
+	meta, err := p.metadata()
+	if err != nil {
+		log.Println("oidc discovery failed:", err)
+		http.Error(w, "provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	state := randToken(24)
+	pending := oidcPending{
+		Provider: p.cfg.Name,
+		Verifier: randToken(32),
+		Nonce:    randToken(24),
+		Expires:  time.Now().Add(oidcLoginTTL),
+	}
+	oidcPendingLoginsMu.Lock()
+	for k, v := range oidcPendingLogins { // opportunistic cleanup
+		if time.Now().After(v.Expires) {
+			delete(oidcPendingLogins, k)
+		}
+	}
+	oidcPendingLogins[state] = pending
+	oidcPendingLoginsMu.Unlock()
+
+	// Bind the state to this browser so a callback can't be replayed into someone else's session
+	http.SetCookie(w, &http.Cookie{
+		Name:     "oidc_state",
+		Value:    state,
+		Path:     "/api/oidc/",
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	challenge := sha256.Sum256([]byte(pending.Verifier))
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", pending.Nonce)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, meta.AuthorizationEndpoint+sep+q.Encode(), http.StatusFound)
+}
+
+// ---- GET /api/oidc/callback?state=...&code=... ----
+
+func oidcCallbackHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		http.Error(w, "sign-in failed: "+e, http.StatusUnauthorized)
+		return
+	}
+	state, code := q.Get("state"), q.Get("code")
+	c, err := r.Cookie("oidc_state")
+	if state == "" || code == "" || err != nil || c.Value != state {
+		http.Error(w, "invalid state", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: "oidc_state", Value: "", Path: "/api/oidc/", MaxAge: -1})
+
+	pending, ok := takeOIDCPending(state)
+	if !ok {
+		http.Error(w, "login expired", http.StatusBadRequest)
+		return
+	}
+	p, ok := oidcProviders[pending.Provider]
+	if !ok {
+		http.Error(w, "unknown provider", http.StatusBadRequest)
+		return
+	}
+
+	rawID, err := p.exchangeCode(code, pending.Verifier)
+	if err != nil {
+		log.Println("oidc code exchange failed:", err)
+		http.Error(w, "code exchange failed", http.StatusBadGateway)
+		return
+	}
+	claims, err := p.verifyIDToken(rawID, pending.Nonce, time.Now())
+	if err != nil {
+		log.Println("oidc id_token rejected:", err)
+		http.Error(w, "invalid id_token", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := linkOrCreateOIDCUser(db, p.cfg.Issuer, claims)
+	if err != nil {
+		log.Println("oidc user linking failed:", err)
+		http.Error(w, "could not sign in", http.StatusConflict)
+		return
+	}
+
+	dest := os.Getenv("OIDC_LOGIN_REDIRECT")
+	if dest == "" {
+		dest = "/"
+	}
+
+	// Local 2FA still applies; hand the challenge to the SPA in the fragment so it never hits server logs
+	var totpEnabled bool
+	_ = db.QueryRow(`SELECT totp_enabled FROM users WHERE id=$1`, userID).Scan(&totpEnabled)
+	if totpEnabled {
+		http.Redirect(w, r, dest+"#mfa_challenge="+url.QueryEscape(newMFAChallenge(userID)), http.StatusFound)
+		return
+	}
+
+	startSession(w, r, userID)
+	http.Redirect(w, r, dest, http.StatusFound)
+}
+
+// linkOrCreateOIDCUser resolves an external identity to a local user:
+// known identity → its user; otherwise see resolveOIDCUser.
+func linkOrCreateOIDCUser(db *sql.DB, issuer string, c *idTokenClaims) (string, error) {
+	var userID string
+	err := db.QueryRow(`
+		UPDATE user_identities SET last_login_at=NOW(), email=$3
+		WHERE issuer=$1 AND subject=$2
+		RETURNING user_id
+	`, issuer, c.Subject, c.Email).Scan(&userID)
+	if err == nil {
+		return userID, nil
+	} else if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	var emailOwner string
+	if c.Email != "" {
+		err = db.QueryRow(`SELECT id FROM users WHERE lower(email)=lower($1)`, c.Email).Scan(&emailOwner)
+		if err != nil && err != sql.ErrNoRows {
+			return "", err
+		}
+	}
+	userID, err = resolveOIDCUser(c, emailOwner)
+	if err != nil {
+		return "", err
+	}
+	if userID != "" {
+		_, err = db.Exec(
+			`INSERT INTO user_identities (issuer, subject, user_id, email) VALUES ($1,$2,$3,$4)`,
+			issuer, c.Subject, userID, c.Email,
+		)
+		return userID, err
+	}
+
+	name := c.Name
+	if name == "" {
+		name = c.PreferredUsername
+	}
+	if name == "" {
+		name = strings.SplitN(c.Email, "@", 2)[0]
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// SSO-only users get an unusable password hash; verifyPassword never matches it
+	if err := tx.QueryRow(
+		`INSERT INTO users (email, password_hash, name) VALUES ($1,'!oidc',$2) RETURNING id`,
+		c.Email, name,
+	).Scan(&userID); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO user_identities (issuer, subject, user_id, email) VALUES ($1,$2,$3,$4)`,
+		issuer, c.Subject, userID, c.Email,
+	); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	if err := provisionPersonalWorkspace(db, userID, name); err != nil {
+		// Same as registration: non-fatal, just log it.
+		log.Println("provisioning failed:", err)
+	}
+	return userID, nil
+}
+
+// resolveOIDCUser decides where a first-time identity goes. emailOwner is the
+// local user already holding the token's email, if any. It returns the user to
+// link to, or "" when a new user should be created.
+func resolveOIDCUser(c *idTokenClaims, emailOwner string) (string, error) {
+	if c.Email == "" {
+		return "", errors.New("id_token has no email claim")
+	}
+	if emailOwner == "" {
+		return "", nil
+	}
+	// Only trust the email for linking when the IdP vouches for it
+	if !c.emailVerified() {
+		return "", errors.New("email belongs to an existing user but is not verified by the provider")
+	}
+	return emailOwner, nil
+}
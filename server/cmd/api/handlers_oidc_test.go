@@ -0,0 +1,468 @@
+// handlers_oidc_test.go
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ---- fake provider ----
+// fakeIdP serves discovery, a JWKS with one RSA key and a token endpoint that
+// checks the PKCE verifier against the challenge from the authorize redirect.
+
+const fakeClientID = "tm-test"
+
+type fakeIdP struct {
+	t   *testing.T
+	srv *httptest.Server
+	key *rsa.PrivateKey
+	kid string
+
+	signer     *rsa.PrivateKey      // key the id_token is signed with; defaults to key
+	claims     func(map[string]any) // tweaks the id_token claims per test
+	nonce      string               // from the authorize redirect
+	challenge  string               // from the authorize redirect
+	tokenCalls int
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeIdP{t: t, key: key, kid: "k1"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(oidcMetadata{
+			Issuer:                f.srv.URL,
+			AuthorizationEndpoint: f.srv.URL + "/authorize",
+			TokenEndpoint:         f.srv.URL + "/token",
+			JWKSURI:               f.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []jwk{{
+			Kty: "RSA", Kid: f.kid, Use: "sig",
+			N: b64.EncodeToString(key.N.Bytes()),
+			E: b64.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		f.tokenCalls++
+		_ = r.ParseForm()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if r.PostForm.Get("code") != "good-code" ||
+			r.PostForm.Get("client_id") != fakeClientID ||
+			base64.RawURLEncoding.EncodeToString(sum[:]) != f.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": f.idToken()})
+	})
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.srv.Close)
+
+	oidcProviders["test"] = &oidcProvider{
+		cfg: oidcProviderConfig{
+			Name:        "test",
+			Issuer:      f.srv.URL,
+			ClientID:    fakeClientID,
+			RedirectURL: "http://app.test/api/oidc/callback",
+			Scopes:      []string{"openid", "email", "profile"},
+		},
+		client: f.srv.Client(),
+	}
+	t.Cleanup(func() { delete(oidcProviders, "test") })
+	return f
+}
+
+func (f *fakeIdP) idToken() string {
+	now := time.Now()
+	c := map[string]any{
+		"iss":            f.srv.URL,
+		"sub":            "sub-" + randToken(8),
+		"aud":            fakeClientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          f.nonce,
+		"email":          "oidc-" + strings.ToLower(randToken(6)) + "@example.test",
+		"email_verified": true,
+		"name":           "Test User",
+	}
+	if f.claims != nil {
+		f.claims(c)
+	}
+	signer := f.signer
+	if signer == nil {
+		signer = f.key
+	}
+	b64 := base64.RawURLEncoding
+	hdr, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": f.kid, "typ": "JWT"})
+	payload, _ := json.Marshal(c)
+	signing := b64.EncodeToString(hdr) + "." + b64.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, signer, crypto.SHA256, digest[:])
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return signing + "." + b64.EncodeToString(sig)
+}
+
+// login runs /api/oidc/login and plays the browser's trip to the authorize
+// endpoint, returning the state the IdP would send back.
+func (f *fakeIdP) login(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	oidcLoginHandler(rec, httptest.NewRequest(http.MethodGet, "/api/oidc/login?provider=test", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: status %d: %s", rec.Code, rec.Body.String())
+	}
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := loc.Query()
+	f.nonce, f.challenge = q.Get("nonce"), q.Get("code_challenge")
+	return q.Get("state")
+}
+
+// callback hits /api/oidc/callback as the browser returning from the IdP.
+func callback(db *sql.DB, cookieState, state, code string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/oidc/callback?"+url.Values{"state": {state}, "code": {code}}.Encode(), nil)
+	if cookieState != "" {
+		req.AddCookie(&http.Cookie{Name: "oidc_state", Value: cookieState})
+	}
+	rec := httptest.NewRecorder()
+	oidcCallbackHandler(rec, req, db)
+	return rec
+}
+
+// sessionUser is the user behind the sid cookie the response set, or "".
+func sessionUser(rec *httptest.ResponseRecorder) string {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "sid" {
+			sessionsMu.Lock()
+			defer sessionsMu.Unlock()
+			return sessions[c.Value].UserID
+		}
+	}
+	return ""
+}
+
+// testDB opens TEST_DB_DSN, which must point at a migrated database; tests
+// that write users are skipped without it.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// dropUser removes a test user together with the workspaces they own.
+func dropUser(t *testing.T, db *sql.DB, email string) {
+	t.Cleanup(func() {
+		_, _ = db.Exec(`
+			DELETE FROM workspaces WHERE id IN (
+			  SELECT m.workspace_id FROM workspace_members m JOIN users u ON u.id = m.user_id
+			  WHERE lower(u.email) = lower($1) AND m.role = 'owner'
+			)`, email)
+		_, _ = db.Exec(`DELETE FROM users WHERE lower(email) = lower($1)`, email)
+	})
+}
+
+// ---- tests ----
+
+func TestOIDCLoginRedirect(t *testing.T) {
+	f := newFakeIdP(t)
+	rec := httptest.NewRecorder()
+	oidcLoginHandler(rec, httptest.NewRequest(http.MethodGet, "/api/oidc/login?provider=test", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status %d", rec.Code)
+	}
+	loc, _ := url.Parse(rec.Header().Get("Location"))
+	if got := loc.Scheme + "://" + loc.Host + loc.Path; got != f.srv.URL+"/authorize" {
+		t.Fatalf("redirected to %s", got)
+	}
+	q := loc.Query()
+	for k, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             fakeClientID,
+		"redirect_uri":          "http://app.test/api/oidc/callback",
+		"scope":                 "openid email profile",
+		"code_challenge_method": "S256",
+	} {
+		if q.Get(k) != want {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), want)
+		}
+	}
+	if q.Get("nonce") == "" {
+		t.Error("no nonce")
+	}
+
+	var cookie string
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "oidc_state" {
+			cookie = c.Value
+		}
+	}
+	state := q.Get("state")
+	if state == "" || cookie != state {
+		t.Fatalf("state %q not bound to cookie %q", state, cookie)
+	}
+	pending, ok := takeOIDCPending(state)
+	if !ok {
+		t.Fatal("no pending login for state")
+	}
+	sum := sha256.Sum256([]byte(pending.Verifier))
+	if q.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Error("code_challenge is not S256 of the stored verifier")
+	}
+	if pending.Nonce != q.Get("nonce") || pending.Provider != "test" {
+		t.Errorf("pending login %+v does not match the redirect", pending)
+	}
+}
+
+func TestOIDCLoginUnknownProvider(t *testing.T) {
+	rec := httptest.NewRecorder()
+	oidcLoginHandler(rec, httptest.NewRequest(http.MethodGet, "/api/oidc/login?provider=nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status %d", rec.Code)
+	}
+}
+
+func TestOIDCCallbackBadState(t *testing.T) {
+	f := newFakeIdP(t)
+	state := f.login(t)
+
+	// the state must match this browser's cookie...
+	for name, cookie := range map[string]string{"no cookie": "", "other browser": "someone-else"} {
+		if rec := callback(nil, cookie, state, "good-code"); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d", name, rec.Code)
+		}
+	}
+	// ...and a pending login, once
+	if rec := callback(nil, "forged", "forged", "good-code"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown state: status %d", rec.Code)
+	}
+	if f.tokenCalls != 0 {
+		t.Errorf("token endpoint called %d times for a bad state", f.tokenCalls)
+	}
+}
+
+func TestOIDCCallbackRejectsIDToken(t *testing.T) {
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name   string
+		claims func(map[string]any)
+		signer *rsa.PrivateKey
+	}{
+		{name: "bad nonce", claims: func(c map[string]any) { c["nonce"] = "replayed" }},
+		{name: "bad signature", signer: other},
+		{name: "expired", claims: func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "wrong audience", claims: func(c map[string]any) { c["aud"] = "someone-else" }},
+		{name: "wrong issuer", claims: func(c map[string]any) { c["iss"] = "https://evil.test" }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFakeIdP(t)
+			f.claims, f.signer = tc.claims, tc.signer
+			state := f.login(t)
+			// rejected before any user lookup, so no database is needed
+			rec := callback(nil, state, state, "good-code")
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+			}
+			if f.tokenCalls != 1 {
+				t.Errorf("token endpoint called %d times", f.tokenCalls)
+			}
+			if sessionUser(rec) != "" {
+				t.Error("session started for a rejected id_token")
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackBadCode(t *testing.T) {
+	f := newFakeIdP(t)
+	state := f.login(t)
+	if rec := callback(nil, state, state, "stolen-code"); rec.Code != http.StatusBadGateway {
+		t.Fatalf("status %d", rec.Code)
+	}
+}
+
+func TestResolveOIDCUser(t *testing.T) {
+	cases := []struct {
+		name       string
+		email      string
+		verified   any
+		emailOwner string
+		want       string
+		wantErr    bool
+	}{
+		{name: "verified email of existing user links", email: "a@example.test", verified: true, emailOwner: "u1", want: "u1"},
+		{name: "verified as a string links", email: "a@example.test", verified: "true", emailOwner: "u1", want: "u1"},
+		{name: "unverified email never links", email: "a@example.test", verified: false, emailOwner: "u1", wantErr: true},
+		{name: "unverified as a string never links", email: "a@example.test", verified: "false", emailOwner: "u1", wantErr: true},
+		{name: "missing email_verified never links", email: "a@example.test", emailOwner: "u1", wantErr: true},
+		{name: "unknown email creates", email: "new@example.test", verified: true},
+		{name: "unverified unknown email creates", email: "new@example.test", verified: false},
+		{name: "no email", verified: true, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &idTokenClaims{Subject: "s", Email: tc.email, EmailVerified: tc.verified}
+			got, err := resolveOIDCUser(c, tc.emailOwner)
+			if (err != nil) != tc.wantErr || got != tc.want {
+				t.Fatalf("got (%q, %v), want (%q, error %v)", got, err, tc.want, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackLinksVerifiedEmail(t *testing.T) {
+	db := testDB(t)
+	f := newFakeIdP(t)
+	email := "oidc-link-" + strings.ToLower(randToken(6)) + "@example.test"
+	dropUser(t, db, email)
+	var userID string
+	if err := db.QueryRow(
+		`INSERT INTO users (email, password_hash, name) VALUES ($1,'x','Existing') RETURNING id`, email,
+	).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	f.claims = func(c map[string]any) {
+		c["sub"] = "link-sub"
+		c["email"] = strings.ToUpper(email) // matched case-insensitively
+	}
+
+	state := f.login(t)
+	rec := callback(db, state, state, "good-code")
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/" {
+		t.Fatalf("status %d, location %q: %s", rec.Code, rec.Header().Get("Location"), rec.Body.String())
+	}
+	if got := sessionUser(rec); got != userID {
+		t.Fatalf("session for %q, want existing user %q", got, userID)
+	}
+	var linked string
+	if err := db.QueryRow(
+		`SELECT user_id FROM user_identities WHERE issuer=$1 AND subject='link-sub'`, f.srv.URL,
+	).Scan(&linked); err != nil || linked != userID {
+		t.Fatalf("identity linked to %q (%v), want %q", linked, err, userID)
+	}
+	var users, workspaces int
+	_ = db.QueryRow(`SELECT COUNT(*) FROM users WHERE lower(email)=lower($1)`, email).Scan(&users)
+	_ = db.QueryRow(`SELECT COUNT(*) FROM workspace_members WHERE user_id=$1`, userID).Scan(&workspaces)
+	if users != 1 || workspaces != 0 {
+		t.Errorf("linking created %d users and %d workspaces", users, workspaces)
+	}
+
+	// the second sign-in finds the identity directly
+	state = f.login(t)
+	if got := sessionUser(callback(db, state, state, "good-code")); got != userID {
+		t.Errorf("repeat login: session for %q, want %q", got, userID)
+	}
+}
+
+func TestOIDCCallbackUnverifiedEmailDoesNotLink(t *testing.T) {
+	db := testDB(t)
+	f := newFakeIdP(t)
+	email := "oidc-unverified-" + strings.ToLower(randToken(6)) + "@example.test"
+	dropUser(t, db, email)
+	if _, err := db.Exec(`INSERT INTO users (email, password_hash, name) VALUES ($1,'x','Existing')`, email); err != nil {
+		t.Fatal(err)
+	}
+	f.claims = func(c map[string]any) {
+		c["email"] = email
+		c["email_verified"] = false
+	}
+
+	state := f.login(t)
+	rec := callback(db, state, state, "good-code")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var n int
+	_ = db.QueryRow(`SELECT COUNT(*) FROM user_identities WHERE lower(email)=lower($1)`, email).Scan(&n)
+	if n != 0 {
+		t.Errorf("unverified email linked %d identities", n)
+	}
+}
+
+func TestOIDCCallbackCreatesUser(t *testing.T) {
+	db := testDB(t)
+	f := newFakeIdP(t)
+	email := "oidc-new-" + strings.ToLower(randToken(6)) + "@example.test"
+	dropUser(t, db, email)
+	f.claims = func(c map[string]any) {
+		c["sub"] = "new-sub-" + randToken(6)
+		c["email"] = email
+		c["name"] = "New Person"
+	}
+
+	state := f.login(t)
+	rec := callback(db, state, state, "good-code")
+	if rec.Code != http.StatusFound {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	var userID, hash, name string
+	if err := db.QueryRow(
+		`SELECT id, password_hash, name FROM users WHERE email=$1`, email,
+	).Scan(&userID, &hash, &name); err != nil {
+		t.Fatal("user not created:", err)
+	}
+	if sessionUser(rec) != userID {
+		t.Error("session is not for the new user")
+	}
+	if hash != "!oidc" || name != "New Person" {
+		t.Errorf("new user has hash %q, name %q", hash, name)
+	}
+	var identities int
+	_ = db.QueryRow(`SELECT COUNT(*) FROM user_identities WHERE user_id=$1 AND issuer=$2`, userID, f.srv.URL).Scan(&identities)
+	if identities != 1 {
+		t.Errorf("%d identities for the new user", identities)
+	}
+
+	// provisionPersonalWorkspace: an owned workspace with the starter board
+	var wsName string
+	var boards int
+	if err := db.QueryRow(`
+		SELECT w.name, (SELECT COUNT(*) FROM boards b WHERE b.workspace_id = w.id)
+		FROM workspaces w JOIN workspace_members m ON m.workspace_id = w.id
+		WHERE m.user_id = $1 AND m.role = 'owner'
+	`, userID).Scan(&wsName, &boards); err != nil {
+		t.Fatal("no personal workspace:", err)
+	}
+	if wsName != "New Person's Workspace" || boards != 1 {
+		t.Errorf("workspace %q with %d boards", wsName, boards)
+	}
+}
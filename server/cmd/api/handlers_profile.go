@@ -0,0 +1,395 @@
+// handlers_profile.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// isUniqueViolation reports whether err is a Postgres unique-constraint error.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// isCheckViolation reports whether err is a Postgres CHECK-constraint error.
+func isCheckViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23514"
+}
+
+// hasLocalPassword is false for SSO-only users, whose hash is a placeholder.
+func hasLocalPassword(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+// reauthenticate checks the current password (and TOTP code when 2FA is on)
+// before a sensitive account change. It writes the error response itself.
+func reauthenticate(w http.ResponseWriter, db *sql.DB, userID, password, code string) bool {
+	var pwHash string
+	var totpEnabled bool
+	if err := db.QueryRow(
+		`SELECT password_hash, totp_enabled FROM users WHERE id=$1`, userID,
+	).Scan(&pwHash, &totpEnabled); err != nil {
+		http.Error(w, "lookup failed", http.StatusInternalServerError)
+		return false
+	}
+	if !hasLocalPassword(pwHash) {
+		http.Error(w, "account has no password; sign in with your identity provider", http.StatusForbidden)
+		return false
+	}
+	if password == "" {
+		http.Error(w, "current password required", http.StatusUnauthorized)
+		return false
+	}
+	valid, err := verifyPassword(password, pwHash)
+	if err == errHasherBusy {
+		writeHasherBusy(w)
+		return false
+	} else if err != nil {
+		http.Error(w, "verification failed", http.StatusInternalServerError)
+		return false
+	}
+	if !valid {
+		http.Error(w, "invalid credentials", http.StatusUnauthorized)
+		return false
+	}
+	if totpEnabled {
+		ok, err := verifySecondFactor(db, userID, code, "")
+		if err != nil {
+			http.Error(w, "verification failed", http.StatusInternalServerError)
+			return false
+		}
+		if !ok {
+			http.Error(w, "invalid code", http.StatusUnauthorized)
+			return false
+		}
+	}
+	return true
+}
+
+// ---- PATCH /api/me ----
+// Body: { "name"?, "email"?, "new_password"?, "current_password", "code"? }
+// Changing email or password requires current_password (and a TOTP code when 2FA is on).
+
+type updateMeReq struct {
+	Name            *string `json:"name,omitempty"`
+	Email           *string `json:"email,omitempty"`
+	NewPassword     *string `json:"new_password,omitempty"`
+	CurrentPassword string  `json:"current_password,omitempty"`
+	Code            string  `json:"code,omitempty"`
+}
+
+func updateMeHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireBrowserSession(w, r, db)
+	if !ok {
+		return
+	}
+	var req updateMeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	sets := []string{}
+	args := []any{}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			http.Error(w, "name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		sets = append(sets, "name=$"+strconv.Itoa(len(args)+1))
+		args = append(args, name)
+	}
+	sensitive := req.Email != nil || req.NewPassword != nil
+	if req.Email != nil {
+		email := strings.TrimSpace(*req.Email)
+		if !strings.Contains(email, "@") {
+			http.Error(w, "invalid email", http.StatusBadRequest)
+			return
+		}
+		sets = append(sets, "email=$"+strconv.Itoa(len(args)+1))
+		args = append(args, email)
+	}
+	if req.NewPassword != nil && *req.NewPassword == "" {
+		http.Error(w, "password cannot be empty", http.StatusBadRequest)
+		return
+	}
+	if len(sets) == 0 && req.NewPassword == nil {
+		http.Error(w, "nothing to update", http.StatusBadRequest)
+		return
+	}
+
+	if sensitive && !reauthenticate(w, db, sess.UserID, req.CurrentPassword, req.Code) {
+		return
+	}
+	if req.NewPassword != nil {
+		h, err := hashPassword(*req.NewPassword)
+		if err == errHasherBusy {
+			writeHasherBusy(w)
+			return
+		} else if err != nil {
+			http.Error(w, "hashing failed", http.StatusInternalServerError)
+			return
+		}
+		sets = append(sets, "password_hash=$"+strconv.Itoa(len(args)+1))
+		args = append(args, h)
+	}
+
+	args = append(args, sess.UserID)
+	query := `UPDATE users SET ` + strings.Join(sets, ", ") + `, updated_at=NOW() WHERE id=$` + strconv.Itoa(len(args))
+	if _, err := db.Exec(query, args...); err != nil {
+		if isUniqueViolation(err) {
+			http.Error(w, "email already in use", http.StatusConflict)
+			return
+		}
+		http.Error(w, "update failed", http.StatusBadRequest)
+		return
+	}
+
+	// Credentials changed → sign out every other device and re-key this one
+	if sensitive {
+		deleteUserSessions(sess.UserID, sess.ID)
+		rotateSession(w, r)
+	}
+
+	out, err := loadMe(db, sess.UserID)
+	if err != nil {
+		http.Error(w, "user not found", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// ---- /api/me/avatar (POST multipart "file", DELETE) ----
+
+var avatarExts = []string{".png", ".jpg", ".jpeg", ".gif", ".webp"}
+
+func avatarHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+
+	var newURL any // nil → clear
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, 5<<20)
+		if err := r.ParseMultipartForm(5 << 20); err != nil {
+			http.Error(w, "bad multipart (max 5 MiB)", http.StatusBadRequest)
+			return
+		}
+		file, hdr, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "file missing", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		url, err := saveUpload(file, hdr, avatarExts)
+		if err == errUploadType {
+			http.Error(w, "avatar must be png, jpg, gif or webp", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "cannot save", http.StatusInternalServerError)
+			return
+		}
+		newURL = url
+	}
+
+	var old sql.NullString
+	if err := db.QueryRow(`
+		UPDATE users u SET avatar_url=$1, updated_at=NOW()
+		FROM (SELECT avatar_url FROM users WHERE id=$2) prev
+		WHERE u.id=$2
+		RETURNING prev.avatar_url
+	`, newURL, sess.UserID).Scan(&old); err != nil {
+		http.Error(w, "update failed", http.StatusInternalServerError)
+		return
+	}
+	if old.Valid {
+		removeUpload(old.String)
+	}
+
+	out, err := loadMe(db, sess.UserID)
+	if err != nil {
+		http.Error(w, "user not found", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// ---- DELETE /api/me ----
+// Body: { "current_password", "code"? } — SSO-only accounts send { "confirm_email" } instead.
+//   - "reassign_tasks_to": optional user id that takes over created_by on tasks in
+//     workspaces they share; all other created_by references are nulled.
+//
+// Workspaces the user owns alone are deleted with their boards; shared ones
+// without another owner get a new owner (admins first).
+
+type deleteMeReq struct {
+	CurrentPassword string `json:"current_password,omitempty"`
+	Code            string `json:"code,omitempty"`
+	ConfirmEmail    string `json:"confirm_email,omitempty"`
+	ReassignTasksTo string `json:"reassign_tasks_to,omitempty"`
+}
+
+type ownedWorkspace struct {
+	ID          string
+	Others      int
+	OtherOwners int
+}
+
+func deleteMeHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireBrowserSession(w, r, db)
+	if !ok {
+		return
+	}
+	var req deleteMeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	var email, pwHash string
+	var avatar sql.NullString
+	if err := db.QueryRow(
+		`SELECT email, password_hash, avatar_url FROM users WHERE id=$1`, sess.UserID,
+	).Scan(&email, &pwHash, &avatar); err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+	if hasLocalPassword(pwHash) {
+		if !reauthenticate(w, db, sess.UserID, req.CurrentPassword, req.Code) {
+			return
+		}
+	} else if !strings.EqualFold(strings.TrimSpace(req.ConfirmEmail), email) {
+		http.Error(w, "confirm_email must match your email", http.StatusBadRequest)
+		return
+	}
+	if req.ReassignTasksTo == sess.UserID {
+		http.Error(w, "cannot reassign to yourself", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// 1) owned workspaces
+	rows, err := tx.Query(`
+		SELECT m.workspace_id,
+		       (SELECT COUNT(*) FROM workspace_members o WHERE o.workspace_id = m.workspace_id AND o.user_id <> $1),
+		       (SELECT COUNT(*) FROM workspace_members o WHERE o.workspace_id = m.workspace_id AND o.user_id <> $1 AND o.role = 'owner')
+		FROM workspace_members m
+		WHERE m.user_id = $1 AND m.role = 'owner'
+	`, sess.UserID)
+	if err != nil {
+		http.Error(w, "workspace query failed", http.StatusInternalServerError)
+		return
+	}
+	owned := make([]ownedWorkspace, 0)
+	for rows.Next() {
+		var o ownedWorkspace
+		if err := rows.Scan(&o.ID, &o.Others, &o.OtherOwners); err == nil {
+			owned = append(owned, o)
+		}
+	}
+	rows.Close()
+
+	for _, o := range owned {
+		switch {
+		case o.Others == 0:
+			if _, err := tx.Exec(`DELETE FROM workspaces WHERE id=$1`, o.ID); err != nil {
+				http.Error(w, "workspace delete failed", http.StatusInternalServerError)
+				return
+			}
+		case o.OtherOwners == 0:
+			if _, err := tx.Exec(`
+				UPDATE workspace_members SET role='owner'
+				WHERE workspace_id=$1 AND user_id = (
+				  SELECT user_id FROM workspace_members
+				  WHERE workspace_id=$1 AND user_id <> $2
+				  ORDER BY (role = 'admin') DESC, user_id
+				  LIMIT 1
+				)`, o.ID, sess.UserID); err != nil {
+				http.Error(w, "ownership transfer failed", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	// 2) tasks they created
+	if req.ReassignTasksTo != "" {
+		if _, err := tx.Exec(`
+			UPDATE tasks t SET created_by=$2
+			FROM lists l
+			JOIN boards b ON b.id = l.board_id
+			JOIN workspace_members m ON m.workspace_id = b.workspace_id AND m.user_id = $2
+			WHERE t.list_id = l.id AND t.created_by = $1
+		`, sess.UserID, req.ReassignTasksTo); err != nil {
+			http.Error(w, "task reassignment failed", http.StatusBadRequest)
+			return
+		}
+	}
+	if _, err := tx.Exec(`UPDATE tasks SET created_by=NULL WHERE created_by=$1`, sess.UserID); err != nil {
+		http.Error(w, "task update failed", http.StatusInternalServerError)
+		return
+	}
+
+	// 3) assignments
+	if _, err := tx.Exec(`DELETE FROM task_assignees WHERE user_id=$1`, sess.UserID); err != nil {
+		http.Error(w, "assignee cleanup failed", http.StatusInternalServerError)
+		return
+	}
+
+	// Export zips go with the account; collect their paths before the rows cascade away
+	exportFiles := make([]string, 0)
+	if erows, err := tx.Query(`SELECT file_path FROM data_exports WHERE user_id=$1 AND file_path IS NOT NULL`, sess.UserID); err == nil {
+		for erows.Next() {
+			var p string
+			if erows.Scan(&p) == nil {
+				exportFiles = append(exportFiles, p)
+			}
+		}
+		erows.Close()
+	}
+
+	// 4) the user (memberships, comments, tokens, identities, exports cascade)
+	if _, err := tx.Exec(`DELETE FROM users WHERE id=$1`, sess.UserID); err != nil {
+		http.Error(w, "delete failed", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+
+	if avatar.Valid {
+		removeUpload(avatar.String)
+	}
+	for _, p := range exportFiles {
+		_ = os.Remove(p)
+	}
+	deleteUserSessions(sess.UserID, "")
+	clearSessionCookies(w)
+	log.Printf("account deleted: %s (%d owned workspaces handled)", sess.UserID, len(owned))
+	w.WriteHeader(http.StatusNoContent)
+}
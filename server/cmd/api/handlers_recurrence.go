@@ -0,0 +1,543 @@
+// handlers_recurrence.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---- recurring tasks ----
+// Rules use a subset of RFC 5545 RRULE:
+//   FREQ=DAILY|WEEKLY|MONTHLY  INTERVAL=n  BYDAY=MO,TU,… (WEEKLY only)  UNTIL=YYYYMMDD | COUNT=n
+// The current instance is cloned into its home list when it is moved to a
+// 'done' list or when the scheduler sees the next occurrence date arrive,
+// whichever comes first. Clones never land in a 'done' list; with no other
+// live list on the board the series ends. Monthly rules on the 29th–31st
+// fall on the last day of shorter months.
+
+type recurrenceRule struct {
+	Freq     string // DAILY | WEEKLY | MONTHLY
+	Interval int
+	ByDay    []time.Weekday
+	Until    *time.Time // inclusive
+	Count    int        // 0 = no limit
+}
+
+var rruleDays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"} // indexed by time.Weekday
+
+func parseRRule(s string) (recurrenceRule, error) {
+	r := recurrenceRule{Interval: 1}
+	s = strings.TrimPrefix(strings.TrimSpace(strings.ToUpper(s)), "RRULE:")
+	if s == "" {
+		return r, errors.New("empty rule")
+	}
+	for _, part := range strings.Split(s, ";") {
+		k, v, ok := strings.Cut(part, "=")
+		if !ok || v == "" {
+			return r, errors.New("malformed rule part " + strconv.Quote(part))
+		}
+		switch k {
+		case "FREQ":
+			if v != "DAILY" && v != "WEEKLY" && v != "MONTHLY" {
+				return r, errors.New("FREQ must be DAILY, WEEKLY or MONTHLY")
+			}
+			r.Freq = v
+		case "INTERVAL":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 365 {
+				return r, errors.New("INTERVAL must be between 1 and 365")
+			}
+			r.Interval = n
+		case "BYDAY":
+			seen := map[time.Weekday]bool{}
+			for _, d := range strings.Split(v, ",") {
+				wd := -1
+				for i, name := range rruleDays {
+					if d == name {
+						wd = i
+					}
+				}
+				if wd < 0 {
+					return r, errors.New("BYDAY takes MO,TU,WE,TH,FR,SA,SU")
+				}
+				if !seen[time.Weekday(wd)] {
+					seen[time.Weekday(wd)] = true
+					r.ByDay = append(r.ByDay, time.Weekday(wd))
+				}
+			}
+		case "UNTIL":
+			if len(v) < 8 {
+				return r, errors.New("UNTIL must be YYYYMMDD")
+			}
+			t, err := time.Parse("20060102", v[:8]) // a time part, if any, is ignored
+			if err != nil {
+				return r, errors.New("UNTIL must be YYYYMMDD")
+			}
+			r.Until = &t
+		case "COUNT":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 1000 {
+				return r, errors.New("COUNT must be between 1 and 1000")
+			}
+			r.Count = n
+		default:
+			return r, errors.New(k + " is not supported")
+		}
+	}
+	if r.Freq == "" {
+		return r, errors.New("FREQ is required")
+	}
+	if len(r.ByDay) > 0 && r.Freq != "WEEKLY" {
+		return r, errors.New("BYDAY is only supported with FREQ=WEEKLY")
+	}
+	if r.Until != nil && r.Count > 0 {
+		return r, errors.New("use either UNTIL or COUNT, not both")
+	}
+	return r, nil
+}
+
+// String renders the rule in a canonical form (this is what gets stored).
+func (r recurrenceRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, 0, len(r.ByDay))
+		for wd := time.Monday; ; wd = (wd + 1) % 7 { // Monday-first, like WKST=MO
+			for _, d := range r.ByDay {
+				if d == wd {
+					days = append(days, rruleDays[wd])
+				}
+			}
+			if wd == time.Sunday {
+				break
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.Format("20060102"))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	return strings.Join(parts, ";")
+}
+
+func mondayOf(d time.Time) time.Time {
+	return d.AddDate(0, 0, -((int(d.Weekday()) + 6) % 7))
+}
+
+// addMonthsClamped moves d by n months, keeping day-of-month where possible.
+func addMonthsClamped(d time.Time, n int) time.Time {
+	first := time.Date(d.Year(), d.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(d.Day(), last)-1)
+}
+
+// next returns the first occurrence strictly after `after` of a series
+// anchored at start (both dates at UTC midnight). ok is false past UNTIL.
+func (r recurrenceRule) next(start, after time.Time) (d time.Time, ok bool) {
+	if after.Before(start) {
+		after = start.AddDate(0, 0, -1)
+	}
+	days := int(after.Sub(start).Hours() / 24)
+	switch {
+	case r.Freq == "DAILY":
+		d = start.AddDate(0, 0, (days/r.Interval+1)*r.Interval)
+	case r.Freq == "WEEKLY" && len(r.ByDay) == 0:
+		step := 7 * r.Interval
+		d = start.AddDate(0, 0, (days/step+1)*step)
+	case r.Freq == "WEEKLY":
+		anchor := mondayOf(start)
+		for c := after.AddDate(0, 0, 1); ; c = c.AddDate(0, 0, 1) {
+			week := int(mondayOf(c).Sub(anchor).Hours() / 24 / 7)
+			if week%r.Interval != 0 {
+				continue
+			}
+			for _, wd := range r.ByDay {
+				if c.Weekday() == wd {
+					d = c
+				}
+			}
+			if !d.IsZero() {
+				break
+			}
+		}
+	default: // MONTHLY
+		months := (after.Year()-start.Year())*12 + int(after.Month()-start.Month())
+		for k := max(0, months/r.Interval); ; k++ {
+			if c := addMonthsClamped(start, k*r.Interval); c.After(after) {
+				d = c
+				break
+			}
+		}
+	}
+	if r.Until != nil && d.After(*r.Until) {
+		return d, false
+	}
+	return d, true
+}
+
+func today() time.Time {
+	y, m, d := time.Now().UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// ---- scheduler ----
+
+func startRecurrenceScheduler(db *sql.DB) {
+	go func() {
+		for {
+			runDueRecurrences(db)
+			time.Sleep(time.Minute)
+		}
+	}()
+}
+
+func runDueRecurrences(db *sql.DB) {
+	rows, err := db.Query(`
+		SELECT r.task_id FROM task_recurrences r
+		JOIN tasks t ON t.id = r.task_id
+		JOIN lists l ON l.id = t.list_id
+		JOIN boards b ON b.id = l.board_id
+		WHERE r.next_due <= $1::date
+		  AND t.archived_at IS NULL AND t.deleted_at IS NULL
+		  AND l.archived_at IS NULL AND l.deleted_at IS NULL
+		  AND b.archived_at IS NULL AND b.deleted_at IS NULL
+		LIMIT 500
+	`, today().Format(dateLayout))
+	if err != nil {
+		log.Println("recurrence scheduler:", err)
+		return
+	}
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	for _, id := range ids {
+		if _, err := advanceRecurrence(db, id); err != nil {
+			log.Println("recurrence scheduler:", id, err)
+		}
+	}
+}
+
+// advanceRecurrence clones the series' current instance if it is done or the
+// next occurrence has arrived, and moves the series onto the clone. It returns
+// the new task id, or "" when nothing was due.
+func advanceRecurrence(db *sql.DB, taskID string) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var rruleStr, category string
+	var startsOn, nextDue time.Time
+	var occurrences int
+	var homeList sql.NullString
+	var curList string
+	err = tx.QueryRow(`
+		SELECT r.rrule, r.starts_on, r.next_due, r.occurrences, r.list_id, t.list_id, l.category
+		FROM task_recurrences r
+		JOIN tasks t ON t.id = r.task_id
+		JOIN lists l ON l.id = t.list_id
+		JOIN boards b ON b.id = l.board_id
+		WHERE r.task_id = $1
+		  AND t.archived_at IS NULL AND t.deleted_at IS NULL
+		  AND l.archived_at IS NULL AND l.deleted_at IS NULL
+		  AND b.archived_at IS NULL AND b.deleted_at IS NULL
+		FOR UPDATE OF r SKIP LOCKED
+	`, taskID).Scan(&rruleStr, &startsOn, &nextDue, &occurrences, &homeList, &curList, &category)
+	if err == sql.ErrNoRows {
+		return "", nil // gone, or another worker has it
+	} else if err != nil {
+		return "", err
+	}
+	now := today()
+	if category != "done" && nextDue.After(now) {
+		return "", nil
+	}
+	rule, err := parseRRule(rruleStr)
+	if err != nil {
+		return "", err
+	}
+
+	// WIP limits don't apply: the scheduler has nobody to refuse and skipping
+	// the occurrence would lose it, so a full list just shows as over_wip.
+	listID := recurrenceTargetList(tx, homeList, curList)
+	if listID == "" {
+		// nowhere but a done list to put it: cloning there would be advanced
+		// again straight away, so the series ends here
+		if _, err := tx.Exec(`DELETE FROM task_recurrences WHERE task_id=$1`, taskID); err != nil {
+			return "", err
+		}
+		return "", tx.Commit()
+	}
+	newID, err := cloneTaskInstance(tx, taskID, listID, nextDue)
+	if err != nil {
+		return "", err
+	}
+	occurrences++
+
+	// Work out the following date; missed dates (e.g. after downtime) are skipped.
+	following, more := rule.next(startsOn, nextDue)
+	for more && !following.After(now) {
+		following, more = rule.next(startsOn, following)
+	}
+	if rule.Count > 0 && occurrences >= rule.Count {
+		more = false
+	}
+
+	if more {
+		_, err = tx.Exec(`
+			UPDATE task_recurrences SET task_id=$2, next_due=$3, occurrences=$4, updated_at=NOW()
+			WHERE task_id=$1
+		`, taskID, newID, following.Format(dateLayout), occurrences)
+	} else {
+		_, err = tx.Exec(`DELETE FROM task_recurrences WHERE task_id=$1`, taskID)
+	}
+	if err != nil {
+		return "", err
+	}
+	return newID, tx.Commit()
+}
+
+// recurrenceTargetList picks the list for the next instance: the series' home
+// list, else the current one, else the first list on the current board. Only
+// live lists outside the 'done' category qualify; "" means none does.
+func recurrenceTargetList(q queryer, homeList sql.NullString, curList string) string {
+	var id string
+	_ = q.QueryRow(`
+		SELECT l.id FROM lists l JOIN boards b ON b.id = l.board_id
+		WHERE (l.id = $1::uuid OR l.board_id = (SELECT board_id FROM lists WHERE id = $2::uuid))
+		  AND l.category <> 'done'
+		  AND l.archived_at IS NULL AND l.deleted_at IS NULL
+		  AND b.archived_at IS NULL AND b.deleted_at IS NULL
+		ORDER BY COALESCE(l.id = $1::uuid, false) DESC, l.id = $2::uuid DESC, l.position
+		LIMIT 1
+	`, homeList, curList).Scan(&id)
+	return id
+}
+
+// cloneTaskInstance copies a task (fields, assignees, custom values and
+// checklists with items unchecked) to the end of listID with a new due date;
+// a start date keeps its distance from the due date.
+func cloneTaskInstance(tx *sql.Tx, taskID, listID string, due time.Time) (string, error) {
+	var newID string
+	if err := tx.QueryRow(`
+		INSERT INTO tasks (list_id, title, description, position, created_by, priority, estimate, due_date, start_date, parent_task_id)
+		SELECT $2, title, description, $3, created_by, priority, estimate, $4, $4::date - (due_date - start_date), parent_task_id
+		FROM tasks WHERE id=$1
+		RETURNING id
+	`, taskID, listID, nextTaskPosition(tx, listID), due.Format(dateLayout)).Scan(&newID); err != nil {
+		return "", err
+	}
+	if err := recordTransition(tx, newID, "", listID, ""); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO task_assignees (task_id, user_id)
+		SELECT $2::uuid, user_id FROM task_assignees WHERE task_id=$1
+	`, taskID, newID); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO task_custom_values (task_id, field_id, value)
+		SELECT $2::uuid, field_id, value FROM task_custom_values WHERE task_id=$1
+	`, taskID, newID); err != nil {
+		return "", err
+	}
+	// checklists: map old ids to new ones in one statement, then copy items
+	if _, err := tx.Exec(`
+		WITH src AS (
+		  SELECT id, title, position, uuid_generate_v4() AS new_id FROM checklists WHERE task_id=$1
+		), copied AS (
+		  INSERT INTO checklists (id, task_id, title, position)
+		  SELECT new_id, $2::uuid, title, position FROM src
+		)
+		INSERT INTO checklist_items (checklist_id, body, position, assignee_id)
+		SELECT src.new_id, i.body, i.position, i.assignee_id
+		FROM checklist_items i JOIN src ON src.id = i.checklist_id
+	`, taskID, newID); err != nil {
+		return "", err
+	}
+	return newID, nil
+}
+
+// ---- /api/tasks/recurrence ----
+// GET ?task_id=...                               → rule, next date and a short preview
+// POST ?task_id=... { rrule, starts_on? }        → set or replace the rule
+// DELETE ?task_id=...                            → stop recurring
+
+type RecurrenceDTO struct {
+	TaskID      string   `json:"task_id"`
+	RRule       string   `json:"rrule"`
+	StartsOn    string   `json:"starts_on"`
+	NextDue     string   `json:"next_due"`
+	Occurrences int      `json:"occurrences"`
+	ListID      *string  `json:"list_id"`
+	Upcoming    []string `json:"upcoming"`
+}
+
+func loadRecurrence(q queryer, taskID string) (RecurrenceDTO, error) {
+	var out RecurrenceDTO
+	var startsOn, nextDue time.Time
+	var listID sql.NullString
+	err := q.QueryRow(`
+		SELECT task_id, rrule, starts_on, next_due, occurrences, list_id
+		FROM task_recurrences WHERE task_id=$1
+	`, taskID).Scan(&out.TaskID, &out.RRule, &startsOn, &nextDue, &out.Occurrences, &listID)
+	if err != nil {
+		return out, err
+	}
+	out.StartsOn = startsOn.Format(dateLayout)
+	out.NextDue = nextDue.Format(dateLayout)
+	if listID.Valid {
+		out.ListID = &listID.String
+	}
+	out.Upcoming = make([]string, 0, 5)
+	if rule, err := parseRRule(out.RRule); err == nil {
+		d, ok := nextDue, true
+		for n := out.Occurrences; ok && len(out.Upcoming) < 5 && (rule.Count == 0 || n < rule.Count); n++ {
+			out.Upcoming = append(out.Upcoming, d.Format(dateLayout))
+			d, ok = rule.next(startsOn, d)
+		}
+	}
+	return out, nil
+}
+
+func taskRecurrenceHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	switch r.Method {
+	case http.MethodGet:
+		sess, ok := getSessionFromRequest(r, db)
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		taskID := r.URL.Query().Get("task_id")
+		if taskID == "" || !canAccessTask(db, sess, taskID) {
+			http.Error(w, "not found or forbidden", http.StatusNotFound)
+			return
+		}
+		out, err := loadRecurrence(db, taskID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "task does not recur", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "query failed", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(out)
+	case http.MethodPost:
+		setRecurrenceHandler(w, r, db)
+	case http.MethodDelete:
+		sess, ok := requireAuthAndCSRF(w, r, db)
+		if !ok {
+			return
+		}
+		taskID := r.URL.Query().Get("task_id")
+		if taskID == "" || !canAccessTask(db, sess, taskID) {
+			http.Error(w, "not found or forbidden", http.StatusNotFound)
+			return
+		}
+		if _, err := db.Exec(`DELETE FROM task_recurrences WHERE task_id=$1`, taskID); err != nil {
+			http.Error(w, "delete failed", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+type setRecurrenceReq struct {
+	RRule    string `json:"rrule"`
+	StartsOn string `json:"starts_on,omitempty"` // default: the task's due date, else today
+}
+
+func setRecurrenceHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	taskID := r.URL.Query().Get("task_id")
+	if taskID == "" {
+		http.Error(w, "missing task_id", http.StatusBadRequest)
+		return
+	}
+	var req setRecurrenceReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	rule, err := parseRRule(req.RRule)
+	if err != nil {
+		http.Error(w, "rrule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !canAccessTask(db, sess, taskID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	var listID, category string
+	var due sql.NullTime
+	if err := db.QueryRow(`
+		SELECT t.list_id, l.category, t.due_date FROM tasks t JOIN lists l ON l.id = t.list_id WHERE t.id=$1
+	`, taskID).Scan(&listID, &category, &due); err != nil {
+		http.Error(w, "lookup failed", http.StatusInternalServerError)
+		return
+	}
+	if category == "done" {
+		http.Error(w, "move the task out of its done list before making it recur", http.StatusConflict)
+		return
+	}
+
+	start := today()
+	if due.Valid {
+		start = due.Time.UTC()
+	}
+	if req.StartsOn != "" {
+		if start, err = time.Parse(dateLayout, req.StartsOn); err != nil {
+			http.Error(w, "starts_on must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+	next, more := rule.next(start, start)
+	if !more || rule.Count == 1 {
+		http.Error(w, "rule has no occurrences after the first", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := db.Exec(`
+		INSERT INTO task_recurrences (task_id, rrule, starts_on, next_due, list_id, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (task_id) DO UPDATE
+		SET rrule=EXCLUDED.rrule, starts_on=EXCLUDED.starts_on, next_due=EXCLUDED.next_due,
+		    occurrences=1, list_id=EXCLUDED.list_id, updated_at=NOW()
+	`, taskID, rule.String(), start.Format(dateLayout), next.Format(dateLayout), listID, sess.UserID); err != nil {
+		http.Error(w, "save failed", http.StatusBadRequest)
+		return
+	}
+
+	out, err := loadRecurrence(db, taskID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,105 @@
+// handlers_sessions.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type sessionItem struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	ExpiresAt time.Time `json:"expires_at"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Current   bool      `json:"current"`
+}
+
+// /api/sessions (GET list, DELETE ?id= revoke one)
+func sessionsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	switch r.Method {
+	case http.MethodGet:
+		listSessionsHandler(w, r, db)
+	case http.MethodDelete:
+		revokeSessionHandler(w, r, db)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listSessionsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := getSessionFromRequest(r, db)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if sess.TokenID != "" {
+		http.Error(w, "not allowed with an API token", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	items := make([]sessionItem, 0)
+	sessionsMu.Lock()
+	for _, s := range sessions {
+		if s.UserID != sess.UserID || now.After(s.Expires) {
+			continue
+		}
+		items = append(items, sessionItem{
+			ID: s.ID, CreatedAt: s.CreatedAt, LastSeen: s.LastSeen, ExpiresAt: s.Expires,
+			IP: s.IP, UserAgent: s.UserAgent, Current: s.ID == sess.ID,
+		})
+	}
+	sessionsMu.Unlock()
+	sort.Slice(items, func(i, j int) bool { return items[i].LastSeen.After(items[j].LastSeen) })
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+func revokeSessionHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireBrowserSession(w, r, db)
+	if !ok {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+
+	found := false
+	sessionsMu.Lock()
+	for sid, s := range sessions {
+		if s.ID == id && s.UserID == sess.UserID {
+			delete(sessions, sid)
+			found = true
+			break
+		}
+	}
+	sessionsMu.Unlock()
+	if !found {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /api/sessions/revoke-others — sign out everywhere except this browser.
+func revokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := requireBrowserSession(w, r, db)
+	if !ok {
+		return
+	}
+	n := deleteUserSessions(sess.UserID, sess.ID)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int{"revoked": n})
+}
@@ -0,0 +1,236 @@
+// handlers_subtasks.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+)
+
+// ---- parent/child tasks ----
+// A task may have one parent anywhere in the same workspace (other lists or
+// boards included). Cycles are refused; a child counts as done when it sits
+// in a list whose category is 'done'.
+
+type TaskSummaryDTO struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	ListID  string `json:"list_id"`
+	BoardID string `json:"board_id"`
+	Done    bool   `json:"done"`
+}
+
+type TaskHierarchyDTO struct {
+	TaskID   string           `json:"task_id"`
+	Parent   *TaskSummaryDTO  `json:"parent"`
+	Children []TaskSummaryDTO `json:"children"`
+	Progress ProgressDTO      `json:"progress"`
+}
+
+const taskSummarySelect = `
+	SELECT t.id, t.title, t.list_id, l.board_id, l.category = 'done'
+	FROM tasks t JOIN lists l ON l.id = t.list_id`
+
+// subtaskProgress counts done/total direct children of a task; trashed
+// children don't count.
+func subtaskProgress(q queryer, taskID string) ProgressDTO {
+	var p ProgressDTO
+	_ = q.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE l.category = 'done'), COUNT(*)
+		FROM tasks t JOIN lists l ON l.id = t.list_id
+		WHERE t.parent_task_id = $1 AND t.deleted_at IS NULL
+	`, taskID).Scan(&p.Done, &p.Total)
+	return p
+}
+
+func taskWorkspaceID(q queryer, taskID string) (string, error) {
+	var wsID string
+	err := q.QueryRow(`
+		SELECT b.workspace_id FROM tasks t
+		JOIN lists l ON l.id = t.list_id
+		JOIN boards b ON b.id = l.board_id
+		WHERE t.id = $1
+	`, taskID).Scan(&wsID)
+	return wsID, err
+}
+
+// ---- GET /api/tasks/hierarchy?id=... ----
+
+func taskHierarchyHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := getSessionFromRequest(r, db)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	if !canAccessTask(db, sess, id) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	out := TaskHierarchyDTO{TaskID: id, Children: make([]TaskSummaryDTO, 0)}
+
+	var p TaskSummaryDTO
+	err := db.QueryRow(taskSummarySelect+`
+		WHERE t.id = (SELECT parent_task_id FROM tasks WHERE id=$1)
+	`, id).Scan(&p.ID, &p.Title, &p.ListID, &p.BoardID, &p.Done)
+	if err == nil {
+		out.Parent = &p
+	} else if err != sql.ErrNoRows {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.Query(taskSummarySelect+`
+		WHERE t.parent_task_id = $1 AND t.deleted_at IS NULL
+		ORDER BY t.created_at ASC
+	`, id)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c TaskSummaryDTO
+		if err := rows.Scan(&c.ID, &c.Title, &c.ListID, &c.BoardID, &c.Done); err == nil {
+			out.Children = append(out.Children, c)
+			out.Progress.Total++
+			if c.Done {
+				out.Progress.Done++
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// ---- /api/tasks/children ----
+// POST { parent_id, child_id }  → attach (re-parents if the child already has one)
+// DELETE ?child_id=...          → detach
+
+type attachChildReq struct {
+	ParentID string `json:"parent_id"`
+	ChildID  string `json:"child_id"`
+}
+
+func taskChildrenHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	switch r.Method {
+	case http.MethodPost:
+		attachChildHandler(w, r, db)
+	case http.MethodDelete:
+		detachChildHandler(w, r, db)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func attachChildHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	var req attachChildReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ParentID == "" || req.ChildID == "" {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if req.ParentID == req.ChildID {
+		http.Error(w, "a task cannot be its own parent", http.StatusBadRequest)
+		return
+	}
+	if !canAccessTask(db, sess, req.ParentID) || !canAccessTask(db, sess, req.ChildID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	parentWS, err1 := taskWorkspaceID(tx, req.ParentID)
+	childWS, err2 := taskWorkspaceID(tx, req.ChildID)
+	if err1 != nil || err2 != nil {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+	if parentWS != childWS {
+		http.Error(w, "parent and child must be in the same workspace", http.StatusBadRequest)
+		return
+	}
+
+	// Serialise hierarchy edits per workspace so two concurrent attaches
+	// can't each pass the cycle check and together form a loop.
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('task-tree:' || $1))`, parentWS); err != nil {
+		http.Error(w, "lock failed", http.StatusInternalServerError)
+		return
+	}
+
+	// Refuse if the child is the proposed parent or one of its ancestors.
+	var cycle bool
+	if err := tx.QueryRow(`
+		WITH RECURSIVE ancestors(id) AS (
+		  SELECT $1::uuid
+		  UNION
+		  SELECT t.parent_task_id FROM tasks t
+		  JOIN ancestors a ON t.id = a.id
+		  WHERE t.parent_task_id IS NOT NULL
+		)
+		SELECT EXISTS(SELECT 1 FROM ancestors WHERE id = $2::uuid)
+	`, req.ParentID, req.ChildID).Scan(&cycle); err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	if cycle {
+		http.Error(w, "that would create a cycle", http.StatusConflict)
+		return
+	}
+
+	if _, err := tx.Exec(`UPDATE tasks SET parent_task_id=$1, updated_at=NOW() WHERE id=$2`, req.ParentID, req.ChildID); err != nil {
+		http.Error(w, "update failed", http.StatusBadRequest)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"parent_id": req.ParentID,
+		"child_id":  req.ChildID,
+		"progress":  subtaskProgress(db, req.ParentID),
+	})
+}
+
+func detachChildHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	childID := r.URL.Query().Get("child_id")
+	if childID == "" {
+		http.Error(w, "missing child_id", http.StatusBadRequest)
+		return
+	}
+	if !canAccessTask(db, sess, childID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+	if _, err := db.Exec(`UPDATE tasks SET parent_task_id=NULL, updated_at=NOW() WHERE id=$1 AND parent_task_id IS NOT NULL`, childID); err != nil {
+		http.Error(w, "update failed", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,424 @@
+// handlers_taskcopy.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ---- copying and cross-board moves ----
+// Assignees and "user" custom values must be members of the task's workspace,
+// and custom fields belong to a board. When a task lands on another board
+// these are carried over where they still make sense and dropped otherwise;
+// DroppedDTO tells the client what was lost.
+
+type DroppedDTO struct {
+	Assignees    []string `json:"assignees,omitempty"`     // user ids outside the destination workspace
+	CustomFields []string `json:"custom_fields,omitempty"` // field names with no match on the destination board
+	Links        int      `json:"links,omitempty"`         // links to tasks in another workspace
+	Subtasks     int      `json:"subtasks,omitempty"`      // parent/child links to another workspace
+}
+
+func (d *DroppedDTO) empty() bool {
+	return len(d.Assignees) == 0 && len(d.CustomFields) == 0 && d.Links == 0 && d.Subtasks == 0
+}
+
+// add folds o into d, keeping the id and name lists free of repeats.
+func (d *DroppedDTO) add(o *DroppedDTO) {
+	d.Assignees = appendMissing(d.Assignees, o.Assignees)
+	d.CustomFields = appendMissing(d.CustomFields, o.CustomFields)
+	d.Links += o.Links
+	d.Subtasks += o.Subtasks
+}
+
+func appendMissing(dst, src []string) []string {
+	for _, s := range src {
+		found := false
+		for _, x := range dst {
+			if x == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, s)
+		}
+	}
+	return dst
+}
+
+// carryCustomValues copies fromTaskID's custom values onto toTaskID, re-keyed
+// to the fields of the board holding listID by name and type (as templates
+// do). Values with no matching field, or that don't validate there, are
+// dropped and their field names returned. fromTaskID may equal toTaskID, and
+// a value stays on its own field when that field is still on the board.
+func carryCustomValues(tx *sql.Tx, fromTaskID, toTaskID, listID string) ([]string, error) {
+	type value struct {
+		fieldID, name, typ string
+		raw                json.RawMessage
+	}
+	rows, err := tx.Query(`
+		SELECT f.id, f.name, f.type, v.value
+		FROM task_custom_values v JOIN board_custom_fields f ON f.id = v.field_id
+		WHERE v.task_id = $1
+		ORDER BY f.position ASC
+	`, fromTaskID)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]value, 0)
+	for rows.Next() {
+		var v value
+		var raw []byte
+		if err := rows.Scan(&v.fieldID, &v.name, &v.typ, &raw); err == nil {
+			v.raw = raw
+			values = append(values, v)
+		}
+	}
+	rows.Close()
+
+	if fromTaskID == toTaskID {
+		if _, err := tx.Exec(`DELETE FROM task_custom_values WHERE task_id=$1`, toTaskID); err != nil {
+			return nil, err
+		}
+	}
+
+	dropped := make([]string, 0)
+	for _, v := range values {
+		f, err := scanCustomField(tx.QueryRow(`
+			SELECT f.id, f.board_id, f.name, f.type, f.options, f.position
+			FROM board_custom_fields f JOIN lists l ON l.board_id = f.board_id
+			WHERE l.id = $1 AND f.name = $2 AND f.type = $3
+			ORDER BY f.id = $4 DESC
+			LIMIT 1
+		`, listID, v.name, v.typ, v.fieldID))
+		if err != nil {
+			dropped = append(dropped, v.name)
+			continue
+		}
+		stored, err := validateCustomValue(tx, f, toTaskID, v.raw)
+		if err != nil || stored == nil {
+			dropped = append(dropped, v.name)
+			continue
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO task_custom_values (task_id, field_id, value) VALUES ($1,$2,$3::jsonb)`,
+			toTaskID, f.ID, string(stored),
+		); err != nil {
+			return nil, err
+		}
+	}
+	return dropped, nil
+}
+
+// rehomeTask fixes up a task that has just been moved onto another board, or
+// whose board has moved workspace: custom values are carried to the current
+// board's fields, a swimlane or recurrence home list on another board is
+// cleared, and anything tying the task to a workspace it no longer belongs to
+// (assignees, subtask and task links) is removed.
+func rehomeTask(tx *sql.Tx, taskID string) (*DroppedDTO, error) {
+	d := &DroppedDTO{}
+	var listID string
+	if err := tx.QueryRow(`SELECT list_id FROM tasks WHERE id=$1`, taskID).Scan(&listID); err != nil {
+		return nil, err
+	}
+	fields, err := carryCustomValues(tx, taskID, taskID, listID)
+	if err != nil {
+		return nil, err
+	}
+	d.CustomFields = fields
+
+	if _, err := tx.Exec(`
+		UPDATE tasks SET lane_id=NULL
+		WHERE id=$1 AND lane_id NOT IN (
+		  SELECT bl.id FROM board_lanes bl JOIN lists l ON l.board_id = bl.board_id WHERE l.id = $2
+		)
+	`, taskID, listID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`
+		UPDATE task_recurrences SET list_id=NULL, updated_at=NOW()
+		WHERE task_id=$1 AND list_id NOT IN (
+		  SELECT id FROM lists WHERE board_id = (SELECT board_id FROM lists WHERE id = $2)
+		)
+	`, taskID, listID); err != nil {
+		return nil, err
+	}
+
+	wsID, err := taskWorkspaceID(tx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(`
+		DELETE FROM task_assignees a
+		WHERE a.task_id = $1
+		  AND NOT EXISTS (SELECT 1 FROM workspace_members m WHERE m.workspace_id = $2 AND m.user_id = a.user_id)
+		RETURNING a.user_id
+	`, taskID, wsID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err == nil {
+			d.Assignees = append(d.Assignees, uid)
+		}
+	}
+	rows.Close()
+
+	if _, err := tx.Exec(`
+		UPDATE checklist_items i SET assignee_id = NULL, updated_at = NOW()
+		FROM checklists c
+		WHERE c.id = i.checklist_id AND c.task_id = $1 AND i.assignee_id IS NOT NULL
+		  AND NOT EXISTS (SELECT 1 FROM workspace_members m WHERE m.workspace_id = $2 AND m.user_id = i.assignee_id)
+	`, taskID, wsID); err != nil {
+		return nil, err
+	}
+
+	// tasks in another workspace, relative to this one
+	const foreign = `
+		SELECT t.id FROM tasks t
+		JOIN lists l ON l.id = t.list_id
+		JOIN boards b ON b.id = l.board_id
+		WHERE b.workspace_id <> $2`
+	res, err := tx.Exec(`
+		UPDATE tasks SET parent_task_id = NULL, updated_at = NOW()
+		WHERE (id = $1 AND parent_task_id IN (`+foreign+`))
+		   OR (parent_task_id = $1 AND id IN (`+foreign+`))
+	`, taskID, wsID)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := res.RowsAffected()
+	d.Subtasks = int(n)
+
+	res, err = tx.Exec(`
+		DELETE FROM task_links
+		WHERE (from_task_id = $1 AND to_task_id IN (`+foreign+`))
+		   OR (to_task_id = $1 AND from_task_id IN (`+foreign+`))
+	`, taskID, wsID)
+	if err != nil {
+		return nil, err
+	}
+	n, _ = res.RowsAffected()
+	d.Links = int(n)
+	return d, nil
+}
+
+// ---- POST /api/tasks/copy ----
+// { task_id, to_list_id?, to_index?, title?, include? }
+// to_list_id defaults to the task's own list and to_index to the end of it.
+// include picks what comes along besides the basic fields (title, priority,
+// estimate, due date); it defaults to everything except comments.
+// "attachments" copies no rows of its own: uploads are referenced by URL from
+// the description and comments, and the copy keeps those URLs pointing at the
+// same stored files (task uploads are never deleted, so sharing them is safe).
+
+var taskCopyParts = map[string]bool{
+	"description": true, "checklists": true, "comments": true, "assignees": true, "custom_fields": true,
+	"attachments": true,
+}
+
+type copyTaskReq struct {
+	TaskID   string   `json:"task_id"`
+	ToListID string   `json:"to_list_id"`
+	ToIndex  *int     `json:"to_index"`
+	Title    *string  `json:"title"`
+	Include  []string `json:"include"`
+}
+
+type copyTaskResp struct {
+	ID       string      `json:"id"`
+	ListID   string      `json:"list_id"`
+	Position int         `json:"position"`
+	Dropped  *DroppedDTO `json:"dropped,omitempty"`
+	OverWIP  bool        `json:"over_wip,omitempty"`
+}
+
+func copyTaskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	var req copyTaskReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TaskID == "" {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	include := map[string]bool{"description": true, "checklists": true, "assignees": true, "custom_fields": true, "attachments": true}
+	if req.Include != nil {
+		include = make(map[string]bool)
+		for _, p := range req.Include {
+			if !taskCopyParts[p] {
+				http.Error(w, "include may contain description, checklists, comments, assignees, custom_fields, attachments", http.StatusBadRequest)
+				return
+			}
+			include[p] = true
+		}
+	}
+	if req.Title != nil {
+		t := strings.TrimSpace(*req.Title)
+		if t == "" {
+			http.Error(w, "title cannot be empty", http.StatusBadRequest)
+			return
+		}
+		req.Title = &t
+	}
+
+	if !canAccessTask(db, sess, req.TaskID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+	if req.ToListID == "" {
+		if err := db.QueryRow(`SELECT list_id FROM tasks WHERE id=$1`, req.TaskID).Scan(&req.ToListID); err != nil {
+			http.Error(w, "lookup failed", http.StatusInternalServerError)
+			return
+		}
+	}
+	if !canAccessList(db, sess, req.ToListID) {
+		http.Error(w, "list not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if !listIsLive(tx, req.ToListID) {
+		http.Error(w, "list is archived or in the trash", http.StatusConflict)
+		return
+	}
+	overWIP, rejectWIP := wipExceeded(tx, req.ToListID)
+	if overWIP && rejectWIP {
+		http.Error(w, "list is at its WIP limit", http.StatusConflict)
+		return
+	}
+
+	// place it: end of the list, or at to_index with the rest shifted down
+	pos := nextTaskPosition(tx, req.ToListID)
+	if req.ToIndex != nil && *req.ToIndex < pos {
+		pos = max(*req.ToIndex, 0)
+		if _, err := tx.Exec(`
+			UPDATE tasks SET position = position + 1
+			WHERE list_id = $1 AND position >= $2 AND archived_at IS NULL AND deleted_at IS NULL
+		`, req.ToListID, pos); err != nil {
+			http.Error(w, "make room failed", http.StatusBadRequest)
+			return
+		}
+	}
+
+	out := copyTaskResp{ListID: req.ToListID, Position: pos, OverWIP: overWIP}
+	if err := tx.QueryRow(`
+		INSERT INTO tasks (list_id, title, description, position, created_by, priority, estimate, due_date, start_date, lane_id)
+		SELECT $2, COALESCE($3, title), CASE WHEN $4 THEN description ELSE '' END, $5, $6, priority, estimate, due_date, start_date,
+		       CASE WHEN lane_id IN (
+		         SELECT bl.id FROM board_lanes bl JOIN lists l ON l.board_id = bl.board_id WHERE l.id = $2::uuid
+		       ) THEN lane_id END
+		FROM tasks WHERE id=$1
+		RETURNING id
+	`, req.TaskID, req.ToListID, req.Title, include["description"], pos, sess.UserID).Scan(&out.ID); err != nil {
+		http.Error(w, "copy failed", http.StatusBadRequest)
+		return
+	}
+	if err := recordTransition(tx, out.ID, "", req.ToListID, sess.UserID); err != nil {
+		http.Error(w, "copy failed", http.StatusBadRequest)
+		return
+	}
+	wsID, err := taskWorkspaceID(tx, out.ID)
+	if err != nil {
+		http.Error(w, "lookup failed", http.StatusInternalServerError)
+		return
+	}
+
+	dropped := &DroppedDTO{}
+	if include["assignees"] {
+		rows, err := tx.Query(`
+			SELECT a.user_id, EXISTS(SELECT 1 FROM workspace_members m WHERE m.workspace_id = $2 AND m.user_id = a.user_id)
+			FROM task_assignees a WHERE a.task_id = $1
+		`, req.TaskID, wsID)
+		if err != nil {
+			http.Error(w, "assignees query failed", http.StatusInternalServerError)
+			return
+		}
+		keep := make([]string, 0)
+		for rows.Next() {
+			var uid string
+			var member bool
+			if err := rows.Scan(&uid, &member); err != nil {
+				continue
+			}
+			if member {
+				keep = append(keep, uid)
+			} else {
+				dropped.Assignees = append(dropped.Assignees, uid)
+			}
+		}
+		rows.Close()
+		for _, uid := range keep {
+			if _, err := tx.Exec(`INSERT INTO task_assignees (task_id, user_id) VALUES ($1,$2)`, out.ID, uid); err != nil {
+				http.Error(w, "assignees copy failed", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	if include["checklists"] {
+		// same shape as cloneTaskInstance, but item state is kept and
+		// assignees from outside the destination workspace are cleared
+		if _, err := tx.Exec(`
+			WITH src AS (
+			  SELECT id, title, position, uuid_generate_v4() AS new_id FROM checklists WHERE task_id=$1
+			), copied AS (
+			  INSERT INTO checklists (id, task_id, title, position)
+			  SELECT new_id, $2::uuid, title, position FROM src
+			)
+			INSERT INTO checklist_items (checklist_id, body, position, done, done_at, due_date, assignee_id)
+			SELECT src.new_id, i.body, i.position, i.done, i.done_at, i.due_date,
+			       CASE WHEN EXISTS (SELECT 1 FROM workspace_members m WHERE m.workspace_id = $3 AND m.user_id = i.assignee_id)
+			            THEN i.assignee_id END
+			FROM checklist_items i JOIN src ON src.id = i.checklist_id
+		`, req.TaskID, out.ID, wsID); err != nil {
+			http.Error(w, "checklists copy failed", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if include["comments"] {
+		if _, err := tx.Exec(`
+			INSERT INTO comments (task_id, author_id, body, created_at)
+			SELECT $2::uuid, author_id, body, created_at FROM comments WHERE task_id=$1
+		`, req.TaskID, out.ID); err != nil {
+			http.Error(w, "comments copy failed", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if include["custom_fields"] {
+		fields, err := carryCustomValues(tx, req.TaskID, out.ID, req.ToListID)
+		if err != nil {
+			http.Error(w, "custom fields copy failed", http.StatusBadRequest)
+			return
+		}
+		dropped.CustomFields = fields
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+	if !dropped.empty() {
+		out.Dropped = dropped
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,832 @@
+// handlers_taskquery.go
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---- GET /api/tasks?board_id=... ----
+// A flat, paged view of a board's live tasks for the table view. Rows carry
+// the same data as the board payload's tasks, plus list and timestamps.
+//
+//	filter=<expr>     e.g. priority>=high AND (assignee=me OR assignee=null) AND NOT done=true
+//	sort=a,-b,...     list, position, title, assignee, priority, estimate, due_date,
+//	                  start_date, created, updated, cf.<field_id>; default list,position
+//	fields=a,b,...    sparse rows: any TaskRowDTO key, or cf.<field_id>; id is always included
+//	limit=n           1..500, default 50
+//	cursor=...        next_cursor from the previous page, with the same sort
+//
+// Filter expressions are conditions `field op value` joined with AND (or
+// just a space), OR and NOT, grouped with parentheses. Operators are
+// = != < <= > >= ~ (contains, case-insensitive) and !~; a comma list after
+// = or != means any of; the bare word null tests for no value; values with
+// spaces go in double quotes. Fields: title, description, list, category,
+// lane, parent, priority, assignee (a user id or me), estimate, due_date,
+// start_date, created, updated, done, blocked and cf.<field_id>.
+
+const (
+	taskQueryDefaultLimit = 50
+	taskQueryMaxLimit     = 500
+	maxFilterLength       = 2000
+	maxFilterConds        = 50
+)
+
+// TaskRowDTO is a board task with the context a table row needs.
+type TaskRowDTO struct {
+	TaskDTO
+	ListID    string    `json:"list_id"`
+	ListName  string    `json:"list_name"`
+	Category  string    `json:"category"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// taskRowFields are the JSON keys fields= accepts; extras lists the ones
+// fillTaskExtras loads.
+var (
+	taskRowFields = map[string]bool{
+		"id": true, "title": true, "description": true, "position": true, "priority": true, "estimate": true,
+		"due_date": true, "start_date": true, "parent_id": true, "lane_id": true,
+		"list_id": true, "list_name": true, "category": true, "created_at": true, "updated_at": true,
+	}
+	taskRowExtras = map[string]bool{
+		"assignees": true, "comment_count": true, "checklist_progress": true, "subtask_progress": true,
+		"blocked": true, "recurrence": true, "time_spent_seconds": true, "custom_fields": true,
+	}
+)
+
+type taskQueryResp struct {
+	BoardID    string  `json:"board_id"`
+	Total      int     `json:"total"`
+	Tasks      any     `json:"tasks"` // []TaskRowDTO, or objects with the requested fields
+	NextCursor *string `json:"next_cursor"`
+}
+
+func queryTasksHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := getSessionFromRequest(r, db)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	q := r.URL.Query()
+	boardID := q.Get("board_id")
+	if boardID == "" || !canAccessBoard(db, sess, boardID) {
+		http.Error(w, "board not found or forbidden", http.StatusNotFound)
+		return
+	}
+	limit := taskQueryDefaultLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > taskQueryMaxLimit {
+			http.Error(w, "limit must be 1..500", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	fields, err := loadBoardCustomFields(db, boardID)
+	if err != nil {
+		http.Error(w, "custom fields query failed", http.StatusInternalServerError)
+		return
+	}
+	byID := make(map[string]CustomFieldDTO, len(fields))
+	for _, f := range fields {
+		byID[f.ID] = f
+	}
+
+	// sparse fields
+	var wantKeys map[string]bool
+	var wantCF map[string]bool // nil with custom_fields wanted: all of them
+	if v := q.Get("fields"); v != "" {
+		allCF := false
+		wantKeys = map[string]bool{"id": true}
+		for _, k := range strings.Split(v, ",") {
+			k = strings.TrimSpace(k)
+			switch {
+			case strings.HasPrefix(k, "cf."):
+				if _, ok := byID[k[3:]]; !ok {
+					http.Error(w, "unknown custom field "+strconv.Quote(k[3:]), http.StatusBadRequest)
+					return
+				}
+				if wantCF == nil {
+					wantCF = make(map[string]bool)
+				}
+				wantCF[k[3:]] = true
+				wantKeys["custom_fields"] = true
+			case taskRowFields[k] || taskRowExtras[k]:
+				wantKeys[k] = true
+				allCF = allCF || k == "custom_fields"
+			default:
+				http.Error(w, "unknown field "+strconv.Quote(k), http.StatusBadRequest)
+				return
+			}
+		}
+		if allCF {
+			wantCF = nil
+		}
+	}
+
+	b := &sqlBuilder{args: []any{boardID}}
+	where := "l.board_id = $1 AND t.archived_at IS NULL AND t.deleted_at IS NULL AND l.archived_at IS NULL AND l.deleted_at IS NULL"
+	if expr := strings.TrimSpace(q.Get("filter")); expr != "" {
+		cond, err := parseTaskFilter(expr, b, byID, sess.UserID)
+		if err != nil {
+			http.Error(w, "filter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		where += " AND (" + cond + ")"
+	}
+
+	sortParam := q.Get("sort")
+	if sortParam == "" {
+		sortParam = "list,position"
+	}
+	keys, err := parseTaskSort(sortParam, byID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out := taskQueryResp{BoardID: boardID}
+	if err := db.QueryRow(`
+		SELECT COUNT(*) FROM tasks t JOIN lists l ON l.id = t.list_id WHERE `+where, b.args...,
+	).Scan(&out.Total); err != nil {
+		log.Println("task query count:", err)
+		http.Error(w, "query failed", http.StatusBadRequest)
+		return
+	}
+
+	// ORDER BY and the matching cursor columns: every key becomes "is null"
+	// (nulls last either way) and the coalesced value, and t.id breaks ties,
+	// so the order is total and a page can resume strictly after a row.
+	order := make([]string, 0, 2*len(keys)+1)
+	cursorCols := make([]string, 0, 2*len(keys)+1)
+	parts := make([]keysetPart, 0, 2*len(keys)+1)
+	for _, k := range keys {
+		isNull := "((" + k.expr + ") IS NULL)"
+		val := "COALESCE(" + k.expr + ", " + k.zero + ")"
+		order = append(order, isNull+" ASC", val+" "+k.dir())
+		cursorCols = append(cursorCols, isNull+"::text", val+"::text")
+		parts = append(parts, keysetPart{isNull, "boolean", false}, keysetPart{val, k.typ, k.desc})
+	}
+	order = append(order, "t.id ASC")
+	cursorCols = append(cursorCols, "t.id::text")
+	parts = append(parts, keysetPart{"t.id", "uuid", false})
+
+	if c := q.Get("cursor"); c != "" {
+		vals, err := decodeTaskCursor(c, sortParam, len(parts))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		where += " AND " + keysetAfter(parts, vals, b)
+	}
+
+	rows, err := db.Query(`
+		SELECT `+taskDTOCols+`, t.list_id, l.name, l.category, t.created_at, t.updated_at, `+strings.Join(cursorCols, ", ")+`
+		FROM tasks t JOIN lists l ON l.id = t.list_id
+		WHERE `+where+`
+		ORDER BY `+strings.Join(order, ", ")+`
+		LIMIT `+strconv.Itoa(limit+1), b.args...)
+	if err != nil {
+		log.Println("task query:", err)
+		http.Error(w, "query failed", http.StatusBadRequest)
+		return
+	}
+	taskRows := make([]TaskRowDTO, 0, limit)
+	var lastCursor []string
+	for rows.Next() {
+		var row TaskRowDTO
+		cur := make([]string, len(parts))
+		extra := []any{&row.ListID, &row.ListName, &row.Category, &row.CreatedAt, &row.UpdatedAt}
+		for i := range cur {
+			extra = append(extra, &cur[i])
+		}
+		t, err := scanTaskDTO(rows, extra...)
+		if err != nil {
+			rows.Close()
+			http.Error(w, "scan failed", http.StatusInternalServerError)
+			return
+		}
+		if len(taskRows) == limit {
+			// the extra row only says there is a next page
+			s := encodeTaskCursor(sortParam, lastCursor)
+			out.NextCursor = &s
+			break
+		}
+		row.TaskDTO = t
+		taskRows = append(taskRows, row)
+		lastCursor = cur
+	}
+	rows.Close()
+
+	var want func(string) bool
+	if wantKeys != nil {
+		want = func(k string) bool { return wantKeys[k] }
+	}
+	page := make([]*TaskDTO, len(taskRows))
+	for i := range taskRows {
+		page[i] = &taskRows[i].TaskDTO
+	}
+	if err := fillTaskExtras(db, page, want); err != nil {
+		log.Println("task query:", err)
+		http.Error(w, "task details query failed", http.StatusInternalServerError)
+		return
+	}
+
+	if wantKeys == nil {
+		out.Tasks = taskRows
+	} else {
+		projected := make([]map[string]json.RawMessage, 0, len(taskRows))
+		for _, row := range taskRows {
+			if wantCF != nil {
+				for id := range row.CustomFields {
+					if !wantCF[id] {
+						delete(row.CustomFields, id)
+					}
+				}
+			}
+			raw, err := json.Marshal(row)
+			if err != nil {
+				continue
+			}
+			var all map[string]json.RawMessage
+			_ = json.Unmarshal(raw, &all)
+			m := make(map[string]json.RawMessage, len(wantKeys))
+			for k := range wantKeys {
+				m[k] = all[k]
+			}
+			projected = append(projected, m)
+		}
+		out.Tasks = projected
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// ---- SQL building ----
+
+// sqlBuilder collects bind args; ph returns the placeholder for a new one.
+type sqlBuilder struct {
+	args []any
+}
+
+func (b *sqlBuilder) ph(v any) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+// ---- sorting ----
+
+type sortKey struct {
+	expr string
+	typ  string // SQL type of expr, for casting cursor values back
+	zero string // stands in for NULL in the value column
+	desc bool
+}
+
+func (k sortKey) dir() string {
+	if k.desc {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+var taskSortKeys = map[string]sortKey{
+	"list":       {expr: "l.position", typ: "integer", zero: "0"},
+	"position":   {expr: "t.position", typ: "integer", zero: "0"},
+	"title":      {expr: "t.title", typ: "text", zero: "''"},
+	"assignee":   {expr: "(SELECT u.name FROM task_assignees a JOIN users u ON u.id = a.user_id WHERE a.task_id = t.id ORDER BY a.assigned_at LIMIT 1)", typ: "text", zero: "''"},
+	"priority":   {expr: priorityRankSQL, typ: "integer", zero: "0"},
+	"estimate":   {expr: "t.estimate", typ: "numeric", zero: "0"},
+	"due_date":   {expr: "t.due_date", typ: "date", zero: "'-infinity'::date"},
+	"start_date": {expr: "t.start_date", typ: "date", zero: "'-infinity'::date"},
+	"created":    {expr: "t.created_at", typ: "timestamptz", zero: "'-infinity'::timestamptz"},
+	"updated":    {expr: "t.updated_at", typ: "timestamptz", zero: "'-infinity'::timestamptz"},
+}
+
+func parseTaskSort(s string, byID map[string]CustomFieldDTO) ([]sortKey, error) {
+	keys := make([]sortKey, 0)
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		var k sortKey
+		if strings.HasPrefix(name, "cf.") {
+			f, ok := byID[name[3:]]
+			if !ok {
+				return nil, errors.New("unknown sort field " + strconv.Quote(name))
+			}
+			k = customFieldSortKey(f)
+		} else {
+			var ok bool
+			if k, ok = taskSortKeys[name]; !ok {
+				return nil, errors.New("sort accepts list, position, title, assignee, priority, estimate, due_date, start_date, created, updated, cf.<field_id>")
+			}
+		}
+		k.desc = desc
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// customFieldSortKey orders like customFieldQuery's sort. The field id is a
+// known uuid, so it is inlined rather than bound.
+func customFieldSortKey(f CustomFieldDTO) sortKey {
+	value := `(SELECT v.value FROM task_custom_values v WHERE v.task_id = t.id AND v.field_id = '` + f.ID + `')`
+	switch f.Type {
+	case "number":
+		return sortKey{expr: `(` + value + ` #>> '{}')::numeric`, typ: "numeric", zero: "0"}
+	case "checkbox":
+		return sortKey{expr: `(` + value + `)::text::boolean`, typ: "boolean", zero: "false"}
+	case "user":
+		return sortKey{expr: `(SELECT u.name FROM users u WHERE u.id = (` + value + ` #>> '{}')::uuid)`, typ: "text", zero: "''"}
+	default:
+		return sortKey{expr: value + ` #>> '{}'`, typ: "text", zero: "''"}
+	}
+}
+
+// ---- keyset cursors ----
+
+type keysetPart struct {
+	expr, typ string
+	desc      bool
+}
+
+type taskCursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+}
+
+func encodeTaskCursor(sort string, vals []string) string {
+	raw, _ := json.Marshal(taskCursor{Sort: sort, Values: vals})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeTaskCursor(s, sort string, n int) ([]string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	var c taskCursor
+	if err != nil || json.Unmarshal(raw, &c) != nil || len(c.Values) != n {
+		return nil, errors.New("bad cursor")
+	}
+	if c.Sort != sort {
+		return nil, errors.New("cursor was made with a different sort")
+	}
+	return c.Values, nil
+}
+
+// keysetAfter is "the row sorts after vals": the first differing part
+// decides, in that part's direction.
+func keysetAfter(parts []keysetPart, vals []string, b *sqlBuilder) string {
+	phs := make([]string, len(parts))
+	for i, p := range parts {
+		phs[i] = b.ph(vals[i]) + "::" + p.typ
+	}
+	ors := make([]string, 0, len(parts))
+	for i, p := range parts {
+		ands := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, parts[j].expr+" = "+phs[j])
+		}
+		op := " > "
+		if p.desc {
+			op = " < "
+		}
+		ands = append(ands, p.expr+op+phs[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")"
+}
+
+// ---- filter expressions ----
+
+type filterToken struct {
+	kind string // word, string, op, (, )
+	text string
+}
+
+func lexTaskFilter(s string) ([]filterToken, error) {
+	toks := make([]filterToken, 0)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			toks = append(toks, filterToken{kind: string(c), text: string(c)})
+			i++
+		case c == '"':
+			var sb strings.Builder
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				sb.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, errors.New("unterminated string")
+			}
+			i++
+			toks = append(toks, filterToken{kind: "string", text: sb.String()})
+		case strings.IndexByte("=!<>~", c) >= 0:
+			j := i + 1
+			for j < len(s) && j-i < 2 && strings.IndexByte("=~", s[j]) >= 0 {
+				j++
+			}
+			op := s[i:j]
+			switch op {
+			case "=", "!=", "<", "<=", ">", ">=", "~", "!~":
+			default:
+				return nil, errors.New("unknown operator " + strconv.Quote(op))
+			}
+			toks = append(toks, filterToken{kind: "op", text: op})
+			i = j
+		default:
+			j := i
+			for j < len(s) && strings.IndexByte(" \t\r\n()\"=!<>~", s[j]) < 0 {
+				j++
+			}
+			toks = append(toks, filterToken{kind: "word", text: s[i:j]})
+			i = j
+		}
+	}
+	return toks, nil
+}
+
+type filterParser struct {
+	toks   []filterToken
+	pos    int
+	conds  int
+	b      *sqlBuilder
+	fields map[string]CustomFieldDTO
+	userID string
+}
+
+// parseTaskFilter turns a filter expression into a SQL condition over
+// tasks t JOIN lists l, binding values through b.
+func parseTaskFilter(s string, b *sqlBuilder, fields map[string]CustomFieldDTO, userID string) (string, error) {
+	if len(s) > maxFilterLength {
+		return "", errors.New("too long")
+	}
+	toks, err := lexTaskFilter(s)
+	if err != nil {
+		return "", err
+	}
+	p := &filterParser{toks: toks, b: b, fields: fields, userID: userID}
+	cond, err := p.or()
+	if err != nil {
+		return "", err
+	}
+	if p.pos < len(p.toks) {
+		return "", errors.New("unexpected " + strconv.Quote(p.toks[p.pos].text))
+	}
+	return cond, nil
+}
+
+func (p *filterParser) peek() *filterToken {
+	if p.pos < len(p.toks) {
+		return &p.toks[p.pos]
+	}
+	return nil
+}
+
+func (p *filterParser) keyword(k string) bool {
+	t := p.peek()
+	if t != nil && t.kind == "word" && strings.EqualFold(t.text, k) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) or() (string, error) {
+	left, err := p.and()
+	if err != nil {
+		return "", err
+	}
+	for p.keyword("OR") {
+		right, err := p.and()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " OR " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (string, error) {
+	left, err := p.unary()
+	if err != nil {
+		return "", err
+	}
+	for {
+		// AND is optional between conditions
+		if !p.keyword("AND") {
+			if t := p.peek(); t == nil || t.kind == ")" || (t.kind == "word" && strings.EqualFold(t.text, "OR")) {
+				return left, nil
+			}
+		}
+		right, err := p.unary()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " AND " + right + ")"
+	}
+}
+
+func (p *filterParser) unary() (string, error) {
+	if p.keyword("NOT") {
+		inner, err := p.unary()
+		if err != nil {
+			return "", err
+		}
+		return "NOT " + inner, nil
+	}
+	t := p.peek()
+	if t == nil {
+		return "", errors.New("unexpected end")
+	}
+	if t.kind == "(" {
+		p.pos++
+		inner, err := p.or()
+		if err != nil {
+			return "", err
+		}
+		if t := p.peek(); t == nil || t.kind != ")" {
+			return "", errors.New("missing )")
+		}
+		p.pos++
+		return "(" + inner + ")", nil
+	}
+	return p.cond()
+}
+
+func (p *filterParser) cond() (string, error) {
+	if p.conds++; p.conds > maxFilterConds {
+		return "", errors.New("too many conditions")
+	}
+	if len(p.toks)-p.pos < 3 {
+		return "", errors.New("expected field op value")
+	}
+	field, op, val := p.toks[p.pos], p.toks[p.pos+1], p.toks[p.pos+2]
+	if field.kind != "word" || op.kind != "op" || (val.kind != "word" && val.kind != "string") {
+		return "", errors.New("expected field op value near " + strconv.Quote(field.text))
+	}
+	p.pos += 3
+	// bare null means no value; a quoted "null" is just text
+	isNull := val.kind == "word" && strings.EqualFold(val.text, "null")
+	var list []string
+	if val.kind == "word" && !isNull {
+		list = strings.Split(val.text, ",")
+	} else {
+		list = []string{val.text}
+	}
+	return p.fieldCond(field.text, op.text, val.text, list, isNull)
+}
+
+// filterKind says which operators a field takes and how values are bound.
+type filterKind int
+
+const (
+	kindText filterKind = iota
+	kindID
+	kindEnum
+	kindDate
+	kindTime
+	kindNumber
+	kindBool
+)
+
+type filterField struct {
+	expr string
+	kind filterKind
+}
+
+var taskFilterFields = map[string]filterField{
+	"title":       {"t.title", kindText},
+	"description": {"t.description", kindText},
+	"list":        {"t.list_id::text", kindID},
+	"category":    {"l.category", kindEnum},
+	"lane":        {"t.lane_id::text", kindID},
+	"parent":      {"t.parent_task_id::text", kindID},
+	"estimate":    {"t.estimate", kindNumber},
+	"due_date":    {"t.due_date", kindDate},
+	"start_date":  {"t.start_date", kindDate},
+	"created":     {"t.created_at", kindTime},
+	"updated":     {"t.updated_at", kindTime},
+	"done":        {"l.category = 'done'", kindBool},
+	"blocked": {`EXISTS(
+		  SELECT 1 FROM task_links k JOIN tasks bt ON bt.id = k.from_task_id JOIN lists bl ON bl.id = bt.list_id
+		  WHERE k.to_task_id = t.id AND k.type = 'blocks' AND bl.category <> 'done' AND bt.deleted_at IS NULL)`, kindBool},
+}
+
+func (p *filterParser) fieldCond(name, op, raw string, list []string, isNull bool) (string, error) {
+	switch name {
+	case "priority":
+		return p.priorityCond(op, list, isNull)
+	case "assignee":
+		return p.assigneeCond(op, list, isNull)
+	}
+	if strings.HasPrefix(name, "cf.") {
+		f, ok := p.fields[name[3:]]
+		if !ok {
+			return "", errors.New("unknown custom field " + strconv.Quote(name[3:]))
+		}
+		return p.customFieldCond(f, op, raw, list, isNull)
+	}
+	f, ok := taskFilterFields[name]
+	if !ok {
+		return "", errors.New("unknown field " + strconv.Quote(name))
+	}
+	return p.compare(name, f.expr, f.kind, op, raw, list, isNull)
+}
+
+// compare builds `expr op value` for one field kind.
+func (p *filterParser) compare(name, expr string, kind filterKind, op, raw string, list []string, isNull bool) (string, error) {
+	if isNull {
+		switch op {
+		case "=":
+			return "(" + expr + ") IS NULL", nil
+		case "!=":
+			return "(" + expr + ") IS NOT NULL", nil
+		}
+		return "", errors.New(name + ": null only goes with = or !=")
+	}
+
+	cast := ""
+	check := func(string) bool { return true }
+	switch kind {
+	case kindText:
+		switch op {
+		case "~":
+			return expr + " ILIKE '%' || " + p.b.ph(likeEscape(raw)) + " || '%'", nil
+		case "!~":
+			return "COALESCE(" + expr + " NOT ILIKE '%' || " + p.b.ph(likeEscape(raw)) + " || '%', true)", nil
+		case "=", "!=":
+			list = []string{raw} // text may contain commas
+		default:
+			return "", errors.New(name + ": use =, !=, ~ or !~")
+		}
+	case kindID, kindEnum:
+		if op != "=" && op != "!=" {
+			return "", errors.New(name + ": use = or !=")
+		}
+		if kind == kindEnum {
+			check = func(v string) bool { return listCategories[v] }
+		}
+	case kindBool:
+		if (op != "=" && op != "!=") || len(list) != 1 || (raw != "true" && raw != "false") {
+			return "", errors.New(name + ": use = or != with true or false")
+		}
+		if op == "!=" {
+			return "NOT (" + expr + ") = " + p.b.ph(raw == "true") + "::boolean", nil
+		}
+		return "(" + expr + ") = " + p.b.ph(raw == "true") + "::boolean", nil
+	case kindDate:
+		cast = "::date"
+		check = func(v string) bool { _, err := time.Parse(dateLayout, v); return err == nil }
+	case kindNumber:
+		cast = "::numeric"
+		check = func(v string) bool { _, err := strconv.ParseFloat(v, 64); return err == nil }
+	case kindTime:
+		// a plain date compares the UTC calendar day
+		if _, err := time.Parse(dateLayout, raw); err == nil && len(list) == 1 {
+			expr, cast = "("+expr+" AT TIME ZONE 'UTC')::date", "::date"
+		} else {
+			cast = "::timestamptz"
+			check = func(v string) bool { _, err := time.Parse(time.RFC3339, v); return err == nil }
+		}
+	}
+	for _, v := range list {
+		if !check(v) {
+			return "", errors.New(name + ": bad value " + strconv.Quote(v))
+		}
+	}
+
+	switch op {
+	case "=", "!=":
+		phs := make([]string, len(list))
+		for i, v := range list {
+			phs[i] = p.b.ph(v) + cast
+		}
+		if op == "=" {
+			return expr + " IN (" + strings.Join(phs, ", ") + ")", nil
+		}
+		return "COALESCE(" + expr + " NOT IN (" + strings.Join(phs, ", ") + "), true)", nil
+	case "<", "<=", ">", ">=":
+		if len(list) != 1 {
+			return "", errors.New(name + ": " + op + " takes one value")
+		}
+		return expr + " " + op + " " + p.b.ph(list[0]) + cast, nil
+	}
+	return "", errors.New(name + ": " + op + " is not supported")
+}
+
+func (p *filterParser) priorityCond(op string, list []string, isNull bool) (string, error) {
+	if isNull {
+		return "", errors.New("priority is never null")
+	}
+	ranks := make([]string, len(list))
+	for i, v := range list {
+		if !taskPriorities[v] {
+			return "", errors.New("priority must be none, low, medium, high or urgent")
+		}
+		ranks[i] = strconv.Itoa(priorityRank(v))
+	}
+	switch op {
+	case "=":
+		return priorityRankSQL + " IN (" + strings.Join(ranks, ", ") + ")", nil
+	case "!=":
+		return priorityRankSQL + " NOT IN (" + strings.Join(ranks, ", ") + ")", nil
+	case "<", "<=", ">", ">=":
+		if len(ranks) != 1 {
+			return "", errors.New("priority: " + op + " takes one value")
+		}
+		return priorityRankSQL + " " + op + " " + ranks[0], nil
+	}
+	return "", errors.New("priority: use =, !=, <, <=, > or >=")
+}
+
+// priorityRank matches priorityRankSQL.
+func priorityRank(p string) int {
+	return map[string]int{"none": 0, "low": 1, "medium": 2, "high": 3, "urgent": 4}[p]
+}
+
+func (p *filterParser) assigneeCond(op string, list []string, isNull bool) (string, error) {
+	if op != "=" && op != "!=" {
+		return "", errors.New("assignee: use = or !=")
+	}
+	exists := "EXISTS (SELECT 1 FROM task_assignees a WHERE a.task_id = t.id"
+	if !isNull {
+		phs := make([]string, len(list))
+		for i, v := range list {
+			if v == "me" {
+				v = p.userID
+			}
+			phs[i] = p.b.ph(v)
+		}
+		exists += " AND a.user_id::text IN (" + strings.Join(phs, ", ") + ")"
+	}
+	exists += ")"
+	// assignee=null is "nobody assigned"
+	if (op == "=") == isNull {
+		return "NOT " + exists, nil
+	}
+	return exists, nil
+}
+
+func (p *filterParser) customFieldCond(f CustomFieldDTO, op, raw string, list []string, isNull bool) (string, error) {
+	value := `(SELECT v.value FROM task_custom_values v WHERE v.task_id = t.id AND v.field_id = ` + p.b.ph(f.ID) + `::uuid)`
+	name := f.Name
+	switch f.Type {
+	case "text":
+		return p.compare(name, value+` #>> '{}'`, kindText, op, raw, list, isNull)
+	case "number":
+		return p.compare(name, `(`+value+` #>> '{}')::numeric`, kindNumber, op, raw, list, isNull)
+	case "date":
+		return p.compare(name, `(`+value+` #>> '{}')::date`, kindDate, op, raw, list, isNull)
+	case "checkbox":
+		// unset counts as false
+		return p.compare(name, `COALESCE((`+value+`)::text::boolean, false)`, kindBool, op, raw, list, isNull)
+	case "multi_select":
+		if isNull {
+			return p.compare(name, value, kindID, op, raw, list, true)
+		}
+		if op != "=" && op != "!=" {
+			return "", errors.New(name + ": use = or !=")
+		}
+		conds := make([]string, len(list))
+		for i, v := range list {
+			conds[i] = `COALESCE(jsonb_exists(` + value + `, ` + p.b.ph(v) + `), false)`
+		}
+		match := "(" + strings.Join(conds, " OR ") + ")"
+		if op == "!=" {
+			return "NOT " + match, nil
+		}
+		return match, nil
+	default: // select, user
+		if f.Type == "user" {
+			for i, v := range list {
+				if v == "me" {
+					list[i] = p.userID
+				}
+			}
+		}
+		return p.compare(name, value+` #>> '{}'`, kindID, op, raw, list, isNull)
+	}
+}
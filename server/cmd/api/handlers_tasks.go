@@ -11,25 +11,44 @@ import (
 )
 
 type createTaskReq struct {
-	ListID      string `json:"list_id"`
-	Title       string `json:"title"`
-	Description string `json:"description,omitempty"`
+	ListID      string   `json:"list_id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Priority    string   `json:"priority,omitempty"`
+	Estimate    *float64 `json:"estimate,omitempty"`
+	DueDate     string   `json:"due_date,omitempty"`
+	StartDate   string   `json:"start_date,omitempty"` // on or before due_date
+	LaneID      string   `json:"lane_id,omitempty"`    // manual swimlane on the list's board
 }
 
 type taskCreatedResp struct {
-	ID          string `json:"id"`
-	ListID      string `json:"list_id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Position    int    `json:"position"`
+	ID          string   `json:"id"`
+	ListID      string   `json:"list_id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Position    int      `json:"position"`
+	Priority    string   `json:"priority"`
+	Estimate    *float64 `json:"estimate"`
+	DueDate     *string  `json:"due_date"`
+	StartDate   *string  `json:"start_date"`
+	OverWIP     bool     `json:"over_wip,omitempty"` // the list is now past its WIP limit
 }
 
+// Priority levels, lowest first. priorityRankSQL orders them in queries.
+var taskPriorities = map[string]bool{"none": true, "low": true, "medium": true, "high": true, "urgent": true}
+
+const priorityRankSQL = `CASE t.priority WHEN 'urgent' THEN 4 WHEN 'high' THEN 3 WHEN 'medium' THEN 2 WHEN 'low' THEN 1 ELSE 0 END`
+
+const maxEstimate = 999999.99 // NUMERIC(8,2)
+
+func validEstimate(v float64) bool { return v >= 0 && v <= maxEstimate }
+
 func createTaskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	sess, ok := requireAuthAndCSRF(w, r) // reuse helper
+	sess, ok := requireAuthAndCSRF(w, r, db) // reuse helper
 	if !ok {
 		return
 	}
@@ -44,50 +63,120 @@ func createTaskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		http.Error(w, "missing fields", http.StatusBadRequest)
 		return
 	}
+	if req.Priority == "" {
+		req.Priority = "none"
+	}
+	if !taskPriorities[req.Priority] {
+		http.Error(w, "priority must be none, low, medium, high or urgent", http.StatusBadRequest)
+		return
+	}
+	if req.Estimate != nil && !validEstimate(*req.Estimate) {
+		http.Error(w, "estimate out of range", http.StatusBadRequest)
+		return
+	}
+	due, okDate := parseDate(req.DueDate)
+	if !okDate {
+		http.Error(w, "due_date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	start, okDate := parseDate(req.StartDate)
+	if !okDate {
+		http.Error(w, "start_date must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	if start != nil && due != nil && req.StartDate > req.DueDate {
+		http.Error(w, "start_date is after due_date", http.StatusBadRequest)
+		return
+	}
 
 	// Ensure the list belongs to a board in a workspace the user is a member of
-	var valid bool
-	if err := db.QueryRow(`
-		SELECT EXISTS(
-		  SELECT 1
-		  FROM lists l
-		  JOIN boards b ON b.id = l.board_id
-		  JOIN workspace_members m ON m.workspace_id = b.workspace_id
-		  WHERE l.id = $1 AND m.user_id = $2
-		)
-	`, req.ListID, sess.UserID).Scan(&valid); err != nil || !valid {
+	if !canAccessList(db, sess, req.ListID) {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
+	if !listIsLive(db, req.ListID) {
+		http.Error(w, "list is archived or in the trash", http.StatusConflict)
+		return
+	}
+	var laneID any
+	if req.LaneID != "" {
+		if !laneOnListBoard(db, req.LaneID, req.ListID) {
+			http.Error(w, "lane is not on this board", http.StatusBadRequest)
+			return
+		}
+		laneID = req.LaneID
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	overWIP, rejectWIP := wipExceeded(tx, req.ListID)
+	if overWIP && rejectWIP {
+		http.Error(w, "list is at its WIP limit", http.StatusConflict)
+		return
+	}
 
 	// Next position in the list
-	var nextPos int
-	_ = db.QueryRow(`SELECT COALESCE(MAX(position)+1, 0) FROM tasks WHERE list_id=$1`, req.ListID).Scan(&nextPos)
+	nextPos := nextTaskPosition(tx, req.ListID)
 
 	// Insert
 	var id string
-	if err := db.QueryRow(`
-   		INSERT INTO tasks (list_id, title, description, position, created_by)
-   		VALUES ($1,$2,$3,$4,$5)
+	if err := tx.QueryRow(`
+   		INSERT INTO tasks (list_id, title, description, position, created_by, priority, estimate, due_date, start_date, lane_id)
+   		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
    		RETURNING id
- 		`, req.ListID, req.Title, req.Description, nextPos, sess.UserID).Scan(&id); err != nil {
+ 		`, req.ListID, req.Title, req.Description, nextPos, sess.UserID, req.Priority, req.Estimate, due, start, laneID).Scan(&id); err != nil {
 		http.Error(w, "insert failed", http.StatusBadRequest)
 		return
 	}
+	if err := recordTransition(tx, id, "", req.ListID, sess.UserID); err != nil {
+		http.Error(w, "history insert failed", http.StatusInternalServerError)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(taskCreatedResp{
-		ID: id, ListID: req.ListID, Title: req.Title, Position: nextPos, Status: status,
-	})
+	out := taskCreatedResp{
+		ID: id, ListID: req.ListID, Title: req.Title, Description: req.Description, Position: nextPos, OverWIP: overWIP,
+		Priority: req.Priority, Estimate: req.Estimate,
+	}
+	if due != nil {
+		d := req.DueDate
+		out.DueDate = &d
+	}
+	if start != nil {
+		d := req.StartDate
+		out.StartDate = &d
+	}
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// nextTaskPosition is the slot after the last live task in a list; hidden
+// tasks are out of the sequence until they are restored.
+func nextTaskPosition(q queryer, listID string) int {
+	var nextPos int
+	_ = q.QueryRow(`SELECT COUNT(*) FROM tasks WHERE list_id=$1 AND archived_at IS NULL AND deleted_at IS NULL`, listID).Scan(&nextPos)
+	return nextPos
 }
 
 type updateTaskReq struct {
-	Title       *string `json:"title,omitempty"`
-	Description *string `json:"description,omitempty"`
+	Title       *string         `json:"title,omitempty"`
+	Description *string         `json:"description,omitempty"`
+	Priority    *string         `json:"priority,omitempty"`
+	Estimate    json.RawMessage `json:"estimate,omitempty"`   // number, or null to clear
+	DueDate     *string         `json:"due_date,omitempty"`   // "" clears
+	StartDate   *string         `json:"start_date,omitempty"` // "" clears
 }
 
 func updateTaskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	sess, ok := requireAuthAndCSRF(w, r)
+	sess, ok := requireAuthAndCSRF(w, r, db)
 	if !ok {
 		return
 	}
@@ -116,49 +205,92 @@ func updateTaskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		sets = append(sets, "description=$"+strconv.Itoa(len(args)+1))
 		args = append(args, *req.Description)
 	}
+	if req.Priority != nil {
+		if !taskPriorities[*req.Priority] {
+			http.Error(w, "priority must be none, low, medium, high or urgent", http.StatusBadRequest)
+			return
+		}
+		sets = append(sets, "priority=$"+strconv.Itoa(len(args)+1))
+		args = append(args, *req.Priority)
+	}
+	if len(req.Estimate) > 0 {
+		var est *float64
+		if err := json.Unmarshal(req.Estimate, &est); err != nil || (est != nil && !validEstimate(*est)) {
+			http.Error(w, "estimate must be a non-negative number or null", http.StatusBadRequest)
+			return
+		}
+		sets = append(sets, "estimate=$"+strconv.Itoa(len(args)+1))
+		args = append(args, est)
+	}
+	if req.DueDate != nil {
+		due, ok := parseDate(*req.DueDate)
+		if !ok {
+			http.Error(w, "due_date must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		sets = append(sets, "due_date=$"+strconv.Itoa(len(args)+1))
+		args = append(args, due)
+	}
+	if req.StartDate != nil {
+		start, ok := parseDate(*req.StartDate)
+		if !ok {
+			http.Error(w, "start_date must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		sets = append(sets, "start_date=$"+strconv.Itoa(len(args)+1))
+		args = append(args, start)
+	}
 	if len(sets) == 0 {
 		http.Error(w, "nothing to update", http.StatusBadRequest)
 		return
 	}
 
-	// WHERE placeholders come after SET args
-	//  ... id is next
+	if !canAccessTask(db, sess, id) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	// WHERE placeholder comes after SET args
 	args = append(args, id)
 	idPos := len(args) // position of id we just appended
 
-	//  ... user id is after that
-	args = append(args, sess.UserID)
-	userPos := len(args)
-
 	query := `
 		UPDATE tasks t
 		SET ` + strings.Join(sets, ", ") + `, updated_at=NOW()
 		WHERE t.id=$` + strconv.Itoa(idPos) + `
-		AND EXISTS (
-			SELECT 1
-			FROM lists l
-			JOIN boards b ON b.id = l.board_id
-			JOIN workspace_members m ON m.workspace_id = b.workspace_id
-			WHERE l.id = t.list_id AND m.user_id = $` + strconv.Itoa(userPos) + `
-		)
-		RETURNING t.id, t.title, t.description, t.position
+		RETURNING t.id, t.list_id, t.title, t.description, t.position, t.priority, t.estimate, t.due_date, t.start_date
 	`
 
-	log.Printf("[updateTaskHandler] query OK:\n%s\nargs: %#v", query, args)
-
 	var out taskCreatedResp
+	var est sql.NullFloat64
+	var due, start sql.NullTime
 	// taskCreatedResp now includes Description (you already added it)
-	if err := db.QueryRow(query, args...).Scan(&out.ID, &out.Title, &out.Description, &out.Position); err != nil {
+	if err := db.QueryRow(query, args...).Scan(&out.ID, &out.ListID, &out.Title, &out.Description, &out.Position, &out.Priority, &est, &due, &start); err != nil {
+		if isCheckViolation(err) {
+			http.Error(w, "start_date is after due_date", http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "update failed", http.StatusBadRequest)
 		return
 	}
+	if est.Valid {
+		out.Estimate = &est.Float64
+	}
+	if due.Valid {
+		d := due.Time.Format(dateLayout)
+		out.DueDate = &d
+	}
+	if start.Valid {
+		d := start.Time.Format(dateLayout)
+		out.StartDate = &d
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(out)
 }
 
 func deleteTaskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	sess, ok := requireAuthAndCSRF(w, r)
+	sess, ok := requireAuthAndCSRF(w, r, db)
 	if !ok {
 		return
 	}
@@ -169,42 +301,30 @@ func deleteTaskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 		return
 	}
 
-	res, err := db.Exec(`
-        DELETE FROM tasks t
-        WHERE t.id=$1
-        AND EXISTS (
-            SELECT 1
-            FROM lists l
-            JOIN boards b ON b.id=l.board_id
-            JOIN workspace_members m ON m.workspace_id=b.workspace_id
-            WHERE l.id=t.list_id AND m.user_id=$2
-        )
-    `, id, sess.UserID)
-	if err != nil {
-		http.Error(w, "delete failed", http.StatusBadRequest)
-		return
-	}
-	n, _ := res.RowsAffected()
-	if n == 0 {
+	if !canAccessTask(db, sess, id) {
 		http.Error(w, "not found or forbidden", http.StatusNotFound)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	// Deleting moves the task to the trash; DELETE /api/trash purges it.
+	changeVisibility(w, db, sess, hiddenItemReq{Type: "task", ID: id}, true, false)
 }
 
 // POST /api/tasks/reorder
 // Body: { "task_id": "...", "to_list_id": "...", "to_index": 0 }
 type reorderOrMoveReq struct {
-	TaskID   string `json:"task_id"`
-	ToListID string `json:"to_list_id"`
-	ToIndex  int    `json:"to_index"`
+	TaskID   string  `json:"task_id"`
+	ToListID string  `json:"to_list_id"`
+	ToIndex  int     `json:"to_index"`
+	ToLaneID *string `json:"to_lane_id,omitempty"` // lane key on the destination board (see moveToLane); "" = no lane, absent = keep
 }
 
 type reorderOrMoveResp struct {
-	ID       string `json:"id"`
-	ListID   string `json:"list_id"`
-	Position int    `json:"position"`
+	ID       string      `json:"id"`
+	ListID   string      `json:"list_id"`
+	Position int         `json:"position"`
+	Dropped  *DroppedDTO `json:"dropped,omitempty"` // cross-board moves only
+	OverWIP  bool        `json:"over_wip,omitempty"`
 }
 
 func reorderOrMoveTaskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
@@ -212,7 +332,7 @@ func reorderOrMoveTaskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	sess, ok := requireAuthAndCSRF(w, r)
+	sess, ok := requireAuthAndCSRF(w, r, db)
 	if !ok {
 		return
 	}
@@ -233,7 +353,10 @@ func reorderOrMoveTaskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB
 	// Current location
 	var srcListID string
 	var oldPos int
-	if err := tx.QueryRow(`SELECT list_id, position FROM tasks WHERE id=$1`, req.TaskID).Scan(&srcListID, &oldPos); err == sql.ErrNoRows {
+	var live bool
+	if err := tx.QueryRow(`
+		SELECT list_id, position, archived_at IS NULL AND deleted_at IS NULL FROM tasks WHERE id=$1
+	`, req.TaskID).Scan(&srcListID, &oldPos, &live); err == sql.ErrNoRows {
 		http.Error(w, "task not found", http.StatusNotFound)
 		return
 	} else if err != nil {
@@ -242,31 +365,44 @@ func reorderOrMoveTaskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB
 	}
 
 	// ACL: user must belong to src & dest workspaces
-	var okSrc, okDst bool
-	if err := tx.QueryRow(`
-		SELECT EXISTS(
-		  SELECT 1 FROM lists l
-		  JOIN boards b ON b.id = l.board_id
-		  JOIN workspace_members m ON m.workspace_id = b.workspace_id
-		  WHERE l.id=$1 AND m.user_id=$2
-		)`, srcListID, sess.UserID).Scan(&okSrc); err != nil || !okSrc {
+	if !canAccessList(tx, sess, srcListID) || !canAccessList(tx, sess, req.ToListID) {
 		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
-	if err := tx.QueryRow(`
-		SELECT EXISTS(
-		  SELECT 1 FROM lists l
-		  JOIN boards b ON b.id = l.board_id
-		  JOIN workspace_members m ON m.workspace_id = b.workspace_id
-		  WHERE l.id=$1 AND m.user_id=$2
-		)`, req.ToListID, sess.UserID).Scan(&okDst); err != nil || !okDst {
-		http.Error(w, "forbidden", http.StatusForbidden)
+	if !live || !listIsLive(tx, req.ToListID) {
+		http.Error(w, "task or list is archived or in the trash", http.StatusConflict)
 		return
 	}
 
+	// Boards can opt in to keeping blocked work out of their done lists.
+	var toDone, enforceBlockers bool
+	var srcBoardID, dstBoardID string
+	if err := tx.QueryRow(`
+		SELECT l.category = 'done', b.enforce_blockers, b.id, (SELECT board_id FROM lists WHERE id = $2)
+		FROM lists l JOIN boards b ON b.id = l.board_id
+		WHERE l.id = $1
+	`, req.ToListID, srcListID).Scan(&toDone, &enforceBlockers, &dstBoardID, &srcBoardID); err != nil {
+		http.Error(w, "lookup failed", http.StatusInternalServerError)
+		return
+	}
+	completing := toDone && srcListID != req.ToListID
+	if completing && enforceBlockers && taskBlocked(tx, req.TaskID) {
+		http.Error(w, "task has open blockers", http.StatusConflict)
+		return
+	}
+	// WIP limits only count arrivals; reordering within a list is always fine.
+	var overWIP bool
+	if srcListID != req.ToListID {
+		var rejectWIP bool
+		overWIP, rejectWIP = wipExceeded(tx, req.ToListID)
+		if overWIP && rejectWIP {
+			http.Error(w, "list is at its WIP limit", http.StatusConflict)
+			return
+		}
+	}
 	// Clamp index to valid bounds in destination
 	var destCount int
-	if err := tx.QueryRow(`SELECT COUNT(*) FROM tasks WHERE list_id=$1`, req.ToListID).Scan(&destCount); err != nil {
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM tasks WHERE list_id=$1 AND archived_at IS NULL AND deleted_at IS NULL`, req.ToListID).Scan(&destCount); err != nil {
 		http.Error(w, "count dest failed", http.StatusInternalServerError)
 		return
 	}
@@ -292,7 +428,7 @@ func reorderOrMoveTaskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB
 				// task moves up → push down the block [toIndex..oldPos-1]
 				if _, err := tx.Exec(`
 					UPDATE tasks SET position = position + 1
-					WHERE list_id = $1 AND position >= $2 AND position < $3
+					WHERE list_id = $1 AND position >= $2 AND position < $3 AND archived_at IS NULL AND deleted_at IS NULL
 				`, srcListID, toIndex, oldPos); err != nil {
 					http.Error(w, "shift up block failed", http.StatusBadRequest)
 					return
@@ -301,7 +437,7 @@ func reorderOrMoveTaskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB
 				// task moves down → pull up the block [oldPos+1..toIndex]
 				if _, err := tx.Exec(`
 					UPDATE tasks SET position = position - 1
-					WHERE list_id = $1 AND position > $2 AND position <= $3
+					WHERE list_id = $1 AND position > $2 AND position <= $3 AND archived_at IS NULL AND deleted_at IS NULL
 				`, srcListID, oldPos, toIndex); err != nil {
 					http.Error(w, "shift down block failed", http.StatusBadRequest)
 					return
@@ -316,14 +452,14 @@ func reorderOrMoveTaskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB
 		// Cross-list: compact source, make room in dest, then move
 		if _, err := tx.Exec(`
 			UPDATE tasks SET position = position - 1
-			WHERE list_id = $1 AND position > $2
+			WHERE list_id = $1 AND position > $2 AND archived_at IS NULL AND deleted_at IS NULL
 		`, srcListID, oldPos); err != nil {
 			http.Error(w, "compact source failed", http.StatusBadRequest)
 			return
 		}
 		if _, err := tx.Exec(`
 			UPDATE tasks SET position = position + 1
-			WHERE list_id = $1 AND position >= $2
+			WHERE list_id = $1 AND position >= $2 AND archived_at IS NULL AND deleted_at IS NULL
 		`, req.ToListID, toIndex); err != nil {
 			http.Error(w, "make room dest failed", http.StatusBadRequest)
 			return
@@ -334,6 +470,34 @@ func reorderOrMoveTaskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB
 			http.Error(w, "move failed", http.StatusBadRequest)
 			return
 		}
+		if err := recordTransition(tx, req.TaskID, srcListID, req.ToListID, sess.UserID); err != nil {
+			http.Error(w, "move failed", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Board-scoped data doesn't follow the task to another board by id.
+	var dropped *DroppedDTO
+	if srcBoardID != dstBoardID {
+		if dropped, err = rehomeTask(tx, req.TaskID); err != nil {
+			http.Error(w, "move failed", http.StatusBadRequest)
+			return
+		}
+		if dropped.empty() {
+			dropped = nil
+		}
+	}
+
+	if req.ToLaneID != nil {
+		problem, err := moveToLane(tx, req.TaskID, req.ToListID, *req.ToLaneID)
+		if err != nil {
+			http.Error(w, "lane update failed", http.StatusBadRequest)
+			return
+		}
+		if problem != "" {
+			http.Error(w, problem, http.StatusBadRequest)
+			return
+		}
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -341,9 +505,17 @@ func reorderOrMoveTaskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB
 		return
 	}
 
+	// Completing a recurring task spawns its next instance right away
+	// rather than on the scheduler's next tick.
+	if completing {
+		if _, err := advanceRecurrence(db, req.TaskID); err != nil {
+			log.Println("recurrence:", err)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(reorderOrMoveResp{
-		ID: req.TaskID, ListID: req.ToListID, Position: toIndex,
+		ID: req.TaskID, ListID: req.ToListID, Position: toIndex, Dropped: dropped, OverWIP: overWIP,
 	})
 }
 
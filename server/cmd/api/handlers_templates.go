@@ -0,0 +1,692 @@
+// handlers_templates.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ---- board & task templates ----
+// A template is a JSON snapshot: a board (custom fields, lists, optionally
+// sample tasks with checklists) or a single task. Built-in templates are
+// defined below; saved ones live in the templates table per workspace.
+
+type boardTemplate struct {
+	EstimateUnit string                `json:"estimate_unit,omitempty"`
+	CustomFields []customFieldTemplate `json:"custom_fields"`
+	Lists        []listTemplate        `json:"lists"`
+}
+
+type customFieldTemplate struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Options []string `json:"options,omitempty"`
+}
+
+type listTemplate struct {
+	Name     string         `json:"name"`
+	Category string         `json:"category"`
+	Tasks    []taskTemplate `json:"tasks,omitempty"`
+}
+
+type taskTemplate struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	Priority    string              `json:"priority,omitempty"`
+	Estimate    *float64            `json:"estimate,omitempty"`
+	Checklists  []checklistTemplate `json:"checklists,omitempty"`
+	// custom field name → value; applied where the target board has a field
+	// with the same name that accepts the value
+	CustomFields map[string]json.RawMessage `json:"custom_fields,omitempty"`
+}
+
+type checklistTemplate struct {
+	Title string   `json:"title"`
+	Items []string `json:"items"`
+}
+
+const maxTemplateTasks = 500
+
+type builtinTemplate struct {
+	ID          string
+	Name        string
+	Description string
+	Board       boardTemplate
+}
+
+// builtinTemplates are available in every workspace. "kanban" is what new
+// users get as their first board.
+var builtinTemplates = []builtinTemplate{
+	{
+		ID:          "kanban",
+		Name:        "Kanban",
+		Description: "A simple To Do / In Progress / Done board.",
+		Board: boardTemplate{
+			Lists: []listTemplate{
+				{Name: "To Do", Category: "backlog", Tasks: []taskTemplate{
+					{Title: "Welcome to your board", Description: "Drag cards between lists as work progresses."},
+					{Title: "Create your first task", Description: "Click + to add tasks. Assign teammates later."},
+					{Title: "Invite a teammate", Description: "Collaborate by inviting others to your workspace."},
+				}},
+				{Name: "In Progress", Category: "active"},
+				{Name: "Done", Category: "done"},
+			},
+		},
+	},
+	{
+		ID:          "scrum-sprint",
+		Name:        "Scrum sprint",
+		Description: "Backlog, sprint columns and story points.",
+		Board: boardTemplate{
+			EstimateUnit: "points",
+			CustomFields: []customFieldTemplate{
+				{Name: "Sprint", Type: "text"},
+				{Name: "Type", Type: "select", Options: []string{"Story", "Task", "Bug", "Spike"}},
+			},
+			Lists: []listTemplate{
+				{Name: "Product Backlog", Category: "backlog"},
+				{Name: "Sprint Backlog", Category: "backlog", Tasks: []taskTemplate{
+					{
+						Title:       "Sprint planning",
+						Description: "Agree on the sprint goal and pull stories from the product backlog.",
+						Checklists: []checklistTemplate{{Title: "Planning", Items: []string{
+							"Review sprint goal", "Estimate top stories", "Commit to sprint scope",
+						}}},
+					},
+				}},
+				{Name: "In Progress", Category: "active"},
+				{Name: "In Review", Category: "active"},
+				{Name: "Done", Category: "done"},
+			},
+		},
+	},
+	{
+		ID:          "bug-triage",
+		Name:        "Bug triage",
+		Description: "Intake, triage and verification of bug reports.",
+		Board: boardTemplate{
+			CustomFields: []customFieldTemplate{
+				{Name: "Severity", Type: "select", Options: []string{"Critical", "Major", "Minor", "Trivial"}},
+				{Name: "Component", Type: "text"},
+				{Name: "Reproducible", Type: "checkbox"},
+				{Name: "Reported by", Type: "user"},
+			},
+			Lists: []listTemplate{
+				{Name: "New", Category: "backlog", Tasks: []taskTemplate{
+					{
+						Title:       "Example: app crashes on login",
+						Description: "Steps to reproduce, expected vs. actual behaviour, environment.",
+						Priority:    "high",
+						Checklists: []checklistTemplate{{Title: "Triage", Items: []string{
+							"Reproduce", "Set severity", "Assign an owner",
+						}}},
+						CustomFields: map[string]json.RawMessage{
+							"Severity":     json.RawMessage(`"Major"`),
+							"Reproducible": json.RawMessage(`true`),
+						},
+					},
+				}},
+				{Name: "Triaged", Category: "backlog"},
+				{Name: "In Progress", Category: "active"},
+				{Name: "Ready to verify", Category: "active"},
+				{Name: "Closed", Category: "done"},
+			},
+		},
+	},
+}
+
+func findBuiltinTemplate(id string) (builtinTemplate, bool) {
+	for _, t := range builtinTemplates {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return builtinTemplate{}, false
+}
+
+// ---- instantiate ----
+
+// instantiateBoardTemplate creates a board from t inside tx and returns its id.
+func instantiateBoardTemplate(tx *sql.Tx, t boardTemplate, workspaceID, userID, name string) (string, error) {
+	unit := t.EstimateUnit
+	if unit != "hours" {
+		unit = "points"
+	}
+	var boardID string
+	if err := tx.QueryRow(
+		`INSERT INTO boards (name, owner_id, workspace_id, estimate_unit) VALUES ($1,$2,$3,$4) RETURNING id`,
+		name, userID, workspaceID, unit,
+	).Scan(&boardID); err != nil {
+		return "", err
+	}
+
+	for i, f := range t.CustomFields {
+		if !customFieldTypes[f.Type] {
+			return "", errors.New("template field " + f.Name + ": unknown type")
+		}
+		opts, err := normalizeOptions(f.Options)
+		if err != nil {
+			return "", err
+		}
+		optsJSON, _ := json.Marshal(opts)
+		if _, err := tx.Exec(`
+			INSERT INTO board_custom_fields (board_id, name, type, options, position)
+			VALUES ($1, $2, $3, $4::jsonb, $5)
+		`, boardID, f.Name, f.Type, string(optsJSON), i); err != nil {
+			return "", err
+		}
+	}
+
+	for i, l := range t.Lists {
+		if !listCategories[l.Category] {
+			l.Category = "active"
+		}
+		var listID string
+		if err := tx.QueryRow(
+			`INSERT INTO lists (board_id, name, position, category) VALUES ($1,$2,$3,$4) RETURNING id`,
+			boardID, l.Name, i, l.Category,
+		).Scan(&listID); err != nil {
+			return "", err
+		}
+		for _, task := range l.Tasks {
+			if _, err := instantiateTaskTemplate(tx, task, listID, userID); err != nil {
+				return "", err
+			}
+		}
+	}
+	return boardID, nil
+}
+
+// instantiateTaskTemplate adds a task from t at the end of listID.
+func instantiateTaskTemplate(tx *sql.Tx, t taskTemplate, listID, userID string) (string, error) {
+	priority := t.Priority
+	if !taskPriorities[priority] {
+		priority = "none"
+	}
+	est := t.Estimate
+	if est != nil && !validEstimate(*est) {
+		est = nil
+	}
+	var taskID string
+	if err := tx.QueryRow(`
+		INSERT INTO tasks (list_id, title, description, position, created_by, priority, estimate)
+		VALUES ($1,$2,$3,$4,$5,$6,$7)
+		RETURNING id
+	`, listID, t.Title, t.Description, nextTaskPosition(tx, listID), userID, priority, est).Scan(&taskID); err != nil {
+		return "", err
+	}
+	if err := recordTransition(tx, taskID, "", listID, userID); err != nil {
+		return "", err
+	}
+
+	for ci, c := range t.Checklists {
+		var checklistID string
+		if err := tx.QueryRow(
+			`INSERT INTO checklists (task_id, title, position) VALUES ($1,$2,$3) RETURNING id`,
+			taskID, c.Title, ci,
+		).Scan(&checklistID); err != nil {
+			return "", err
+		}
+		for ii, body := range c.Items {
+			if _, err := tx.Exec(
+				`INSERT INTO checklist_items (checklist_id, body, position) VALUES ($1,$2,$3)`,
+				checklistID, body, ii,
+			); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	for name, raw := range t.CustomFields {
+		f, err := scanCustomField(tx.QueryRow(`
+			SELECT f.id, f.board_id, f.name, f.type, f.options, f.position
+			FROM board_custom_fields f JOIN lists l ON l.board_id = f.board_id
+			WHERE l.id = $1 AND f.name = $2
+		`, listID, name))
+		if err != nil {
+			continue // target board has no such field
+		}
+		v, err := validateCustomValue(tx, f, taskID, raw)
+		if err != nil || v == nil {
+			continue
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO task_custom_values (task_id, field_id, value) VALUES ($1,$2,$3::jsonb)`,
+			taskID, f.ID, string(v),
+		); err != nil {
+			return "", err
+		}
+	}
+	return taskID, nil
+}
+
+// ---- snapshot ----
+
+func snapshotTask(db *sql.DB, taskID string) (taskTemplate, error) {
+	var t taskTemplate
+	var est sql.NullFloat64
+	if err := db.QueryRow(
+		`SELECT title, description, priority, estimate FROM tasks WHERE id=$1`, taskID,
+	).Scan(&t.Title, &t.Description, &t.Priority, &est); err != nil {
+		return t, err
+	}
+	if est.Valid {
+		t.Estimate = &est.Float64
+	}
+
+	rows, err := db.Query(`
+		SELECT c.id, c.title, i.body
+		FROM checklists c LEFT JOIN checklist_items i ON i.checklist_id = c.id
+		WHERE c.task_id = $1
+		ORDER BY c.position, i.position
+	`, taskID)
+	if err != nil {
+		return t, err
+	}
+	lastID := ""
+	for rows.Next() {
+		var id, title string
+		var body sql.NullString
+		if err := rows.Scan(&id, &title, &body); err != nil {
+			continue
+		}
+		if id != lastID {
+			t.Checklists = append(t.Checklists, checklistTemplate{Title: title, Items: []string{}})
+			lastID = id
+		}
+		if body.Valid {
+			c := &t.Checklists[len(t.Checklists)-1]
+			c.Items = append(c.Items, body.String)
+		}
+	}
+	rows.Close()
+
+	// user values point at people in this workspace, so they aren't carried over
+	vrows, err := db.Query(`
+		SELECT f.name, v.value
+		FROM task_custom_values v JOIN board_custom_fields f ON f.id = v.field_id
+		WHERE v.task_id = $1 AND f.type <> 'user'
+	`, taskID)
+	if err != nil {
+		return t, err
+	}
+	defer vrows.Close()
+	for vrows.Next() {
+		var name string
+		var v []byte
+		if err := vrows.Scan(&name, &v); err == nil {
+			if t.CustomFields == nil {
+				t.CustomFields = make(map[string]json.RawMessage)
+			}
+			t.CustomFields[name] = json.RawMessage(v)
+		}
+	}
+	return t, nil
+}
+
+func snapshotBoard(db *sql.DB, boardID string, withTasks bool) (boardTemplate, error) {
+	var t boardTemplate
+	if err := db.QueryRow(`SELECT estimate_unit FROM boards WHERE id=$1`, boardID).Scan(&t.EstimateUnit); err != nil {
+		return t, err
+	}
+
+	fields, err := loadBoardCustomFields(db, boardID)
+	if err != nil {
+		return t, err
+	}
+	t.CustomFields = make([]customFieldTemplate, 0, len(fields))
+	for _, f := range fields {
+		t.CustomFields = append(t.CustomFields, customFieldTemplate{Name: f.Name, Type: f.Type, Options: f.Options})
+	}
+
+	rows, err := db.Query(`SELECT id, name, category FROM lists WHERE board_id=$1 AND archived_at IS NULL AND deleted_at IS NULL ORDER BY position ASC`, boardID)
+	if err != nil {
+		return t, err
+	}
+	listIDs := []string{}
+	for rows.Next() {
+		var id string
+		var l listTemplate
+		if err := rows.Scan(&id, &l.Name, &l.Category); err == nil {
+			listIDs = append(listIDs, id)
+			t.Lists = append(t.Lists, l)
+		}
+	}
+	rows.Close()
+	if !withTasks {
+		return t, nil
+	}
+
+	total := 0
+	for i, listID := range listIDs {
+		trows, err := db.Query(`SELECT id FROM tasks WHERE list_id=$1 AND archived_at IS NULL AND deleted_at IS NULL ORDER BY position ASC`, listID)
+		if err != nil {
+			return t, err
+		}
+		taskIDs := []string{}
+		for trows.Next() {
+			var id string
+			if err := trows.Scan(&id); err == nil {
+				taskIDs = append(taskIDs, id)
+			}
+		}
+		trows.Close()
+		total += len(taskIDs)
+		if total > maxTemplateTasks {
+			return t, errors.New("board has too many tasks for a template")
+		}
+		for _, id := range taskIDs {
+			task, err := snapshotTask(db, id)
+			if err != nil {
+				return t, err
+			}
+			t.Lists[i].Tasks = append(t.Lists[i].Tasks, task)
+		}
+	}
+	return t, nil
+}
+
+// ---- /api/templates ----
+// GET                                                        → built-ins + saved templates of the caller's workspaces
+// POST { kind:"board", board_id, name, description?, include_tasks? } → save a board
+// POST { kind:"task", task_id, name, description? }          → save a task
+// DELETE ?id=...                                             → delete a saved template
+
+type TemplateDTO struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	BuiltIn     bool            `json:"built_in"`
+	WorkspaceID *string         `json:"workspace_id"`
+	CreatedAt   *time.Time      `json:"created_at,omitempty"`
+	Body        json.RawMessage `json:"body"`
+}
+
+func templatesHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	switch r.Method {
+	case http.MethodGet:
+		listTemplatesHandler(w, r, db)
+	case http.MethodPost:
+		saveTemplateHandler(w, r, db)
+	case http.MethodDelete:
+		deleteTemplateHandler(w, r, db)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listTemplatesHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := getSessionFromRequest(r, db)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	kind := r.URL.Query().Get("kind")
+
+	out := make([]TemplateDTO, 0)
+	if kind == "" || kind == "board" {
+		for _, b := range builtinTemplates {
+			body, _ := json.Marshal(b.Board)
+			out = append(out, TemplateDTO{ID: b.ID, Kind: "board", Name: b.Name, Description: b.Description, BuiltIn: true, Body: body})
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT t.id, t.kind, t.name, t.description, t.workspace_id, t.created_at, t.body
+		FROM templates t
+		JOIN workspace_members m ON m.workspace_id = t.workspace_id
+		WHERE m.user_id = $1
+		  AND m.workspace_id = COALESCE($2::uuid, m.workspace_id)
+		  AND t.kind = COALESCE(NULLIF($3, ''), t.kind)
+		ORDER BY t.kind, t.name
+	`, sess.UserID, sess.workspaceScope(), kind)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t TemplateDTO
+		var ws string
+		var created time.Time
+		var body []byte
+		if err := rows.Scan(&t.ID, &t.Kind, &t.Name, &t.Description, &ws, &created, &body); err != nil {
+			continue
+		}
+		t.WorkspaceID, t.CreatedAt, t.Body = &ws, &created, body
+		out = append(out, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+type saveTemplateReq struct {
+	Kind         string `json:"kind"`
+	BoardID      string `json:"board_id,omitempty"`
+	TaskID       string `json:"task_id,omitempty"`
+	Name         string `json:"name"`
+	Description  string `json:"description,omitempty"`
+	IncludeTasks bool   `json:"include_tasks,omitempty"`
+}
+
+func saveTemplateHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	var req saveTemplateReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "missing name", http.StatusBadRequest)
+		return
+	}
+
+	var body any
+	var wsID string
+	switch req.Kind {
+	case "board":
+		if req.BoardID == "" || !canAccessBoard(db, sess, req.BoardID) {
+			http.Error(w, "board not found or forbidden", http.StatusNotFound)
+			return
+		}
+		if err := db.QueryRow(`SELECT workspace_id FROM boards WHERE id=$1`, req.BoardID).Scan(&wsID); err != nil {
+			http.Error(w, "lookup failed", http.StatusInternalServerError)
+			return
+		}
+		t, err := snapshotBoard(db, req.BoardID, req.IncludeTasks)
+		if err != nil {
+			http.Error(w, "snapshot failed: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = t
+	case "task":
+		if req.TaskID == "" || !canAccessTask(db, sess, req.TaskID) {
+			http.Error(w, "task not found or forbidden", http.StatusNotFound)
+			return
+		}
+		var err error
+		if wsID, err = taskWorkspaceID(db, req.TaskID); err != nil {
+			http.Error(w, "lookup failed", http.StatusInternalServerError)
+			return
+		}
+		t, err := snapshotTask(db, req.TaskID)
+		if err != nil {
+			http.Error(w, "snapshot failed", http.StatusInternalServerError)
+			return
+		}
+		body = t
+	default:
+		http.Error(w, "kind must be board or task", http.StatusBadRequest)
+		return
+	}
+
+	raw, _ := json.Marshal(body)
+	out := TemplateDTO{Kind: req.Kind, Name: req.Name, Description: req.Description, WorkspaceID: &wsID, Body: raw}
+	var created time.Time
+	if err := db.QueryRow(`
+		INSERT INTO templates (workspace_id, kind, name, description, body, created_by)
+		VALUES ($1, $2, $3, $4, $5::jsonb, $6)
+		RETURNING id, created_at
+	`, wsID, req.Kind, req.Name, req.Description, string(raw), sess.UserID).Scan(&out.ID, &created); err != nil {
+		http.Error(w, "insert failed", http.StatusBadRequest)
+		return
+	}
+	out.CreatedAt = &created
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func deleteTemplateHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if _, builtin := findBuiltinTemplate(id); builtin {
+		http.Error(w, "built-in templates can't be deleted", http.StatusBadRequest)
+		return
+	}
+	var wsID string
+	if err := db.QueryRow(`SELECT workspace_id FROM templates WHERE id=$1`, id).Scan(&wsID); err != nil || !canAccessWorkspace(db, sess, wsID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+	if _, err := db.Exec(`DELETE FROM templates WHERE id=$1`, id); err != nil {
+		http.Error(w, "delete failed", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ---- POST /api/templates/instantiate ----
+// board templates: { template_id, name?, workspace_id? } → new board (default: the caller's own workspace)
+// task templates:  { template_id, list_id }            → new task at the end of the list
+
+type instantiateTemplateReq struct {
+	TemplateID  string `json:"template_id"`
+	Name        string `json:"name,omitempty"`
+	WorkspaceID string `json:"workspace_id,omitempty"`
+	ListID      string `json:"list_id,omitempty"`
+}
+
+func instantiateTemplateHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	var req instantiateTemplateReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TemplateID == "" {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+
+	// resolve the template
+	var kind, name string
+	var body []byte
+	if b, ok := findBuiltinTemplate(req.TemplateID); ok {
+		kind, name = "board", b.Name
+		body, _ = json.Marshal(b.Board)
+	} else {
+		var wsID string
+		if err := db.QueryRow(
+			`SELECT kind, name, body, workspace_id FROM templates WHERE id=$1`, req.TemplateID,
+		).Scan(&kind, &name, &body, &wsID); err != nil || !canAccessWorkspace(db, sess, wsID) {
+			http.Error(w, "template not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch kind {
+	case "board":
+		var t boardTemplate
+		if err := json.Unmarshal(body, &t); err != nil {
+			http.Error(w, "template is corrupt", http.StatusInternalServerError)
+			return
+		}
+		wsID := req.WorkspaceID
+		if wsID == "" {
+			// the caller's own workspace first, else any they belong to
+			if err := tx.QueryRow(`
+				SELECT workspace_id FROM workspace_members
+				WHERE user_id=$1 AND workspace_id = COALESCE($2::uuid, workspace_id)
+				ORDER BY role='owner' DESC
+				LIMIT 1
+			`, sess.UserID, sess.workspaceScope()).Scan(&wsID); err != nil {
+				http.Error(w, "no workspace", http.StatusBadRequest)
+				return
+			}
+		}
+		if !canAccessWorkspace(tx, sess, wsID) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		boardName := strings.TrimSpace(req.Name)
+		if boardName == "" {
+			boardName = name
+		}
+		boardID, err := instantiateBoardTemplate(tx, t, wsID, sess.UserID, boardName)
+		if err != nil {
+			http.Error(w, "could not create board", http.StatusBadRequest)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "commit failed", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"board_id": boardID, "workspace_id": wsID, "name": boardName})
+	case "task":
+		var t taskTemplate
+		if err := json.Unmarshal(body, &t); err != nil {
+			http.Error(w, "template is corrupt", http.StatusInternalServerError)
+			return
+		}
+		if req.ListID == "" || !canAccessList(tx, sess, req.ListID) {
+			http.Error(w, "list not found or forbidden", http.StatusNotFound)
+			return
+		}
+		if !listIsLive(tx, req.ListID) {
+			http.Error(w, "list is archived or in the trash", http.StatusConflict)
+			return
+		}
+		if over, reject := wipExceeded(tx, req.ListID); over && reject {
+			http.Error(w, "list is at its WIP limit", http.StatusConflict)
+			return
+		}
+		taskID, err := instantiateTaskTemplate(tx, t, req.ListID, sess.UserID)
+		if err != nil {
+			http.Error(w, "could not create task", http.StatusBadRequest)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "commit failed", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"task_id": taskID, "list_id": req.ListID})
+	}
+}
@@ -0,0 +1,628 @@
+// handlers_timeline.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ---- /api/timeline ----
+// GET ?board_id=...  → the board's tasks with their dates, the 'blocks' edges
+//                      touching them, and the board's working-day calendar
+//
+// ---- /api/timeline/calendar ----
+// GET ?board_id=...                                          → calendar
+// PUT ?board_id=... { weekend_days: [0,6], holidays: [{date, name}] } → replace
+//
+// ---- POST /api/timeline/schedule ----
+// { task_id, start_date?, due_date?, dry_run? }
+// Sets the task's dates, then pushes every task it (transitively) blocks so
+// that each one starts on the first working day after all of its blockers
+// end. Moved tasks keep their length in working days, counted on their own
+// board's calendar. Tasks are only pushed later, never pulled earlier; done
+// tasks and tasks without dates stay where they are. The response lists what
+// moved; with dry_run nothing is saved.
+
+const maxScheduleCascade = 2000
+
+type HolidayDTO struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+type WorkCalendarDTO struct {
+	WeekendDays []int        `json:"weekend_days"` // 0 = Sunday
+	Holidays    []HolidayDTO `json:"holidays"`
+}
+
+// workCalendar answers working-day questions for one board.
+type workCalendar struct {
+	weekend  [7]bool
+	holidays map[string]bool
+}
+
+func (c workCalendar) workday(d time.Time) bool {
+	return !c.weekend[d.Weekday()] && !c.holidays[d.Format(dateLayout)]
+}
+
+// nextWorkday is the first working day strictly after d.
+func (c workCalendar) nextWorkday(d time.Time) time.Time {
+	d = d.AddDate(0, 0, 1)
+	for !c.workday(d) {
+		d = d.AddDate(0, 0, 1)
+	}
+	return d
+}
+
+// span counts working days in [start, end], at least 1.
+func (c workCalendar) span(start, end time.Time) int {
+	n := 0
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		if c.workday(d) {
+			n++
+		}
+	}
+	return max(n, 1)
+}
+
+// addWorkdays moves n working days forward from d.
+func (c workCalendar) addWorkdays(d time.Time, n int) time.Time {
+	for ; n > 0; n-- {
+		d = c.nextWorkday(d)
+	}
+	return d
+}
+
+func loadWorkCalendar(q queryer, boardID string) (workCalendar, WorkCalendarDTO, error) {
+	var weekend, days, names string
+	err := q.QueryRow(`
+		SELECT array_to_string(b.weekend_days, ','),
+		       COALESCE((SELECT string_agg(h.day::text, ',' ORDER BY h.day) FROM board_holidays h WHERE h.board_id = b.id), ''),
+		       COALESCE((SELECT json_agg(h.name ORDER BY h.day)::text FROM board_holidays h WHERE h.board_id = b.id), '[]')
+		FROM boards b WHERE b.id = $1
+	`, boardID).Scan(&weekend, &days, &names)
+	cal := workCalendar{holidays: make(map[string]bool)}
+	dto := WorkCalendarDTO{WeekendDays: make([]int, 0), Holidays: make([]HolidayDTO, 0)}
+	if err != nil {
+		return cal, dto, err
+	}
+	for _, s := range strings.Split(weekend, ",") {
+		if n, err := strconv.Atoi(s); err == nil && n >= 0 && n < 7 {
+			cal.weekend[n] = true
+			dto.WeekendDays = append(dto.WeekendDays, n)
+		}
+	}
+	var holidayNames []string
+	_ = json.Unmarshal([]byte(names), &holidayNames)
+	if days != "" {
+		for i, d := range strings.Split(days, ",") {
+			cal.holidays[d] = true
+			h := HolidayDTO{Date: d}
+			if i < len(holidayNames) {
+				h.Name = holidayNames[i]
+			}
+			dto.Holidays = append(dto.Holidays, h)
+		}
+	}
+	return cal, dto, nil
+}
+
+// ---- timeline payload ----
+
+type TimelineTaskDTO struct {
+	ID        string   `json:"id"`
+	Title     string   `json:"title"`
+	ListID    string   `json:"list_id"`
+	LaneID    *string  `json:"lane_id"`
+	ParentID  *string  `json:"parent_id"`
+	Priority  string   `json:"priority"`
+	StartDate *string  `json:"start_date"`
+	DueDate   *string  `json:"due_date"`
+	Done      bool     `json:"done"`
+	Assignees []string `json:"assignees"`
+}
+
+type DependencyDTO struct {
+	ID         string `json:"id"`
+	FromTaskID string `json:"from_task_id"`
+	ToTaskID   string `json:"to_task_id"`
+	// One end is on another board; that task isn't in tasks.
+	External bool `json:"external"`
+}
+
+type timelineResp struct {
+	BoardID      string            `json:"board_id"`
+	Calendar     WorkCalendarDTO   `json:"calendar"`
+	Tasks        []TimelineTaskDTO `json:"tasks"`
+	Dependencies []DependencyDTO   `json:"dependencies"`
+}
+
+func timelineHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := getSessionFromRequest(r, db)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	boardID := r.URL.Query().Get("board_id")
+	if boardID == "" || !canAccessBoard(db, sess, boardID) {
+		http.Error(w, "board not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	out := timelineResp{BoardID: boardID, Tasks: make([]TimelineTaskDTO, 0), Dependencies: make([]DependencyDTO, 0)}
+	var err error
+	if _, out.Calendar, err = loadWorkCalendar(db, boardID); err != nil {
+		http.Error(w, "calendar lookup failed", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT t.id, t.title, t.list_id, t.lane_id, t.parent_task_id, t.priority, t.start_date, t.due_date, l.category = 'done',
+		       COALESCE((SELECT array_to_string(array_agg(a.user_id::text ORDER BY a.assigned_at), ',')
+		                 FROM task_assignees a WHERE a.task_id = t.id), '')
+		FROM tasks t JOIN lists l ON l.id = t.list_id
+		WHERE l.board_id = $1
+		  AND t.archived_at IS NULL AND t.deleted_at IS NULL
+		  AND l.archived_at IS NULL AND l.deleted_at IS NULL
+		ORDER BY COALESCE(t.start_date, t.due_date) NULLS LAST, l.position, t.position
+	`, boardID)
+	if err != nil {
+		http.Error(w, "tasks query failed", http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var t TimelineTaskDTO
+		var laneID, parentID sql.NullString
+		var start, due sql.NullTime
+		var assignees string
+		if err := rows.Scan(&t.ID, &t.Title, &t.ListID, &laneID, &parentID, &t.Priority, &start, &due, &t.Done, &assignees); err != nil {
+			continue
+		}
+		if laneID.Valid {
+			t.LaneID = &laneID.String
+		}
+		if parentID.Valid {
+			t.ParentID = &parentID.String
+		}
+		if start.Valid {
+			d := start.Time.Format(dateLayout)
+			t.StartDate = &d
+		}
+		if due.Valid {
+			d := due.Time.Format(dateLayout)
+			t.DueDate = &d
+		}
+		t.Assignees = make([]string, 0)
+		if assignees != "" {
+			t.Assignees = strings.Split(assignees, ",")
+		}
+		out.Tasks = append(out.Tasks, t)
+	}
+	rows.Close()
+
+	// 'blocks' edges with at least one live end on this board
+	drows, err := db.Query(`
+		SELECT k.id, k.from_task_id, k.to_task_id, lf.board_id <> lt.board_id
+		FROM task_links k
+		JOIN tasks f ON f.id = k.from_task_id JOIN lists lf ON lf.id = f.list_id
+		JOIN tasks t ON t.id = k.to_task_id JOIN lists lt ON lt.id = t.list_id
+		WHERE k.type = 'blocks' AND (lf.board_id = $1 OR lt.board_id = $1)
+		  AND f.archived_at IS NULL AND f.deleted_at IS NULL AND lf.archived_at IS NULL AND lf.deleted_at IS NULL
+		  AND t.archived_at IS NULL AND t.deleted_at IS NULL AND lt.archived_at IS NULL AND lt.deleted_at IS NULL
+		ORDER BY k.created_at
+	`, boardID)
+	if err != nil {
+		http.Error(w, "dependencies query failed", http.StatusInternalServerError)
+		return
+	}
+	defer drows.Close()
+	for drows.Next() {
+		var d DependencyDTO
+		if err := drows.Scan(&d.ID, &d.FromTaskID, &d.ToTaskID, &d.External); err == nil {
+			out.Dependencies = append(out.Dependencies, d)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// ---- calendar config ----
+
+func timelineCalendarHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	var sess Session
+	var ok bool
+	switch r.Method {
+	case http.MethodGet:
+		sess, ok = getSessionFromRequest(r, db)
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	case http.MethodPut:
+		if sess, ok = requireAuthAndCSRF(w, r, db); !ok {
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	boardID := r.URL.Query().Get("board_id")
+	if boardID == "" || !canAccessBoard(db, sess, boardID) {
+		http.Error(w, "board not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		var req WorkCalendarDTO
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad json", http.StatusBadRequest)
+			return
+		}
+		weekend := make([]string, 0, len(req.WeekendDays))
+		seen := make(map[int]bool)
+		for _, d := range req.WeekendDays {
+			if d < 0 || d > 6 {
+				http.Error(w, "weekend_days are 0 (Sunday) to 6 (Saturday)", http.StatusBadRequest)
+				return
+			}
+			if !seen[d] {
+				seen[d] = true
+				weekend = append(weekend, strconv.Itoa(d))
+			}
+		}
+		if len(weekend) == 7 {
+			http.Error(w, "at least one day of the week must be a working day", http.StatusBadRequest)
+			return
+		}
+		for _, h := range req.Holidays {
+			if _, err := time.Parse(dateLayout, h.Date); err != nil {
+				http.Error(w, "holiday dates must be YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "tx begin failed", http.StatusInternalServerError)
+			return
+		}
+		defer func() { _ = tx.Rollback() }()
+		if _, err := tx.Exec(`
+			UPDATE boards SET weekend_days = COALESCE(string_to_array(NULLIF($2, ''), ',')::smallint[], '{}') WHERE id=$1
+		`, boardID, strings.Join(weekend, ",")); err != nil {
+			http.Error(w, "update failed", http.StatusBadRequest)
+			return
+		}
+		if _, err := tx.Exec(`DELETE FROM board_holidays WHERE board_id=$1`, boardID); err != nil {
+			http.Error(w, "update failed", http.StatusBadRequest)
+			return
+		}
+		for _, h := range req.Holidays {
+			if _, err := tx.Exec(`
+				INSERT INTO board_holidays (board_id, day, name) VALUES ($1,$2,$3)
+				ON CONFLICT (board_id, day) DO UPDATE SET name = EXCLUDED.name
+			`, boardID, h.Date, strings.TrimSpace(h.Name)); err != nil {
+				http.Error(w, "update failed", http.StatusBadRequest)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "commit failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	_, out, err := loadWorkCalendar(db, boardID)
+	if err != nil {
+		http.Error(w, "calendar lookup failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// ---- scheduling ----
+
+type scheduleReq struct {
+	TaskID    string  `json:"task_id"`
+	StartDate *string `json:"start_date,omitempty"`
+	DueDate   *string `json:"due_date,omitempty"`
+	DryRun    bool    `json:"dry_run,omitempty"`
+}
+
+type ScheduledTaskDTO struct {
+	ID           string  `json:"id"`
+	Title        string  `json:"title"`
+	BoardID      string  `json:"board_id"`
+	OldStartDate *string `json:"old_start_date"`
+	OldDueDate   *string `json:"old_due_date"`
+	StartDate    *string `json:"start_date"`
+	DueDate      *string `json:"due_date"`
+}
+
+type scheduleResp struct {
+	DryRun bool               `json:"dry_run"`
+	Task   ScheduledTaskDTO   `json:"task"`
+	Moved  []ScheduledTaskDTO `json:"moved"` // in the order they were shifted
+}
+
+// schedNode is one task in the cascade with its dates as they are being moved.
+type schedNode struct {
+	id, title, boardID string
+	done               bool
+	start, due         *time.Time
+	oldStart, oldDue   *time.Time
+}
+
+// end is the last day the task occupies, or nil when it has no dates.
+func (n *schedNode) end() *time.Time {
+	if n.due != nil {
+		return n.due
+	}
+	return n.start
+}
+
+func (n *schedNode) dto() ScheduledTaskDTO {
+	f := func(t *time.Time) *string {
+		if t == nil {
+			return nil
+		}
+		s := t.Format(dateLayout)
+		return &s
+	}
+	return ScheduledTaskDTO{
+		ID: n.id, Title: n.title, BoardID: n.boardID,
+		OldStartDate: f(n.oldStart), OldDueDate: f(n.oldDue), StartDate: f(n.start), DueDate: f(n.due),
+	}
+}
+
+func scheduleTaskHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	var req scheduleReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.TaskID == "" {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	if req.StartDate == nil && req.DueDate == nil {
+		http.Error(w, "start_date or due_date is required", http.StatusBadRequest)
+		return
+	}
+	parse := func(s *string) (*time.Time, bool) {
+		if s == nil {
+			return nil, true
+		}
+		t, err := time.Parse(dateLayout, *s)
+		return &t, err == nil
+	}
+	newStart, ok1 := parse(req.StartDate)
+	newDue, ok2 := parse(req.DueDate)
+	if !ok1 || !ok2 {
+		http.Error(w, "dates must be YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	if !canAccessTask(db, sess, req.TaskID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// the task and everything it transitively blocks, locked for the update
+	rows, err := tx.Query(`
+		WITH RECURSIVE down(id) AS (
+		  SELECT $1::uuid
+		  UNION
+		  SELECT k.to_task_id FROM task_links k
+		  JOIN down ON k.from_task_id = down.id
+		  JOIN tasks t ON t.id = k.to_task_id
+		  WHERE k.type = 'blocks' AND t.archived_at IS NULL AND t.deleted_at IS NULL
+		)
+		SELECT t.id, t.title, l.board_id, l.category = 'done', t.start_date, t.due_date
+		FROM tasks t JOIN lists l ON l.id = t.list_id
+		WHERE t.id IN (SELECT id FROM down)
+		  AND t.archived_at IS NULL AND t.deleted_at IS NULL
+		LIMIT `+strconv.Itoa(maxScheduleCascade+1)+`
+		FOR UPDATE OF t
+	`, req.TaskID)
+	if err != nil {
+		log.Println("schedule:", err)
+		http.Error(w, "lookup failed", http.StatusInternalServerError)
+		return
+	}
+	nodes := make(map[string]*schedNode)
+	for rows.Next() {
+		n := &schedNode{}
+		var start, due sql.NullTime
+		if err := rows.Scan(&n.id, &n.title, &n.boardID, &n.done, &start, &due); err != nil {
+			rows.Close()
+			http.Error(w, "lookup failed", http.StatusInternalServerError)
+			return
+		}
+		if start.Valid {
+			n.start = &start.Time
+		}
+		if due.Valid {
+			n.due = &due.Time
+		}
+		n.oldStart, n.oldDue = n.start, n.due
+		nodes[n.id] = n
+	}
+	rows.Close()
+	root := nodes[req.TaskID]
+	if root == nil {
+		http.Error(w, "task is archived or in the trash", http.StatusConflict)
+		return
+	}
+	if len(nodes) > maxScheduleCascade {
+		http.Error(w, "too many dependent tasks to reschedule at once", http.StatusUnprocessableEntity)
+		return
+	}
+
+	if newStart != nil {
+		root.start = newStart
+	}
+	if newDue != nil {
+		root.due = newDue
+	}
+	if root.start != nil && root.due != nil && root.start.After(*root.due) {
+		http.Error(w, "start_date is after due_date", http.StatusBadRequest)
+		return
+	}
+
+	// every live 'blocks' edge into the cascade; blockers outside it count
+	// with the dates they have now
+	type edge struct {
+		from, to string
+		fromEnd  *time.Time
+	}
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	erows, err := tx.Query(`
+		SELECT k.from_task_id, k.to_task_id, COALESCE(f.due_date, f.start_date)
+		FROM task_links k JOIN tasks f ON f.id = k.from_task_id
+		WHERE k.type = 'blocks' AND k.to_task_id = ANY(string_to_array($1, ',')::uuid[])
+		  AND f.archived_at IS NULL AND f.deleted_at IS NULL
+	`, strings.Join(ids, ","))
+	if err != nil {
+		log.Println("schedule:", err)
+		http.Error(w, "lookup failed", http.StatusInternalServerError)
+		return
+	}
+	in := make(map[string][]edge)
+	out := make(map[string][]string)
+	indeg := make(map[string]int)
+	for erows.Next() {
+		var e edge
+		var end sql.NullTime
+		if err := erows.Scan(&e.from, &e.to, &end); err != nil {
+			erows.Close()
+			http.Error(w, "lookup failed", http.StatusInternalServerError)
+			return
+		}
+		if end.Valid {
+			e.fromEnd = &end.Time
+		}
+		in[e.to] = append(in[e.to], e)
+		if _, inCascade := nodes[e.from]; inCascade && e.to != req.TaskID {
+			out[e.from] = append(out[e.from], e.to)
+			indeg[e.to]++
+		}
+	}
+	erows.Close()
+
+	// topological walk from the root; 'blocks' is kept acyclic, but a
+	// leftover cycle must not loop forever
+	calendars := make(map[string]workCalendar)
+	resp := scheduleResp{DryRun: req.DryRun, Moved: make([]ScheduledTaskDTO, 0)}
+	queue := []string{req.TaskID}
+	visited := 0
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		visited++
+		n := nodes[id]
+		if id != req.TaskID && !n.done && n.end() != nil {
+			// earliest start: the working day after the latest blocker ends
+			var latest *time.Time
+			for _, e := range in[id] {
+				end := e.fromEnd
+				if b, inCascade := nodes[e.from]; inCascade {
+					end = b.end()
+				}
+				if end != nil && (latest == nil || end.After(*latest)) {
+					latest = end
+				}
+			}
+			cal, ok := calendars[n.boardID]
+			if !ok {
+				if cal, _, err = loadWorkCalendar(tx, n.boardID); err != nil {
+					http.Error(w, "calendar lookup failed", http.StatusInternalServerError)
+					return
+				}
+				calendars[n.boardID] = cal
+			}
+			if latest != nil {
+				earliest := cal.nextWorkday(*latest)
+				first := n.start
+				if first == nil {
+					first = n.due
+				}
+				if first.Before(earliest) {
+					switch {
+					case n.start != nil && n.due != nil:
+						length := cal.span(*n.start, *n.due)
+						due := cal.addWorkdays(earliest, length-1)
+						n.start, n.due = &earliest, &due
+					case n.start != nil:
+						n.start = &earliest
+					default:
+						n.due = &earliest
+					}
+					resp.Moved = append(resp.Moved, n.dto())
+				}
+			}
+		}
+		next := out[id]
+		sort.Strings(next)
+		for _, to := range next {
+			indeg[to]--
+			if indeg[to] == 0 {
+				queue = append(queue, to)
+			}
+		}
+	}
+	if visited < len(nodes) {
+		http.Error(w, "blocking links form a cycle", http.StatusConflict)
+		return
+	}
+	resp.Task = root.dto()
+
+	if !req.DryRun {
+		save := func(n *schedNode) error {
+			_, err := tx.Exec(`UPDATE tasks SET start_date=$2, due_date=$3, updated_at=NOW() WHERE id=$1`, n.id, n.start, n.due)
+			return err
+		}
+		if err := save(root); err != nil {
+			http.Error(w, "update failed", http.StatusBadRequest)
+			return
+		}
+		for _, m := range resp.Moved {
+			if err := save(nodes[m.ID]); err != nil {
+				http.Error(w, "update failed", http.StatusBadRequest)
+				return
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "commit failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,86 @@
+// handlers_timeline_test.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkCalendarSevenDayWeek(t *testing.T) {
+	cal := workCalendar{holidays: map[string]bool{"2026-06-02": true}}
+	sat := time.Date(2026, 5, 30, 0, 0, 0, 0, time.UTC)
+	if !cal.workday(sat) || !cal.workday(sat.AddDate(0, 0, 1)) {
+		t.Error("weekend counted as non-working with no weekend_days")
+	}
+	if got := cal.span(sat, sat.AddDate(0, 0, 6)); got != 6 {
+		t.Errorf("span over a week with one holiday = %d, want 6", got)
+	}
+}
+
+// putCalendar PUTs body to /api/timeline/calendar as a fresh browser session.
+func putCalendar(db *sql.DB, userID, boardID, body string) *httptest.ResponseRecorder {
+	login := httptest.NewRecorder()
+	startSession(login, httptest.NewRequest(http.MethodGet, "/", nil), userID)
+	req := httptest.NewRequest(http.MethodPut, "/api/timeline/calendar?board_id="+boardID, strings.NewReader(body))
+	for _, c := range login.Result().Cookies() {
+		req.AddCookie(c)
+		if c.Name == "csrf" {
+			req.Header.Set("X-CSRF-Token", c.Value)
+		}
+	}
+	rec := httptest.NewRecorder()
+	timelineCalendarHandler(rec, req, db)
+	return rec
+}
+
+func TestTimelineCalendarEmptyWeekend(t *testing.T) {
+	db := testDB(t)
+	email := "timeline-" + strings.ToLower(randToken(6)) + "@example.test"
+	dropUser(t, db, email)
+	var userID, boardID string
+	if err := db.QueryRow(
+		`INSERT INTO users (email, password_hash, name) VALUES ($1,'x','Timeline') RETURNING id`, email,
+	).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := provisionPersonalWorkspace(db, userID, "Timeline"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`
+		SELECT b.id FROM boards b JOIN workspace_members m ON m.workspace_id = b.workspace_id
+		WHERE m.user_id = $1 LIMIT 1
+	`, userID).Scan(&boardID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		body string
+		want []int
+	}{
+		{`{"weekend_days":[5,6],"holidays":[]}`, []int{5, 6}},
+		{`{"weekend_days":[],"holidays":[]}`, []int{}}, // seven-day work week
+		{`{"holidays":[]}`, []int{}},
+	} {
+		rec := putCalendar(db, userID, boardID, tc.body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", tc.body, rec.Code, rec.Body.String())
+		}
+		var out WorkCalendarDTO
+		if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		if len(out.WeekendDays) != len(tc.want) {
+			t.Fatalf("%s: weekend_days %v, want %v", tc.body, out.WeekendDays, tc.want)
+		}
+		for i := range tc.want {
+			if out.WeekendDays[i] != tc.want[i] {
+				t.Fatalf("%s: weekend_days %v, want %v", tc.body, out.WeekendDays, tc.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// handlers_tokens.go
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ---- personal access tokens ----
+
+const (
+	tokenScopeRead  = "read"
+	tokenScopeWrite = "write"
+
+	apiTokenPrefix        = "tmpat_"
+	apiTokenDefaultTTL    = 30 * 24 * time.Hour
+	apiTokenMaxTTL        = 365 * 24 * time.Hour
+	apiTokenDisplayPrefix = 12
+)
+
+func hashAPIToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// bearerToken extracts the token from "Authorization: Bearer <token>".
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return "", false
+	}
+	t := strings.TrimSpace(h[7:])
+	return t, t != ""
+}
+
+// sessionFromAPIToken resolves a bearer token to a Session carrying the token's scopes.
+func sessionFromAPIToken(db *sql.DB, raw string) (Session, bool) {
+	if !strings.HasPrefix(raw, apiTokenPrefix) {
+		return Session{}, false
+	}
+	var s Session
+	var scopes string
+	var wsID sql.NullString
+	err := db.QueryRow(`
+		SELECT id, user_id, array_to_string(scopes, ','), workspace_id, expires_at
+		FROM api_tokens
+		WHERE token_hash=$1 AND revoked_at IS NULL AND expires_at > NOW()
+	`, hashAPIToken(raw)).Scan(&s.TokenID, &s.UserID, &scopes, &wsID, &s.Expires)
+	if err != nil {
+		return Session{}, false
+	}
+	s.Scopes = strings.Split(scopes, ",")
+	s.WorkspaceID = wsID.String
+
+	// Throttled so busy scripts don't write on every request
+	_, _ = db.Exec(`
+		UPDATE api_tokens SET last_used_at=NOW()
+		WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`, s.TokenID)
+	return s, true
+}
+
+// ---- DTOs ----
+
+type apiTokenItem struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Scopes      []string   `json:"scopes"`
+	WorkspaceID *string    `json:"workspace_id"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type createAPITokenReq struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	WorkspaceID   string   `json:"workspace_id,omitempty"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"`
+}
+
+type createAPITokenResp struct {
+	apiTokenItem
+	Token string `json:"token"` // shown once
+}
+
+// /api/tokens (GET list, POST create, DELETE ?id= revoke)
+// Managing tokens requires a cookie session: a token can't mint or revoke tokens.
+func apiTokensHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	switch r.Method {
+	case http.MethodGet:
+		listAPITokensHandler(w, r, db)
+	case http.MethodPost:
+		createAPITokenHandler(w, r, db)
+	case http.MethodDelete:
+		revokeAPITokenHandler(w, r, db)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listAPITokensHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := getSessionFromRequest(r, db)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if sess.TokenID != "" {
+		http.Error(w, "not allowed with an API token", http.StatusForbidden)
+		return
+	}
+	rows, err := db.Query(`
+		SELECT id, name, token_prefix, array_to_string(scopes, ','), workspace_id, expires_at, last_used_at, created_at
+		FROM api_tokens
+		WHERE user_id=$1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`, sess.UserID)
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	items := make([]apiTokenItem, 0)
+	for rows.Next() {
+		var t apiTokenItem
+		var scopes string
+		var wsID sql.NullString
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &t.Prefix, &scopes, &wsID, &t.ExpiresAt, &lastUsed, &t.CreatedAt); err == nil {
+			t.Scopes = strings.Split(scopes, ",")
+			if wsID.Valid {
+				t.WorkspaceID = &wsID.String
+			}
+			if lastUsed.Valid {
+				t.LastUsedAt = &lastUsed.Time
+			}
+			items = append(items, t)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+func createAPITokenHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireBrowserSession(w, r, db)
+	if !ok {
+		return
+	}
+	var req createAPITokenReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "missing fields", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = []string{tokenScopeRead}
+	}
+	for _, sc := range req.Scopes {
+		if sc != tokenScopeRead && sc != tokenScopeWrite {
+			http.Error(w, "unknown scope: "+sc, http.StatusBadRequest)
+			return
+		}
+	}
+	ttl := apiTokenDefaultTTL
+	if req.ExpiresInDays > 0 {
+		ttl = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+	if ttl > apiTokenMaxTTL {
+		http.Error(w, "expiry too far in the future", http.StatusBadRequest)
+		return
+	}
+
+	var wsID any
+	if req.WorkspaceID != "" {
+		if !canAccessWorkspace(db, sess, req.WorkspaceID) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		wsID = req.WorkspaceID
+	}
+
+	raw := apiTokenPrefix + randToken(32)
+	out := createAPITokenResp{Token: raw}
+	out.Name = req.Name
+	out.Prefix = raw[:apiTokenDisplayPrefix]
+	out.Scopes = req.Scopes
+	if req.WorkspaceID != "" {
+		out.WorkspaceID = &req.WorkspaceID
+	}
+	if err := db.QueryRow(`
+		INSERT INTO api_tokens (user_id, name, token_hash, token_prefix, scopes, workspace_id, expires_at)
+		VALUES ($1,$2,$3,$4,string_to_array($5, ','),$6,$7)
+		RETURNING id, expires_at, created_at
+	`, sess.UserID, req.Name, hashAPIToken(raw), out.Prefix, strings.Join(req.Scopes, ","), wsID, time.Now().Add(ttl),
+	).Scan(&out.ID, &out.ExpiresAt, &out.CreatedAt); err != nil {
+		http.Error(w, "insert failed", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+func revokeAPITokenHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireBrowserSession(w, r, db)
+	if !ok {
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	res, err := db.Exec(
+		`UPDATE api_tokens SET revoked_at=NOW() WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL`,
+		id, sess.UserID,
+	)
+	if err != nil {
+		http.Error(w, "revoke failed", http.StatusBadRequest)
+		return
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,495 @@
+// handlers_trash.go
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ---- archive & trash ----
+// Tasks, lists and boards can be archived (hidden, searchable, restorable at
+// any time) or trashed (restorable until purged after trashRetention).
+// A hidden task or list leaves its siblings' position sequence; restoring
+// slots it back in at its old position, clamped to the live range.
+// Trashing something archived keeps both marks, so restoring it from the
+// trash puts it back in the archive.
+
+var trashRetention = time.Duration(envInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour
+
+func envInt(key string, def int) int {
+	if n, err := strconv.Atoi(envOr(key, "")); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+var errNotHidden = errors.New("not archived or in the trash")
+var errParentHidden = errors.New("restore the containing list or board first")
+var errAtWIPLimit = errors.New("list is at its WIP limit")
+
+// hiddenCol maps the API's "archive"/"trash" to the column that marks it.
+// Only these two literals ever reach the SQL below.
+func hiddenCol(trash bool) string {
+	if trash {
+		return "deleted_at"
+	}
+	return "archived_at"
+}
+
+// listIsLive reports whether tasks can be added to or moved into the list.
+func listIsLive(q queryer, listID string) bool {
+	var ok bool
+	err := q.QueryRow(`
+		SELECT l.archived_at IS NULL AND l.deleted_at IS NULL AND b.archived_at IS NULL AND b.deleted_at IS NULL
+		FROM lists l JOIN boards b ON b.id = l.board_id
+		WHERE l.id = $1
+	`, listID).Scan(&ok)
+	return err == nil && ok
+}
+
+func hideTask(tx *sql.Tx, taskID string, trash bool, userID string) error {
+	var listID string
+	var pos int
+	var hidden bool
+	if err := tx.QueryRow(`
+		SELECT list_id, position, archived_at IS NOT NULL OR deleted_at IS NOT NULL
+		FROM tasks WHERE id=$1 FOR UPDATE
+	`, taskID).Scan(&listID, &pos, &hidden); err != nil {
+		return err
+	}
+	col := hiddenCol(trash)
+	if _, err := tx.Exec(`
+		UPDATE tasks SET `+col+`=COALESCE(`+col+`, NOW()),
+		       deleted_by=CASE WHEN $2 THEN $3::uuid ELSE deleted_by END
+		WHERE id=$1
+	`, taskID, trash, userID); err != nil {
+		return err
+	}
+	if hidden {
+		return nil // already out of the sequence
+	}
+	_, err := tx.Exec(`
+		UPDATE tasks SET position = position - 1
+		WHERE list_id=$1 AND position > $2 AND archived_at IS NULL AND deleted_at IS NULL
+	`, listID, pos)
+	return err
+}
+
+func restoreTask(tx *sql.Tx, taskID string, trash bool) error {
+	col := hiddenCol(trash)
+	var listID string
+	var pos int
+	var marked, stillHidden bool
+	if err := tx.QueryRow(`
+		SELECT list_id, position, `+col+` IS NOT NULL,
+		       (CASE WHEN $2 THEN archived_at ELSE deleted_at END) IS NOT NULL
+		FROM tasks WHERE id=$1 FOR UPDATE
+	`, taskID, trash).Scan(&listID, &pos, &marked, &stillHidden); err != nil {
+		return err
+	}
+	if !marked {
+		return errNotHidden
+	}
+	if !stillHidden {
+		if !listIsLive(tx, listID) {
+			return errParentHidden
+		}
+		if over, reject := wipExceeded(tx, listID); over && reject {
+			return errAtWIPLimit
+		}
+		var live int
+		if err := tx.QueryRow(`
+			SELECT COUNT(*) FROM tasks WHERE list_id=$1 AND archived_at IS NULL AND deleted_at IS NULL
+		`, listID).Scan(&live); err != nil {
+			return err
+		}
+		pos = min(max(pos, 0), live)
+		if _, err := tx.Exec(`
+			UPDATE tasks SET position = position + 1
+			WHERE list_id=$1 AND position >= $2 AND archived_at IS NULL AND deleted_at IS NULL
+		`, listID, pos); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`
+		UPDATE tasks SET `+col+`=NULL, position=$2, updated_at=NOW(),
+		       deleted_by=CASE WHEN $3 THEN NULL ELSE deleted_by END
+		WHERE id=$1
+	`, taskID, pos, trash)
+	return err
+}
+
+func hideList(tx *sql.Tx, listID string, trash bool, userID string) error {
+	var boardID string
+	var pos int
+	var hidden bool
+	if err := tx.QueryRow(`
+		SELECT board_id, position, archived_at IS NOT NULL OR deleted_at IS NOT NULL
+		FROM lists WHERE id=$1 FOR UPDATE
+	`, listID).Scan(&boardID, &pos, &hidden); err != nil {
+		return err
+	}
+	col := hiddenCol(trash)
+	if _, err := tx.Exec(`
+		UPDATE lists SET `+col+`=COALESCE(`+col+`, NOW()),
+		       deleted_by=CASE WHEN $2 THEN $3::uuid ELSE deleted_by END
+		WHERE id=$1
+	`, listID, trash, userID); err != nil {
+		return err
+	}
+	if hidden {
+		return nil
+	}
+	_, err := tx.Exec(`
+		UPDATE lists SET position = position - 1
+		WHERE board_id=$1 AND position > $2 AND archived_at IS NULL AND deleted_at IS NULL
+	`, boardID, pos)
+	return err
+}
+
+func restoreList(tx *sql.Tx, listID string, trash bool) error {
+	col := hiddenCol(trash)
+	var boardID string
+	var pos int
+	var marked, stillHidden, boardLive bool
+	if err := tx.QueryRow(`
+		SELECT l.board_id, l.position, l.`+col+` IS NOT NULL,
+		       (CASE WHEN $2 THEN l.archived_at ELSE l.deleted_at END) IS NOT NULL,
+		       b.archived_at IS NULL AND b.deleted_at IS NULL
+		FROM lists l JOIN boards b ON b.id = l.board_id
+		WHERE l.id=$1 FOR UPDATE OF l
+	`, listID, trash).Scan(&boardID, &pos, &marked, &stillHidden, &boardLive); err != nil {
+		return err
+	}
+	if !marked {
+		return errNotHidden
+	}
+	if !stillHidden {
+		if !boardLive {
+			return errParentHidden
+		}
+		var live int
+		if err := tx.QueryRow(`
+			SELECT COUNT(*) FROM lists WHERE board_id=$1 AND archived_at IS NULL AND deleted_at IS NULL
+		`, boardID).Scan(&live); err != nil {
+			return err
+		}
+		pos = min(max(pos, 0), live)
+		if _, err := tx.Exec(`
+			UPDATE lists SET position = position + 1
+			WHERE board_id=$1 AND position >= $2 AND archived_at IS NULL AND deleted_at IS NULL
+		`, boardID, pos); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`
+		UPDATE lists SET `+col+`=NULL, position=$2,
+		       deleted_by=CASE WHEN $3 THEN NULL ELSE deleted_by END
+		WHERE id=$1
+	`, listID, pos, trash)
+	return err
+}
+
+func hideBoard(tx *sql.Tx, boardID string, trash bool, userID string) error {
+	col := hiddenCol(trash)
+	_, err := tx.Exec(`
+		UPDATE boards SET `+col+`=COALESCE(`+col+`, NOW()),
+		       deleted_by=CASE WHEN $2 THEN $3::uuid ELSE deleted_by END
+		WHERE id=$1
+	`, boardID, trash, userID)
+	return err
+}
+
+func restoreBoard(tx *sql.Tx, boardID string, trash bool) error {
+	col := hiddenCol(trash)
+	res, err := tx.Exec(`
+		UPDATE boards SET `+col+`=NULL,
+		       deleted_by=CASE WHEN $2 THEN NULL ELSE deleted_by END
+		WHERE id=$1 AND `+col+` IS NOT NULL
+	`, boardID, trash)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errNotHidden
+	}
+	return nil
+}
+
+// ---- shared request plumbing ----
+
+type hiddenItemReq struct {
+	Type string `json:"type"` // task | list | board
+	ID   string `json:"id"`
+}
+
+func canAccessItem(q queryer, sess Session, typ, id string) bool {
+	switch typ {
+	case "task":
+		return canAccessTask(q, sess, id)
+	case "list":
+		return canAccessList(q, sess, id)
+	case "board":
+		return canAccessBoard(q, sess, id)
+	}
+	return false
+}
+
+// changeVisibility hides or restores one item in its own transaction.
+func changeVisibility(w http.ResponseWriter, db *sql.DB, sess Session, req hiddenItemReq, trash, restore bool) {
+	if req.ID == "" || !canAccessItem(db, sess, req.Type, req.ID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "tx begin failed", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	switch {
+	case req.Type == "task" && restore:
+		err = restoreTask(tx, req.ID, trash)
+	case req.Type == "task":
+		err = hideTask(tx, req.ID, trash, sess.UserID)
+	case req.Type == "list" && restore:
+		err = restoreList(tx, req.ID, trash)
+	case req.Type == "list":
+		err = hideList(tx, req.ID, trash, sess.UserID)
+	case req.Type == "board" && restore:
+		err = restoreBoard(tx, req.ID, trash)
+	default:
+		err = hideBoard(tx, req.ID, trash, sess.UserID)
+	}
+	switch {
+	case errors.Is(err, errNotHidden):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, errParentHidden), errors.Is(err, errAtWIPLimit):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "update failed", http.StatusBadRequest)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "commit failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decodeHiddenItem(w http.ResponseWriter, r *http.Request) (hiddenItemReq, bool) {
+	var req hiddenItemReq
+	if r.Method == http.MethodDelete {
+		req.Type, req.ID = r.URL.Query().Get("type"), r.URL.Query().Get("id")
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad json", http.StatusBadRequest)
+		return req, false
+	}
+	if req.Type != "task" && req.Type != "list" && req.Type != "board" {
+		http.Error(w, "type must be task, list or board", http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// ---- /api/archive ----
+// GET ?board_id=...&q=...       → archived tasks and lists (title/name search)
+// POST { type, id }             → archive
+// DELETE ?type=...&id=...       → unarchive
+
+type HiddenItemDTO struct {
+	Type      string     `json:"type"`
+	ID        string     `json:"id"`
+	Title     string     `json:"title"`
+	BoardID   string     `json:"board_id"`
+	BoardName string     `json:"board_name"`
+	ListID    *string    `json:"list_id,omitempty"`
+	ListName  *string    `json:"list_name,omitempty"`
+	At        time.Time  `json:"at"` // archived_at or deleted_at
+	PurgeAt   *time.Time `json:"purge_at,omitempty"`
+}
+
+func archiveHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	switch r.Method {
+	case http.MethodGet:
+		listHiddenHandler(w, r, db, false)
+	case http.MethodPost, http.MethodDelete:
+		sess, ok := requireAuthAndCSRF(w, r, db)
+		if !ok {
+			return
+		}
+		req, ok := decodeHiddenItem(w, r)
+		if !ok {
+			return
+		}
+		changeVisibility(w, db, sess, req, false, r.Method == http.MethodDelete)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ---- /api/trash ----
+// GET ?board_id=...&q=...       → trashed items with their purge date
+// POST { type, id }             → move to trash
+// DELETE ?type=...&id=...       → delete permanently (only from the trash)
+// POST /api/trash/restore { type, id }
+
+func trashHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	switch r.Method {
+	case http.MethodGet:
+		listHiddenHandler(w, r, db, true)
+	case http.MethodPost:
+		sess, ok := requireAuthAndCSRF(w, r, db)
+		if !ok {
+			return
+		}
+		req, ok := decodeHiddenItem(w, r)
+		if !ok {
+			return
+		}
+		changeVisibility(w, db, sess, req, true, false)
+	case http.MethodDelete:
+		purgeItemHandler(w, r, db)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func restoreFromTrashHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	req, ok := decodeHiddenItem(w, r)
+	if !ok {
+		return
+	}
+	changeVisibility(w, db, sess, req, true, true)
+}
+
+func purgeItemHandler(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	sess, ok := requireAuthAndCSRF(w, r, db)
+	if !ok {
+		return
+	}
+	req, ok := decodeHiddenItem(w, r)
+	if !ok {
+		return
+	}
+	if req.ID == "" || !canAccessItem(db, sess, req.Type, req.ID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+	table := map[string]string{"task": "tasks", "list": "lists", "board": "boards"}[req.Type]
+	res, err := db.Exec(`DELETE FROM `+table+` WHERE id=$1 AND deleted_at IS NOT NULL`, req.ID)
+	if err != nil {
+		http.Error(w, "delete failed", http.StatusBadRequest)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "only items in the trash can be deleted permanently", http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listHiddenHandler(w http.ResponseWriter, r *http.Request, db *sql.DB, trash bool) {
+	sess, ok := getSessionFromRequest(r, db)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	boardID := r.URL.Query().Get("board_id")
+	if boardID != "" && !canAccessBoard(db, sess, boardID) {
+		http.Error(w, "not found or forbidden", http.StatusNotFound)
+		return
+	}
+	col := hiddenCol(trash)
+
+	// $1 user, $2 token scope, $3 board filter, $4 search
+	rows, err := db.Query(`
+		WITH boards_ok AS (
+		  SELECT b.* FROM boards b
+		  JOIN workspace_members m ON m.workspace_id = b.workspace_id
+		  WHERE m.user_id = $1
+		    AND m.workspace_id = COALESCE($2::uuid, m.workspace_id)
+		    AND b.id = COALESCE(NULLIF($3, '')::uuid, b.id)
+		)
+		SELECT 'task', t.id, t.title, b.id, b.name, l.id, l.name, t.`+col+`
+		FROM tasks t JOIN lists l ON l.id = t.list_id JOIN boards_ok b ON b.id = l.board_id
+		WHERE t.`+col+` IS NOT NULL AND t.title ILIKE '%' || $4 || '%'
+		UNION ALL
+		SELECT 'list', l.id, l.name, b.id, b.name, NULL, NULL, l.`+col+`
+		FROM lists l JOIN boards_ok b ON b.id = l.board_id
+		WHERE l.`+col+` IS NOT NULL AND l.name ILIKE '%' || $4 || '%'
+		UNION ALL
+		SELECT 'board', b.id, b.name, b.id, b.name, NULL, NULL, b.`+col+`
+		FROM boards_ok b
+		WHERE b.`+col+` IS NOT NULL AND b.name ILIKE '%' || $4 || '%'
+		ORDER BY 8 DESC
+		LIMIT 200
+	`, sess.UserID, sess.workspaceScope(), boardID, likeEscape(r.URL.Query().Get("q")))
+	if err != nil {
+		http.Error(w, "query failed", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	items := make([]HiddenItemDTO, 0)
+	for rows.Next() {
+		var it HiddenItemDTO
+		var listID, listName sql.NullString
+		if err := rows.Scan(&it.Type, &it.ID, &it.Title, &it.BoardID, &it.BoardName, &listID, &listName, &it.At); err != nil {
+			continue
+		}
+		if listID.Valid {
+			it.ListID, it.ListName = &listID.String, &listName.String
+		}
+		if trash {
+			p := it.At.Add(trashRetention)
+			it.PurgeAt = &p
+		}
+		items = append(items, it)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+// ---- retention ----
+
+func startTrashJanitor(db *sql.DB) {
+	go func() {
+		for {
+			purgeTrash(db)
+			time.Sleep(time.Hour)
+		}
+	}()
+}
+
+// purgeTrash permanently deletes trash older than trashRetention; the
+// ON DELETE CASCADE chain takes everything underneath with it.
+func purgeTrash(db *sql.DB) {
+	secs := int(trashRetention.Seconds())
+	for _, table := range []string{"boards", "lists", "tasks"} {
+		res, err := db.Exec(`DELETE FROM `+table+` WHERE deleted_at < NOW() - $1::int * INTERVAL '1 second'`, secs)
+		if err != nil {
+			log.Println("trash janitor:", err)
+			continue
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			log.Printf("trash janitor: purged %d %s", n, table)
+		}
+	}
+}
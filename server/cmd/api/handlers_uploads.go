@@ -2,15 +2,62 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 var uploadDir = "/app/server/uploads" // absolute path inside the api container
 
+var errUploadType = errors.New("file type not allowed")
+
+// saveUpload stores the multipart file under uploadDir and returns its public URL.
+// allowedExts (lowercase, with dot) restricts the extension; nil allows anything.
+func saveUpload(file multipart.File, hdr *multipart.FileHeader, allowedExts []string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(hdr.Filename))
+	if ext == "" {
+		ext = ".bin"
+	}
+	if allowedExts != nil {
+		ok := false
+		for _, a := range allowedExts {
+			if ext == a {
+				ok = true
+			}
+		}
+		if !ok {
+			return "", errUploadType
+		}
+	}
+
+	_ = os.MkdirAll(uploadDir, 0o755)
+
+	name := time.Now().UTC().Format("20060102-150405.000000000") + ext
+	dst, err := os.Create(filepath.Join(uploadDir, name))
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+	if _, err = io.Copy(dst, file); err != nil {
+		return "", err
+	}
+	return "/uploads/" + name, nil // path we serve below
+}
+
+// removeUpload deletes a file previously returned by saveUpload (best-effort).
+func removeUpload(url string) {
+	name := strings.TrimPrefix(url, "/uploads/")
+	if name == url || name == "" || strings.ContainsAny(name, `/\`) {
+		return
+	}
+	_ = os.Remove(filepath.Join(uploadDir, name))
+}
+
 func uploadHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -27,28 +74,14 @@ func uploadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	_ = os.MkdirAll(uploadDir, 0o755)
-
-	ext := filepath.Ext(hdr.Filename)
-	if ext == "" {
-		ext = ".bin"
-	}
-	name := time.Now().UTC().Format("20060102-150405.000000000") + ext
-	dstPath := filepath.Join(uploadDir, name)
-
-	dst, err := os.Create(dstPath)
+	url, err := saveUpload(file, hdr, nil)
 	if err != nil {
 		http.Error(w, "cannot save", http.StatusInternalServerError)
 		return
 	}
-	defer dst.Close()
-	if _, err = io.Copy(dst, file); err != nil {
-		http.Error(w, "write error", http.StatusInternalServerError)
-		return
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]string{
-		"url": "/uploads/" + name, // path we serve below
+		"url": url,
 	})
 }
@@ -32,6 +32,16 @@ func main() {
 	}
 	log.Println("DB version:", version)
 
+	if err := loadOIDCProviders(); err != nil {
+		log.Fatal(err)
+	}
+	if len(oidcProviders) > 0 {
+		log.Println("OIDC providers:", len(oidcProviders))
+	}
+
+	startExportJanitor(db)
+	startRecurrenceScheduler(db)
+	startTrashJanitor(db)
 	registerRoutes(db)
 
 	log.Println("API listening on :8080 (with DB)")
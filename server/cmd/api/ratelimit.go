@@ -0,0 +1,217 @@
+// ratelimit.go
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---- token-bucket limiter (dev-only, in-memory like sessions) ----
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// newRateLimiter allows n events per period per key, with bursts of up to burst.
+func newRateLimiter(n int, period time.Duration, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    float64(n) / period.Seconds(),
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow takes one token for key; when none is left it returns how long until one is.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets that have refilled completely; they carry no state.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for k, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	secs := int(math.Ceil(d.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+}
+
+// rateLimit wraps a handler so requests over the limit for their key get 429.
+// An empty key means "don't limit this request".
+func rateLimit(l *rateLimiter, key func(*http.Request) string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		k := key(r)
+		if k != "" {
+			if ok, wait := l.allow(k); !ok {
+				setRetryAfter(w, wait)
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// clientIP is the remote address, or the first X-Forwarded-For hop when
+// TRUST_PROXY=1 (only set that behind a proxy that overwrites the header).
+func clientIP(r *http.Request) string {
+	if os.Getenv("TRUST_PROXY") == "1" {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			return strings.TrimSpace(strings.SplitN(xff, ",", 2)[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func keyByIP(r *http.Request) string { return "ip:" + clientIP(r) }
+
+// keyByCaller limits mutations per session/token, falling back to the IP. Reads pass through.
+func keyByCaller(r *http.Request) string {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return ""
+	}
+	if t, ok := bearerToken(r); ok {
+		return "tok:" + hashAPIToken(t)
+	}
+	if sid, ok := readSIDCookie(r); ok {
+		return "sid:" + sid
+	}
+	return keyByIP(r)
+}
+
+var (
+	loginLimiter    = newRateLimiter(20, time.Minute, 10)
+	registerLimiter = newRateLimiter(10, time.Hour, 5)
+	writeLimiter    = newRateLimiter(300, time.Minute, 60)
+)
+
+// ---- login lockout ----
+// Failed logins are counted per IP and per account. After lockoutFreeFailures
+// each further failure doubles the lockout, capped at lockoutMax.
+
+const (
+	lockoutFreeFailures = 5
+	lockoutBase         = 30 * time.Second
+	lockoutMax          = time.Hour
+	lockoutForget       = time.Hour // failures older than this are forgotten
+)
+
+type failureRecord struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+var (
+	loginFailures      = make(map[string]*failureRecord)
+	loginFailuresMu    sync.Mutex
+	loginFailuresSwept time.Time
+)
+
+func loginKeys(r *http.Request, email string) []string {
+	return []string{keyByIP(r), "acct:" + strings.ToLower(strings.TrimSpace(email))}
+}
+
+// loginLockedFor returns the remaining lockout across all keys (0 when not locked).
+func loginLockedFor(keys []string) time.Duration {
+	loginFailuresMu.Lock()
+	defer loginFailuresMu.Unlock()
+	now := time.Now()
+	var wait time.Duration
+	for _, k := range keys {
+		if f, ok := loginFailures[k]; ok && f.lockedUntil.Sub(now) > wait {
+			wait = f.lockedUntil.Sub(now)
+		}
+	}
+	return wait
+}
+
+func recordLoginFailure(keys []string) {
+	loginFailuresMu.Lock()
+	defer loginFailuresMu.Unlock()
+	now := time.Now()
+	if now.Sub(loginFailuresSwept) > time.Minute { // keep the map from growing without bound
+		loginFailuresSwept = now
+		for k, f := range loginFailures {
+			if now.Sub(f.last) > lockoutForget && now.After(f.lockedUntil) {
+				delete(loginFailures, k)
+			}
+		}
+	}
+	for _, k := range keys {
+		f, ok := loginFailures[k]
+		if !ok {
+			f = &failureRecord{}
+			loginFailures[k] = f
+		}
+		if now.Sub(f.last) > lockoutForget {
+			f.count = 0
+		}
+		f.count++
+		f.last = now
+		if f.count > lockoutFreeFailures {
+			d := lockoutBase << min(f.count-lockoutFreeFailures-1, 16)
+			if d > lockoutMax {
+				d = lockoutMax
+			}
+			f.lockedUntil = now.Add(d)
+		}
+	}
+}
+
+// clearLoginFailures resets the account's counter after a successful login.
+// The IP counter is left alone so one valid account can't launder an attacker's IP.
+func clearLoginFailures(email string) {
+	loginFailuresMu.Lock()
+	defer loginFailuresMu.Unlock()
+	delete(loginFailures, "acct:"+strings.ToLower(strings.TrimSpace(email)))
+}
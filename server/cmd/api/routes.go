@@ -7,19 +7,108 @@ import (
 )
 
 func registerRoutes(db *sql.DB) {
-	http.HandleFunc("/api/boards", func(w http.ResponseWriter, r *http.Request) {
-		boardsHandler(w, r, db)
-	})
-	http.HandleFunc("/api/register", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/boards", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPatch:
+			updateBoardHandler(w, r, db)
+		default:
+			boardsHandler(w, r, db)
+		}
+	}))
+	http.HandleFunc("/api/boards/copy", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		copyBoardHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/boards/transfer", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		transferBoardHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/register", rateLimit(registerLimiter, keyByIP, func(w http.ResponseWriter, r *http.Request) {
 		registerHandler(w, r, db)
-	})
-	http.HandleFunc("/api/login", func(w http.ResponseWriter, r *http.Request) {
+	}))
+	http.HandleFunc("/api/login", rateLimit(loginLimiter, keyByIP, func(w http.ResponseWriter, r *http.Request) {
 		loginHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/login/mfa", rateLimit(loginLimiter, keyByIP, func(w http.ResponseWriter, r *http.Request) {
+		loginMFAHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/oidc/providers", oidcProvidersHandler)
+	http.HandleFunc("/api/oidc/login", oidcLoginHandler)
+	http.HandleFunc("/api/oidc/callback", func(w http.ResponseWriter, r *http.Request) {
+		oidcCallbackHandler(w, r, db)
+	})
+	http.HandleFunc("/api/me", rateLimit(loginLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			meHandler(w, r, db)
+		case http.MethodPatch:
+			updateMeHandler(w, r, db)
+		case http.MethodDelete:
+			deleteMeHandler(w, r, db)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	http.HandleFunc("/api/me/export", func(w http.ResponseWriter, r *http.Request) {
+		dataExportHandler(w, r, db)
 	})
-	http.HandleFunc("/api/me", func(w http.ResponseWriter, r *http.Request) {
-		meHandler(w, r, db)
+	http.HandleFunc("/api/me/export/download", func(w http.ResponseWriter, r *http.Request) {
+		downloadDataExportHandler(w, r, db)
 	})
-	http.HandleFunc("/api/comments", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/me/avatar", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		avatarHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/sessions", func(w http.ResponseWriter, r *http.Request) {
+		sessionsHandler(w, r, db)
+	})
+	http.HandleFunc("/api/sessions/revoke-others", func(w http.ResponseWriter, r *http.Request) {
+		revokeOtherSessionsHandler(w, r, db)
+	})
+	http.HandleFunc("/api/mfa", func(w http.ResponseWriter, r *http.Request) {
+		mfaStatusHandler(w, r, db)
+	})
+	http.HandleFunc("/api/mfa/totp/setup", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		totpSetupHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/mfa/totp/confirm", rateLimit(loginLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		totpConfirmHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/mfa/totp/disable", rateLimit(loginLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		totpDisableHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/mfa/recovery-codes", rateLimit(loginLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		regenerateRecoveryCodesHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/tokens", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		apiTokensHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/calendar", func(w http.ResponseWriter, r *http.Request) {
+		calendarHandler(w, r, db)
+	})
+	http.HandleFunc("/api/calendar/feed", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		calendarFeedHandler(w, r, db)
+	}))
+	// public: the secret in the path authenticates
+	http.HandleFunc("/api/calendar/ics/", rateLimit(writeLimiter, keyByIP, func(w http.ResponseWriter, r *http.Request) {
+		calendarICSHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/timeline", func(w http.ResponseWriter, r *http.Request) {
+		timelineHandler(w, r, db)
+	})
+	http.HandleFunc("/api/timeline/calendar", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		timelineCalendarHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/timeline/schedule", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		scheduleTaskHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/flow/history", func(w http.ResponseWriter, r *http.Request) {
+		taskHistoryHandler(w, r, db)
+	})
+	http.HandleFunc("/api/flow/metrics", func(w http.ResponseWriter, r *http.Request) {
+		flowMetricsHandler(w, r, db)
+	})
+	http.HandleFunc("/api/flow/cfd", func(w http.ResponseWriter, r *http.Request) {
+		flowCFDHandler(w, r, db)
+	})
+	http.HandleFunc("/api/comments", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
 			listCommentsHandler(w, r, db)
@@ -28,9 +117,11 @@ func registerRoutes(db *sql.DB) {
 		default:
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
-	})
-	http.HandleFunc("/api/tasks", func(w http.ResponseWriter, r *http.Request) {
+	}))
+	http.HandleFunc("/api/tasks", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
+		case http.MethodGet:
+			queryTasksHandler(w, r, db)
 		case http.MethodPost:
 			createTaskHandler(w, r, db)
 		case http.MethodPatch:
@@ -40,14 +131,84 @@ func registerRoutes(db *sql.DB) {
 		default:
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
+	}))
+	http.HandleFunc("/api/tasks/children", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		taskChildrenHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/tasks/hierarchy", func(w http.ResponseWriter, r *http.Request) {
+		taskHierarchyHandler(w, r, db)
 	})
-	http.HandleFunc("/api/tasks/reorder", func(w http.ResponseWriter, r *http.Request) {
-		reorderOrMoveTaskHandler(w, r, db)
+	http.HandleFunc("/api/task-links", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		taskLinksHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/custom-fields", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		customFieldsHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/tasks/fields", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		taskFieldsHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/timer", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		timerHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/time-entries", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		timeEntriesHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/time-report", func(w http.ResponseWriter, r *http.Request) {
+		timeReportHandler(w, r, db)
 	})
-	http.HandleFunc("/api/lists/reorder", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/api/tasks/recurrence", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		taskRecurrenceHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/templates", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		templatesHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/templates/instantiate", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		instantiateTemplateHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/archive", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		archiveHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/trash", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		trashHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/trash/restore", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		restoreFromTrashHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/lanes", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		lanesHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/checklists", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		checklistsHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/checklist-items", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		checklistItemsHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/checklist-items/reorder", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		reorderChecklistItemsHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/tasks/reorder", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		reorderOrMoveTaskHandler(w, r, db)
+	}))
+	// same operation under the name clients use for cross-board moves
+	http.HandleFunc("/api/tasks/move", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		reorderOrMoveTaskHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/tasks/bulk", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		bulkTasksHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/tasks/copy", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		copyTaskHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/lists", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		updateListHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/lists/sort", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
+		sortListHandler(w, r, db)
+	}))
+	http.HandleFunc("/api/lists/reorder", rateLimit(writeLimiter, keyByCaller, func(w http.ResponseWriter, r *http.Request) {
 		reorderListsHandler(w, r, db)
-	})
+	}))
 	http.HandleFunc("/api/logout", logoutHandler)
-	http.HandleFunc("/api/uploads", uploadHandler)
+	http.HandleFunc("/api/uploads", rateLimit(writeLimiter, keyByCaller, uploadHandler))
 	http.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir(uploadDir))))
 }